@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusRecorder records the status code written through a
+// http.ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logAccess wraps handler to log every request it serves as a logfmt line of
+// the method, path, status, duration and remote address, when
+// -web.access-log is set.
+func logAccess(handler http.Handler) http.Handler {
+	if !accessLog {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+		log.Printf("access method=%s path=%q status=%d duration=%s remote=%s user_agent=%q",
+			r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Microsecond), r.RemoteAddr, r.UserAgent())
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxAccumulationGap is the longest time between two observations of a
+// station that is still accumulated. Longer gaps, such as while the exporter
+// was stopped, are skipped rather than assumed to share the values of the
+// observation ending them.
+const maxAccumulationGap = 2 * time.Hour
+
+// Accumulation is a quantity summed over the observations of every station,
+// exported as a counter of the total and optionally a gauge of the total
+// since local midnight.
+type Accumulation struct {
+	Name string
+	Help string
+	// TodayName and TodayHelp describe the gauge of today's total, which is
+	// not exported when TodayName is empty.
+	TodayName string
+	TodayHelp string
+	// Increment returns the amount to add for an observation following the
+	// previous one by elapsed, reporting false when the observation lacks the
+	// values it needs.
+	Increment func(response ObservationResponse, elapsed time.Duration) (float64, bool)
+	// Discrete accumulations sum values reported for a period, such as the
+	// precipitation of the last hour, rather than integrating values over
+	// time. Their Increment is called for every observation, with elapsed
+	// the time since the last observation it counted, or zero when it has
+	// not counted any.
+	Discrete bool
+
+	desc      *prometheus.Desc
+	todayDesc *prometheus.Desc
+}
+
+// stationTotals are the totals of a single station, as saved in -state-file.
+type stationTotals struct {
+	// Last is the time of the last observation added to the totals.
+	Last time.Time `json:"last"`
+	// Day is the local date the Today totals were accumulated on.
+	Day    string             `json:"day"`
+	Totals map[string]float64 `json:"totals"`
+	Today  map[string]float64 `json:"today"`
+	// Counted is the time of the last observation counted by each discrete
+	// accumulation.
+	Counted map[string]time.Time `json:"counted,omitempty"`
+
+	// active is set once an observation of the station is added, so totals
+	// loaded for stations that are no longer scraped are not exported.
+	active bool
+}
+
+// accumulator exports the totals of every Accumulation. It implements
+// DeletePartialMatch like the metric vectors, so deleting a station's series
+// stops exporting its totals. The totals themselves are kept, so a station
+// that is restarted carries on from them.
+type accumulator struct {
+	mu            sync.Mutex
+	accumulations []*Accumulation
+	stations      map[string]*stationTotals
+	path          string
+}
+
+// totals holds the accumulations of the observations collector.
+var totals = &accumulator{stations: map[string]*stationTotals{}}
+
+// addAccumulation registers an accumulation with totals. It must be called
+// from an init function, before the metrics are registered.
+func addAccumulation(a *Accumulation) {
+	a.desc = prometheus.NewDesc(a.Name, a.Help, []string{"station"}, nil)
+	if a.TodayName != "" {
+		a.todayDesc = prometheus.NewDesc(a.TodayName, a.TodayHelp, []string{"station"}, nil)
+	}
+	totals.accumulations = append(totals.accumulations, a)
+}
+
+func (a *accumulator) Describe(ch chan<- *prometheus.Desc) {
+	for _, accumulation := range a.accumulations {
+		ch <- accumulation.desc
+		if accumulation.todayDesc != nil {
+			ch <- accumulation.todayDesc
+		}
+	}
+}
+
+func (a *accumulator) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for station, state := range a.stations {
+		if !state.active {
+			continue
+		}
+		for _, accumulation := range a.accumulations {
+			total, ok := state.Totals[accumulation.Name]
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(accumulation.desc, prometheus.CounterValue, total, station)
+			if accumulation.todayDesc != nil {
+				ch <- prometheus.MustNewConstMetric(accumulation.todayDesc, prometheus.GaugeValue, state.Today[accumulation.Name], station)
+			}
+		}
+	}
+}
+
+// DeletePartialMatch stops exporting the totals of the station labelled in
+// labels.
+func (a *accumulator) DeletePartialMatch(labels prometheus.Labels) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	state, ok := a.stations[labels["station"]]
+	if !ok || !state.active {
+		return 0
+	}
+	state.active = false
+	return len(a.accumulations)
+}
+
+// Add adds the observation to the station's totals. Observations no newer
+// than the last one added are ignored, and the first observation of a station
+// or one following a long gap only starts the next interval. The totals are
+// saved to -state-file when it is set.
+func (a *accumulator) Add(station string, response ObservationResponse) {
+	now := response.Properties.Timestamp
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, ok := a.stations[station]
+	if !ok {
+		state = &stationTotals{}
+		a.stations[station] = state
+	}
+	if state.Totals == nil {
+		state.Totals = map[string]float64{}
+	}
+	if state.Counted == nil {
+		state.Counted = map[string]time.Time{}
+	}
+	state.active = true
+	if !now.After(state.Last) {
+		return
+	}
+	elapsed := now.Sub(state.Last)
+	first := state.Last.IsZero() || elapsed > maxAccumulationGap
+	state.Last = now
+
+	day := now.In(time.Local).Format("2006-01-02")
+	if day != state.Day || state.Today == nil {
+		state.Day = day
+		state.Today = map[string]float64{}
+	}
+	for _, accumulation := range a.accumulations {
+		name := accumulation.Name
+		if _, ok := state.Totals[name]; !ok {
+			state.Totals[name] = 0
+		}
+
+		interval := elapsed
+		if accumulation.Discrete {
+			interval = 0
+			if last, ok := state.Counted[name]; ok {
+				interval = now.Sub(last)
+			}
+		} else if first {
+			continue
+		}
+		if amount, ok := accumulation.Increment(response, interval); ok {
+			state.Totals[name] += amount
+			state.Today[name] += amount
+			if accumulation.Discrete {
+				state.Counted[name] = now
+			}
+		}
+	}
+
+	if err := a.save(); err != nil {
+		log.Printf("Problem saving state file %s: %s", a.path, err)
+	}
+}
+
+// Today returns the station's total of the named accumulation since local
+// midnight of day, reporting false when the station has no observations of
+// that day.
+func (a *accumulator) Today(station, name string, day time.Time) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	state, ok := a.stations[station]
+	if !ok || state.Day != day.In(time.Local).Format("2006-01-02") {
+		return 0, false
+	}
+	return state.Today[name], true
+}
+
+// Load reads the totals saved in the state file at path and saves them there
+// from then on. A missing file is not an error.
+func (a *accumulator) Load(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &a.stations)
+}
+
+// save writes the totals to the state file, through a temporary file so a
+// crash never leaves a partially written one behind.
+func (a *accumulator) save() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(a.stations, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccumulatorAdd(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.UTC
+
+	hours := &Accumulation{
+		Name: "hours",
+		Increment: func(_ ObservationResponse, elapsed time.Duration) (float64, bool) {
+			return elapsed.Hours(), true
+		},
+	}
+	reports := &Accumulation{
+		Name:     "reports",
+		Discrete: true,
+		Increment: func(ObservationResponse, time.Duration) (float64, bool) {
+			return 1, true
+		},
+	}
+	a := &accumulator{accumulations: []*Accumulation{hours, reports}, stations: map[string]*stationTotals{}}
+
+	start := time.Date(2024, 6, 15, 22, 30, 0, 0, time.UTC)
+	add := func(after time.Duration) {
+		var response ObservationResponse
+		response.Properties.Timestamp = start.Add(after)
+		a.Add("KPHL", response)
+	}
+	check := func(step string, wantHours, wantReports float64) {
+		t.Helper()
+		totals := a.stations["KPHL"].Totals
+		if totals["hours"] != wantHours || totals["reports"] != wantReports {
+			t.Errorf("%s: totals = %v hours and %v reports, want %v and %v", step, totals["hours"], totals["reports"], wantHours, wantReports)
+		}
+	}
+
+	// the first observation only starts the interval of continuous
+	// accumulations, while discrete ones count it
+	add(0)
+	check("first observation", 0, 1)
+	add(time.Hour)
+	check("an hour later", 1, 2)
+	add(time.Hour)
+	check("same observation again", 1, 2)
+	add(30 * time.Minute)
+	check("older observation", 1, 2)
+
+	// the day rolls over at local midnight
+	add(2 * time.Hour)
+	check("after midnight", 2, 3)
+	if today, ok := a.Today("KPHL", "hours", start.Add(2*time.Hour)); !ok || today != 1 {
+		t.Errorf("hours since midnight = %v, %v, want 1, true", today, ok)
+	}
+	if _, ok := a.Today("KPHL", "hours", start); ok {
+		t.Error("Today reported a total for the previous day")
+	}
+
+	// a gap longer than maxAccumulationGap is skipped
+	add(5 * time.Hour)
+	check("after a gap", 2, 4)
+	add(5*time.Hour + 30*time.Minute)
+	check("after the gap", 2.5, 5)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// stationJSON is the json representation of a station used by the admin api.
+type stationJSON struct {
+	ID             string `json:"id"`
+	Name           string `json:"name,omitempty"`
+	Interval       string `json:"interval,omitempty"`
+	Type           string `json:"type,omitempty"`
+	TideStation    string `json:"tide_station,omitempty"`
+	NormalsStation string `json:"normals_station,omitempty"`
+}
+
+func (s stationJSON) config() (StationConfig, error) {
+	config := StationConfig{ID: strings.TrimSpace(s.ID), Name: strings.TrimSpace(s.Name)}
+	if config.ID == "" || strings.ContainsAny(config.ID, "/:=,") {
+		return config, fmt.Errorf("invalid station id %q", s.ID)
+	}
+	if s.Interval != "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("invalid interval %q for station %s", s.Interval, config.ID)
+		}
+		config.Interval = d
+	}
+	stationType, err := ParseStationType(s.Type)
+	if err != nil {
+		return config, err
+	}
+	config.Type = stationType
+	if s.TideStation != "" {
+		if err := ValidateTideStation(s.TideStation); err != nil {
+			return config, err
+		}
+		config.TideStation = s.TideStation
+	}
+	if s.NormalsStation != "" {
+		if err := ValidateNormalsStation(s.NormalsStation); err != nil {
+			return config, err
+		}
+		config.NormalsStation = s.NormalsStation
+	}
+	return config, nil
+}
+
+func newStationJSON(config StationConfig) stationJSON {
+	s := stationJSON{
+		ID:             config.ID,
+		Name:           config.Name,
+		Type:           config.Type,
+		TideStation:    config.TideStation,
+		NormalsStation: config.NormalsStation,
+	}
+	if config.Interval > 0 {
+		s.Interval = config.Interval.String()
+	}
+	return s
+}
+
+// AdminHandler serves the station management api under /api/v1/stations:
+//
+//	GET    /api/v1/stations       lists the scraped stations
+//	POST   /api/v1/stations       starts scraping the station in the body
+//	DELETE /api/v1/stations/{id}  stops scraping a station
+//
+// Every request must carry the token as "Authorization: Bearer <token>".
+type AdminHandler struct {
+	Token   string
+	Manager *StationManager
+}
+
+func (h AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/stations"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		var stations []stationJSON
+		for _, config := range h.Manager.Stations() {
+			stations = append(stations, newStationJSON(config))
+		}
+		writeJSON(w, http.StatusOK, stations)
+	case id == "" && r.Method == http.MethodPost:
+		var s stationJSON
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %s", err), http.StatusBadRequest)
+			return
+		}
+		config, err := s.config()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Admin api adding station %s", config.ID)
+		h.Manager.Add(config)
+		writeJSON(w, http.StatusCreated, newStationJSON(config))
+	case id != "" && r.Method == http.MethodDelete:
+		log.Printf("Admin api removing station %s", id)
+		if !h.Manager.Remove(id) {
+			http.Error(w, fmt.Sprintf("station %s is not being scraped", id), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Problem writing response: %s", err)
+	}
+}
+
+// serveAdmin serves the admin endpoints on a listener of their own, so they
+// can be kept on localhost while metrics are scraped over the network. It is
+// served like the metrics listener until shut down.
+func serveAdmin(server *http.Server) {
+	log.Printf("Serving admin endpoints on %s", server.Addr)
+	if err := listenAndServe(server, "admin"); err != http.ErrServerClosed {
+		log.Fatalf("error: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	airQualityIndex = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "air_quality_index",
+			Help: "current air quality index of each pollutant reported by airnow for the reporting area nearest the station",
+		},
+		[]string{"station", "pollutant", "area"},
+	)
+	airQualityCategory = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "air_quality_category",
+			Help: "current air quality category of each pollutant reported by airnow for the reporting area nearest the station, from 1 good to 6 hazardous",
+		},
+		[]string{"station", "pollutant", "area"},
+	)
+)
+
+// airnowPollutants maps the parameters reported by airnow to the pollutant
+// label.
+var airnowPollutants = map[string]string{
+	"O3":    "ozone",
+	"OZONE": "ozone",
+	"PM2.5": "pm2_5",
+	"PM10":  "pm10",
+}
+
+func init() {
+	registerCollector("airnow", false, &airnowCollector{}, airQualityIndex, airQualityCategory)
+}
+
+// airnowCollector exports the current air quality at each station, retrieved
+// from airnow at -airnow.address every -airnow.interval with the api key held
+// in -airnow.api-key-file.
+type airnowCollector struct {
+	refreshTracker
+}
+
+func (c *airnowCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, keyFile, airnowAddr, addr, t := airnowInterval, airnowAPIKeyFile, airnowAddress, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	if keyFile == "" {
+		return errors.New("-airnow.api-key-file is not set")
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	point, err := StationPoint(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	if len(point.Geometry.Coordinates) < 2 {
+		return fmt.Errorf("point of station %s has no location", config.ID)
+	}
+	lon, lat := point.Geometry.Coordinates[0], point.Geometry.Coordinates[1]
+
+	observations, err := RetrieveAirQuality(ctx, lat, lon, strings.TrimSpace(string(key)), airnowAddr, t)
+	if err != nil {
+		return err
+	}
+	updateAirQualityMetrics(config.ID, observations)
+	c.Done(config.ID)
+	return nil
+}
+
+// AirQualityObservation is the current air quality of a pollutant in a
+// reporting area, as returned by the airnow api.
+type AirQualityObservation struct {
+	ReportingArea string `json:"ReportingArea"`
+	StateCode     string `json:"StateCode"`
+	ParameterName string `json:"ParameterName"`
+	AQI           int    `json:"AQI"`
+	Category      struct {
+		Number int    `json:"Number"`
+		Name   string `json:"Name"`
+	} `json:"Category"`
+}
+
+// RetrieveAirQuality retrieves the current air quality of the reporting area
+// nearest a location from the airnow api at address.
+func RetrieveAirQuality(ctx context.Context, lat, lon float64, apiKey string, address string, timeout int) ([]AirQualityObservation, error) {
+	query := url.Values{
+		"format":    {"application/json"},
+		"latitude":  {fmt.Sprintf("%.4f", lat)},
+		"longitude": {fmt.Sprintf("%.4f", lon)},
+		"distance":  {"25"},
+		"API_KEY":   {apiKey},
+	}
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/aq/observation/latLong/current/",
+		RawQuery: query.Encode(),
+	}
+
+	var observations []AirQualityObservation
+	if _, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &observations); err != nil {
+		// request errors include the url, and with it the api key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	return observations, nil
+}
+
+// updateAirQualityMetrics replaces the station's series with the observations.
+// Observations of pollutants missing from airnowPollutants, or without an
+// index, are left out.
+func updateAirQualityMetrics(station string, observations []AirQualityObservation) {
+	labels := prometheus.Labels{"station": station}
+	airQualityIndex.DeletePartialMatch(labels)
+	airQualityCategory.DeletePartialMatch(labels)
+
+	for _, observation := range observations {
+		pollutant, ok := airnowPollutants[strings.ToUpper(strings.TrimSpace(observation.ParameterName))]
+		if !ok || observation.AQI < 0 {
+			continue
+		}
+		area := strings.TrimSpace(observation.ReportingArea)
+		airQualityIndex.WithLabelValues(station, pollutant, area).Set(float64(observation.AQI))
+		if observation.Category.Number > 0 {
+			airQualityCategory.WithLabelValues(station, pollutant, area).Set(float64(observation.Category.Number))
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertFields are the fields of an alert that can be mapped to alertmanager
+// labels and annotations by -alertmanager.labels and
+// -alertmanager.annotations.
+var alertFields = map[string]func(Alert) string{
+	"id":           func(a Alert) string { return a.ID },
+	"event":        func(a Alert) string { return a.Event },
+	"severity":     func(a Alert) string { return a.Severity },
+	"urgency":      func(a Alert) string { return a.Urgency },
+	"certainty":    func(a Alert) string { return a.Certainty },
+	"message_type": func(a Alert) string { return a.MessageType },
+	"sender":       func(a Alert) string { return a.SenderName },
+	"headline":     func(a Alert) string { return a.Headline },
+	"description":  func(a Alert) string { return a.Description },
+	"instruction":  func(a Alert) string { return a.Instruction },
+	"area":         func(a Alert) string { return a.AreaDesc },
+}
+
+// ParseAlertFieldMapping parses a comma separated list of name=field pairs,
+// such as "alertname=event,severity=severity", mapping alertmanager label or
+// annotation names to the alert fields they are set from.
+func ParseAlertFieldMapping(mapping string) (map[string]string, error) {
+	pairs := labelsFlag{}
+	if err := pairs.Set(mapping); err != nil {
+		return nil, err
+	}
+	for name, field := range pairs {
+		if _, ok := alertFields[field]; !ok {
+			return nil, fmt.Errorf("unknown alert field %q for %s", field, name)
+		}
+	}
+	return pairs, nil
+}
+
+// PostableAlert is an alert as accepted by the alertmanager v2 api.
+type PostableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// alertmanagerPusher pushes the active alerts of every station to
+// -alertmanager.url. Alertmanager resolves alerts that are not sent again
+// before their end, so the active alerts of a station are all pushed every
+// time they are retrieved. Alerts that are no longer active are pushed once
+// more ending now, so they resolve straight away.
+type alertmanagerPusher struct {
+	mu sync.Mutex
+	// sent are the alerts last pushed for each station by alert id, kept
+	// until they are pushed resolved.
+	sent  map[string]map[string]PostableAlert
+	queue chan alertmanagerPush
+}
+
+// alertmanagerPush is a push of the alerts of a station queued by Push, along
+// with the flags it was queued with.
+type alertmanagerPush struct {
+	station string
+	url     string
+	timeout int
+	alerts  []PostableAlert
+	// resolved are the alerts pushed ending now, as they were last sent, which
+	// are pushed resolved again next time when this push fails
+	resolved map[string]PostableAlert
+}
+
+var alertmanager = &alertmanagerPusher{
+	sent:  map[string]map[string]PostableAlert{},
+	queue: make(chan alertmanagerPush, 100),
+}
+
+// Push queues a push of the active alerts of the station, along with those
+// that are no longer active, to -alertmanager.url when it is set. The caller
+// holds configMu.
+func (p *alertmanagerPusher) Push(station string, alerts []Alert, now time.Time) {
+	if alertmanagerURL == "" {
+		return
+	}
+	labels, err := ParseAlertFieldMapping(alertmanagerLabels)
+	if err != nil {
+		log.Printf("Problem pushing alerts of station %s to alertmanager: -alertmanager.labels: %s", station, err)
+		return
+	}
+	annotations, err := ParseAlertFieldMapping(alertmanagerAnnotations)
+	if err != nil {
+		log.Printf("Problem pushing alerts of station %s to alertmanager: -alertmanager.annotations: %s", station, err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	active := map[string]PostableAlert{}
+	for _, alert := range alerts {
+		active[alert.ID] = newPostableAlert(station, alert, labels, annotations)
+	}
+	push := alertmanagerPush{
+		station:  station,
+		url:      alertmanagerURL,
+		timeout:  timeout,
+		resolved: map[string]PostableAlert{},
+	}
+	for id, alert := range p.sent[station] {
+		if _, ok := active[id]; !ok && alert.EndsAt.After(now) {
+			push.resolved[id] = alert
+			alert.EndsAt = now
+			push.alerts = append(push.alerts, alert)
+		}
+	}
+	for _, alert := range active {
+		push.alerts = append(push.alerts, alert)
+	}
+	if len(push.alerts) == 0 {
+		delete(p.sent, station)
+		return
+	}
+	p.sent[station] = active
+
+	select {
+	case p.queue <- push:
+	default:
+		log.Printf("Problem pushing alerts of station %s to alertmanager: too many pushes queued", station)
+		p.unresolve(push)
+	}
+}
+
+// Run posts the queued pushes to alertmanager in order. A push that fails is
+// not retried, as the active alerts are pushed again by the next scrape, but
+// the alerts it resolved are kept to be pushed resolved again.
+func (p *alertmanagerPusher) Run() {
+	for push := range p.queue {
+		if err := postAlerts(push.url, push.timeout, push.alerts); err != nil {
+			log.Printf("Problem pushing alerts of station %s to alertmanager: %s", push.station, err)
+			p.mu.Lock()
+			p.unresolve(push)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// unresolve records the alerts resolved by the push as sent again, unless they
+// became active again since, so the next push resolves them. Nothing is kept
+// for a station forgotten since, or left with no alerts to push, which
+// alertmanager resolves once the alerts end. p.mu must be held.
+func (p *alertmanagerPusher) unresolve(push alertmanagerPush) {
+	sent, ok := p.sent[push.station]
+	if !ok {
+		return
+	}
+	for id, alert := range push.resolved {
+		if _, ok := sent[id]; !ok {
+			sent[id] = alert
+		}
+	}
+}
+
+// Forget drops the alerts pushed for a station that is no longer scraped,
+// leaving alertmanager to resolve them when they end.
+func (p *alertmanagerPusher) Forget(station string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sent, station)
+}
+
+// newPostableAlert maps the alert of the station to an alertmanager alert,
+// starting at its onset and ending when it ends or expires.
+func newPostableAlert(station string, alert Alert, labels, annotations map[string]string) PostableAlert {
+	postable := PostableAlert{
+		Labels:       map[string]string{"station": station},
+		Annotations:  map[string]string{},
+		StartsAt:     alert.Effective,
+		EndsAt:       alert.Expires,
+		GeneratorURL: fmt.Sprintf("https://%s/alerts/%s", address, alert.ID),
+	}
+	if alert.Onset != nil {
+		postable.StartsAt = *alert.Onset
+	}
+	if alert.Ends != nil {
+		postable.EndsAt = *alert.Ends
+	}
+	for name, field := range labels {
+		if v := alertFields[field](alert); v != "" {
+			postable.Labels[name] = v
+		}
+	}
+	for name, field := range annotations {
+		if v := alertFields[field](alert); v != "" {
+			postable.Annotations[name] = v
+		}
+	}
+	return postable
+}
+
+// postAlerts posts the alerts to the alertmanager at alertmanagerURL.
+func postAlerts(alertmanagerURL string, timeout int, alerts []PostableAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Post(strings.TrimSuffix(alertmanagerURL, "/")+"/api/v2/alerts", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("err: %d, %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// setAlertmanagerFlags sets the -alertmanager flags for the test.
+func setAlertmanagerFlags(t *testing.T, url, labels, annotations string) {
+	oldURL, oldLabels, oldAnnotations := alertmanagerURL, alertmanagerLabels, alertmanagerAnnotations
+	t.Cleanup(func() {
+		alertmanagerURL, alertmanagerLabels, alertmanagerAnnotations = oldURL, oldLabels, oldAnnotations
+	})
+	alertmanagerURL, alertmanagerLabels, alertmanagerAnnotations = url, labels, annotations
+}
+
+func newTestPusher() *alertmanagerPusher {
+	return &alertmanagerPusher{sent: map[string]map[string]PostableAlert{}, queue: make(chan alertmanagerPush, 10)}
+}
+
+func TestAlertmanagerPush(t *testing.T) {
+	setAlertmanagerFlags(t, "http://alertmanager:9093", "alertname=event", "summary=headline")
+	p := newTestPusher()
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	storm := Alert{ID: "storm", Event: "Severe Thunderstorm Warning", Headline: "storms", Effective: now, Expires: now.Add(time.Hour)}
+
+	p.Push("KPHL", []Alert{storm}, now)
+	push := <-p.queue
+	if len(push.alerts) != 1 {
+		t.Fatalf("pushed %d alerts, want 1", len(push.alerts))
+	}
+	alert := push.alerts[0]
+	if alert.Labels["station"] != "KPHL" || alert.Labels["alertname"] != storm.Event || alert.Annotations["summary"] != storm.Headline {
+		t.Errorf("pushed labels %v and annotations %v", alert.Labels, alert.Annotations)
+	}
+	if !alert.StartsAt.Equal(now) || !alert.EndsAt.Equal(storm.Expires) {
+		t.Errorf("pushed alert from %v to %v, want from %v to %v", alert.StartsAt, alert.EndsAt, now, storm.Expires)
+	}
+
+	// an alert no longer active is pushed once more, resolved
+	later := now.Add(10 * time.Minute)
+	p.Push("KPHL", nil, later)
+	push = <-p.queue
+	if len(push.alerts) != 1 || !push.alerts[0].EndsAt.Equal(later) {
+		t.Fatalf("pushed %+v, want the alert resolved at %v", push.alerts, later)
+	}
+	p.Push("KPHL", nil, later)
+	if len(p.queue) != 0 {
+		t.Error("pushed again with no alerts left to resolve")
+	}
+
+	// invalid mappings are reported rather than pushed without labels
+	alertmanagerLabels = "alertname=nonsense"
+	p.Push("KPHL", []Alert{storm}, now)
+	if len(p.queue) != 0 {
+		t.Error("pushed with an invalid -alertmanager.labels")
+	}
+}
+
+func TestAlertmanagerRunResolvesAgain(t *testing.T) {
+	statuses := make(chan int, 10)
+	posted := make(chan []PostableAlert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []PostableAlert
+		json.NewDecoder(r.Body).Decode(&alerts)
+		w.WriteHeader(<-statuses)
+		posted <- alerts
+	}))
+	defer server.Close()
+	setAlertmanagerFlags(t, server.URL, "", "")
+	p := newTestPusher()
+	go p.Run()
+	defer close(p.queue)
+	now := time.Now()
+	storm := Alert{ID: "storm", Effective: now, Expires: now.Add(time.Hour)}
+
+	statuses <- http.StatusOK
+	p.Push("KPHL", []Alert{storm}, now)
+	<-posted
+
+	statuses <- http.StatusServiceUnavailable
+	p.Push("KPHL", nil, now.Add(time.Minute))
+	<-posted
+	// Run keeps the alert once the failed push returns
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		_, kept := p.sent["KPHL"]["storm"]
+		p.mu.Unlock()
+		if kept {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the alert of the failed push was not kept")
+		}
+	}
+
+	// the next push resolves it again
+	statuses <- http.StatusOK
+	resolved := now.Add(2 * time.Minute)
+	p.Push("KPHL", nil, resolved)
+	if alerts := <-posted; len(alerts) != 1 || !alerts[0].EndsAt.Equal(resolved) {
+		t.Errorf("posted %+v, want the alert resolved at %v", alerts, resolved)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	alertActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_active",
+			Help: "number of active alerts of each event, severity and urgency in effect for the station",
+		},
+		[]string{"station", "event", "severity", "urgency"},
+	)
+	alertCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_count",
+			Help: "number of active alerts in effect for the station",
+		},
+		[]string{"station"},
+	)
+)
+
+// alertTimes exports when each active alert begins and ends.
+var alertTimes = &alertTimer{
+	alerts: map[string][]Alert{},
+	onset: prometheus.NewDesc("alert_onset_timestamp_seconds",
+		"time the hazard of each active alert is expected to begin as a unix timestamp",
+		[]string{"station", "id", "event"}, nil),
+	expires: prometheus.NewDesc("alert_expires_timestamp_seconds",
+		"time each active alert expires unless it is updated as a unix timestamp",
+		[]string{"station", "id", "event"}, nil),
+	ends: prometheus.NewDesc("alert_ends_timestamp_seconds",
+		"time the hazard of each active alert is expected to end as a unix timestamp",
+		[]string{"station", "id", "event"}, nil),
+	remaining: prometheus.NewDesc("alert_remaining_seconds",
+		"seconds until each active alert ends, or expires when no end is given",
+		[]string{"station", "id", "event"}, nil),
+}
+
+func init() {
+	registerCollector("alerts", false, &alertsCollector{}, alertActive, alertCount, alertTimes, stationZoneInfo)
+}
+
+// alertsCollector exports the active alerts in effect at the location of a
+// station, or in the zones listed in -alerts.zone, retrieved every
+// -alerts.interval. With -alerts.zone auto the alerts of the zones covering
+// the station are retrieved.
+type alertsCollector struct {
+	refreshTracker
+}
+
+func (c *alertsCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, zoneList, addr, t := alertsInterval, alertZones, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	query := url.Values{}
+	if zoneList == "auto" {
+		zones, err := ResolveStationZones(ctx, config.ID, addr, t)
+		if err != nil {
+			return err
+		}
+		updateStationZoneInfo(config.ID, zones)
+		query.Set("zone", strings.Join(zones.IDs(), ","))
+	} else if zones, _ := ParseAlertZones(zoneList); len(zones) != 0 {
+		query.Set("zone", strings.Join(zones, ","))
+	} else {
+		var err error
+		if query, err = stationAlertsQuery(ctx, config.ID, addr, t); err != nil {
+			return err
+		}
+	}
+	alerts, err := RetrieveActiveAlerts(ctx, query, addr, t)
+	if err != nil {
+		return err
+	}
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+	updateAlertMetrics(config.ID, alerts)
+	if !probing(config.ID) {
+		alertNotifications.Update(config.ID, alerts, time.Now())
+		alertmanager.Push(config.ID, alerts, time.Now())
+	}
+	c.Done(config.ID)
+	return nil
+}
+
+// Remove drops the station's alerts from those notified to
+// -alerts.webhook-url and pushed to -alertmanager.url. They are kept when the
+// station is only restarted, so its alerts that are still active are not
+// notified again as new.
+func (c *alertsCollector) Remove(station string) {
+	alertNotifications.Forget(station)
+	alertmanager.Forget(station)
+}
+
+// stationAlertsQuery returns the query retrieving the alerts in effect at the
+// location of the station.
+func stationAlertsQuery(ctx context.Context, station string, address string, timeout int) (url.Values, error) {
+	point, err := StationPoint(ctx, station, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(point.Geometry.Coordinates) < 2 {
+		return nil, fmt.Errorf("point of station %s has no location", station)
+	}
+	lon, lat := point.Geometry.Coordinates[0], point.Geometry.Coordinates[1]
+	return url.Values{"point": {fmt.Sprintf("%.4f,%.4f", lat, lon)}}, nil
+}
+
+// AlertsResponse is the json structure returned by the national weather
+// service alerts api.
+type AlertsResponse struct {
+	Features []struct {
+		Properties Alert `json:"properties"`
+	} `json:"features"`
+}
+
+// Alert is a single alert, such as a warning or advisory, made up of the
+// fields of its common alerting protocol message.
+type Alert struct {
+	ID          string     `json:"id"`
+	AreaDesc    string     `json:"areaDesc"`
+	Sent        time.Time  `json:"sent"`
+	Effective   time.Time  `json:"effective"`
+	Onset       *time.Time `json:"onset"`
+	Expires     time.Time  `json:"expires"`
+	Ends        *time.Time `json:"ends"`
+	Status      string     `json:"status"`
+	MessageType string     `json:"messageType"`
+	Event       string     `json:"event"`
+	Severity    string     `json:"severity"`
+	Certainty   string     `json:"certainty"`
+	Urgency     string     `json:"urgency"`
+	SenderName  string     `json:"senderName"`
+	Headline    string     `json:"headline"`
+	Description string     `json:"description"`
+	Instruction string     `json:"instruction"`
+}
+
+// RetrieveActiveAlerts retrieves the active alerts matching query, such as a
+// point or zone. Only actual alerts are retrieved, leaving out exercises and
+// tests.
+func RetrieveActiveAlerts(ctx context.Context, query url.Values, address string, timeout int) ([]Alert, error) {
+	query.Set("status", "actual")
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/alerts/active",
+		RawQuery: query.Encode(),
+	}
+
+	response := AlertsResponse{}
+	if _, err := retrieve(ctx, requestURL, timeout, &response); err != nil {
+		return nil, err
+	}
+	alerts := make([]Alert, 0, len(response.Features))
+	for _, feature := range response.Features {
+		alerts = append(alerts, feature.Properties)
+	}
+	return alerts, nil
+}
+
+// ParseAlertZones parses a comma separated list of zone ids, such as
+// "PAZ071,PAC101".
+func ParseAlertZones(zones string) ([]string, error) {
+	var ids []string
+	for _, zone := range strings.Split(zones, ",") {
+		zone = strings.ToUpper(strings.TrimSpace(zone))
+		if zone == "" {
+			continue
+		}
+		if len(zone) != 6 || !strings.ContainsAny(zone[2:3], "CZ") {
+			return nil, fmt.Errorf("invalid zone %q, expected a zone id such as PAZ071", zone)
+		}
+		ids = append(ids, zone)
+	}
+	return ids, nil
+}
+
+// updateAlertMetrics replaces the station's alert series with the alerts.
+func updateAlertMetrics(station string, alerts []Alert) {
+	alertActive.DeletePartialMatch(prometheus.Labels{"station": station})
+	for _, alert := range alerts {
+		alertActive.WithLabelValues(station, alert.Event, alert.Severity, alert.Urgency).Inc()
+	}
+	alertCount.WithLabelValues(station).Set(float64(len(alerts)))
+	alertTimes.Set(station, alerts)
+}
+
+// alertTimer exports the times of the active alerts of every station. The
+// remaining time is worked out when the metrics are collected, so it keeps
+// counting down between retrievals of the alerts. It implements
+// DeletePartialMatch like the metric vectors.
+type alertTimer struct {
+	mu     sync.Mutex
+	alerts map[string][]Alert
+
+	onset, expires, ends, remaining *prometheus.Desc
+}
+
+// Set replaces the active alerts of the station.
+func (a *alertTimer) Set(station string, alerts []Alert) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts[station] = alerts
+}
+
+func (a *alertTimer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.onset
+	ch <- a.expires
+	ch <- a.ends
+	ch <- a.remaining
+}
+
+func (a *alertTimer) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for station, alerts := range a.alerts {
+		for _, alert := range alerts {
+			labels := []string{station, alert.ID, alert.Event}
+			if alert.Onset != nil {
+				ch <- prometheus.MustNewConstMetric(a.onset, prometheus.GaugeValue, float64(alert.Onset.Unix()), labels...)
+			}
+			ch <- prometheus.MustNewConstMetric(a.expires, prometheus.GaugeValue, float64(alert.Expires.Unix()), labels...)
+			end := alert.Expires
+			if alert.Ends != nil {
+				end = *alert.Ends
+				ch <- prometheus.MustNewConstMetric(a.ends, prometheus.GaugeValue, float64(end.Unix()), labels...)
+			}
+			remaining := end.Sub(now).Seconds()
+			if remaining < 0 {
+				remaining = 0
+			}
+			ch <- prometheus.MustNewConstMetric(a.remaining, prometheus.GaugeValue, remaining, labels...)
+		}
+	}
+}
+
+// DeletePartialMatch stops exporting the alerts of the station labelled in
+// labels.
+func (a *alertTimer) DeletePartialMatch(labels prometheus.Labels) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := len(a.alerts[labels["station"]])
+	delete(a.alerts, labels["station"])
+	return n
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var aviationAdvisories = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "aviation_advisories",
+		Help: "number of SIGMETs, AIRMETs and center weather advisories in effect over -aviation.region by hazard",
+	},
+	[]string{"type", "hazard"},
+)
+
+func init() {
+	registerGlobalCollector("aviation", false, aviationCollector{}, aviationAdvisories)
+}
+
+// aviationCollector exports the aviation advisories in effect over
+// -aviation.region. The advisories do not belong to a station, so they are
+// retrieved every -aviation.interval on a loop of their own.
+type aviationCollector struct{}
+
+// Interval returns -aviation.interval, read holding configMu.
+func (aviationCollector) Interval() time.Duration {
+	return aviationInterval
+}
+
+func (aviationCollector) UpdateGlobal(ctx context.Context) error {
+	configMu.RLock()
+	regionSpec, addr, t := aviationRegion, aviationAddress, timeout
+	configMu.RUnlock()
+	region, err := ParseRegion(regionSpec)
+	if err != nil {
+		return err
+	}
+	var advisories []AviationAdvisory
+	for _, endpoint := range []string{"airsigmet", "isigmet", "cwa"} {
+		retrieved, err := RetrieveAviationAdvisories(ctx, endpoint, addr, t)
+		if err != nil {
+			return fmt.Errorf("retrieving %s: %w", endpoint, err)
+		}
+		advisories = append(advisories, retrieved...)
+	}
+
+	updateAviationMetrics(advisories, region, time.Now())
+	return nil
+}
+
+// AviationAdvisory is a SIGMET, AIRMET or center weather advisory as returned
+// by the aviation weather center data api.
+type AviationAdvisory struct {
+	// Type is SIGMET, AIRMET or OUTLOOK for domestic advisories, and is empty
+	// for international SIGMETs and center weather advisories.
+	Type   string   `json:"airSigmetType"`
+	Hazard string   `json:"hazard"`
+	From   unixTime `json:"validTimeFrom"`
+	To     unixTime `json:"validTimeTo"`
+	Coords []struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"coords"`
+}
+
+// unixTime decodes a time given either as a unix timestamp or an RFC 3339
+// string.
+type unixTime struct {
+	time.Time
+}
+
+func (t *unixTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+			t.Time = time.Unix(seconds, 0)
+			return nil
+		}
+		parsed, err := time.Parse(time.RFC3339, s)
+		t.Time = parsed
+		return err
+	}
+	var seconds int64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return err
+	}
+	t.Time = time.Unix(seconds, 0)
+	return nil
+}
+
+// RetrieveAviationAdvisories retrieves the advisories of an endpoint of the
+// aviation weather center data api at address: airsigmet for domestic SIGMETs
+// and AIRMETs, isigmet for international SIGMETs and cwa for center weather
+// advisories.
+func RetrieveAviationAdvisories(ctx context.Context, endpoint string, address string, timeout int) ([]AviationAdvisory, error) {
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/api/data/" + endpoint,
+		RawQuery: url.Values{"format": {"json"}}.Encode(),
+	}
+
+	var advisories []AviationAdvisory
+	if _, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &advisories); err != nil {
+		return nil, err
+	}
+	defaultType := map[string]string{"isigmet": "SIGMET", "cwa": "CWA"}[endpoint]
+	for i := range advisories {
+		if advisories[i].Type == "" {
+			advisories[i].Type = defaultType
+		}
+	}
+	return advisories, nil
+}
+
+// Region is an area given by its southern, western, northern and eastern
+// edges in degrees. The zero Region covers everywhere.
+type Region struct {
+	South, West, North, East float64
+}
+
+// ParseRegion parses a region given as "south,west,north,east", or an empty
+// string for everywhere.
+func ParseRegion(region string) (Region, error) {
+	if strings.TrimSpace(region) == "" {
+		return Region{}, nil
+	}
+	parts := strings.Split(region, ",")
+	if len(parts) != 4 {
+		return Region{}, fmt.Errorf("invalid region %q, expected south,west,north,east", region)
+	}
+	var edges [4]float64
+	for i, part := range parts {
+		edge, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Region{}, fmt.Errorf("invalid region %q, expected south,west,north,east", region)
+		}
+		edges[i] = edge
+	}
+	r := Region{South: edges[0], West: edges[1], North: edges[2], East: edges[3]}
+	if r.South >= r.North || r.West >= r.East || r.South < -90 || r.North > 90 || r.West < -180 || r.East > 180 {
+		return Region{}, fmt.Errorf("invalid region %q, expected south,west,north,east", region)
+	}
+	return r, nil
+}
+
+// Overlaps reports whether the bounding box of the advisory's area overlaps
+// the region. Advisories without an area only overlap the zero Region.
+func (r Region) Overlaps(advisory AviationAdvisory) bool {
+	if r == (Region{}) {
+		return true
+	}
+	if len(advisory.Coords) == 0 {
+		return false
+	}
+	box := Region{South: 90, West: 180, North: -90, East: -180}
+	for _, c := range advisory.Coords {
+		box.South = math.Min(box.South, c.Lat)
+		box.North = math.Max(box.North, c.Lat)
+		box.West = math.Min(box.West, c.Lon)
+		box.East = math.Max(box.East, c.Lon)
+	}
+	return box.South <= r.North && box.North >= r.South && box.West <= r.East && box.East >= r.West
+}
+
+// aviationHazards maps the hazards of the aviation advisories to the hazard
+// label. Hazards missing from it are exported as other.
+var aviationHazards = map[string]string{
+	"TURB":       "turbulence",
+	"TURB-HI":    "turbulence",
+	"TURB-LO":    "turbulence",
+	"LLWS":       "wind_shear",
+	"ICE":        "icing",
+	"CONVECTIVE": "convection",
+	"TS":         "convection",
+	"TSGR":       "convection",
+	"IFR":        "ifr",
+	"MTN OBSCN":  "mountain_obscuration",
+	"MT_OBSC":    "mountain_obscuration",
+	"SFC_WND":    "surface_wind",
+	"VA":         "volcanic_ash",
+}
+
+// updateAviationMetrics replaces the advisory series with the counts of the
+// advisories in effect over the region.
+func updateAviationMetrics(advisories []AviationAdvisory, region Region, now time.Time) {
+	aviationAdvisories.Reset()
+	for _, advisory := range advisories {
+		if now.Before(advisory.From.Time) || !now.Before(advisory.To.Time) || !region.Overlaps(advisory) {
+			continue
+		}
+		hazard, ok := aviationHazards[strings.ToUpper(advisory.Hazard)]
+		if !ok {
+			hazard = "other"
+		}
+		aviationAdvisories.WithLabelValues(advisory.Type, hazard).Inc()
+	}
+}
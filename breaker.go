@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var circuitBreakerState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "state of the station's circuit breaker, 0 closed, 1 open and 2 half open",
+	},
+	[]string{"station"},
+)
+
+// The states of a circuit breaker, as exported by nws_circuit_breaker_state.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitOpenError is returned instead of scraping a station while its circuit
+// breaker is open.
+type CircuitOpenError struct {
+	Station string
+	Until   time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.Until.IsZero() {
+		return fmt.Sprintf("circuit breaker of station %s is half open, waiting for the trial scrape", e.Station)
+	}
+	return fmt.Sprintf("circuit breaker of station %s is open for another %v", e.Station, time.Until(e.Until).Round(time.Second))
+}
+
+// circuitBreaker tracks the scrapes of a station. It opens after
+// -circuit-breaker.failures failed scrapes in a row, short-circuiting scrapes
+// for -circuit-breaker.cooldown, then half opens to let a single trial scrape
+// through, which closes it again when it succeeds and reopens it otherwise.
+type circuitBreaker struct {
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// breakers holds the circuit breaker of every station.
+var breakers = struct {
+	sync.Mutex
+	stations map[string]*circuitBreaker
+}{stations: map[string]*circuitBreaker{}}
+
+// allowScrape returns a CircuitOpenError when the station's circuit breaker
+// is open, or half open with its trial scrape under way. Once the cooldown has
+// passed the breaker half opens and the caller's scrape is the trial.
+func allowScrape(station string) error {
+	if circuitBreakerFailures == 0 {
+		return nil
+	}
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.stations[station]
+	if !ok {
+		return nil
+	}
+	switch b.state {
+	case breakerOpen:
+		if until := b.openedAt.Add(circuitBreakerCooldown); time.Now().Before(until) {
+			return &CircuitOpenError{Station: station, Until: until}
+		}
+		b.state = breakerHalfOpen
+		circuitBreakerState.WithLabelValues(station).Set(breakerHalfOpen)
+	case breakerHalfOpen:
+		return &CircuitOpenError{Station: station}
+	}
+	return nil
+}
+
+// recordScrape updates the station's circuit breaker with the result of a
+// scrape allowed by allowScrape.
+func recordScrape(station string, err error) {
+	if circuitBreakerFailures == 0 {
+		return
+	}
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.stations[station]
+	if !ok {
+		b = &circuitBreaker{}
+		breakers.stations[station] = b
+	}
+	if err == nil {
+		b.state, b.failures = breakerClosed, 0
+	} else {
+		b.failures++
+		if b.state == breakerHalfOpen || b.failures >= circuitBreakerFailures {
+			b.state, b.openedAt = breakerOpen, time.Now()
+		}
+	}
+	circuitBreakerState.WithLabelValues(station).Set(float64(b.state))
+}
+
+// forgetBreaker drops the station's circuit breaker.
+func forgetBreaker(station string) {
+	breakers.Lock()
+	defer breakers.Unlock()
+	delete(breakers.stations, station)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(failures int, cooldown time.Duration) {
+		circuitBreakerFailures, circuitBreakerCooldown = failures, cooldown
+	}(circuitBreakerFailures, circuitBreakerCooldown)
+	circuitBreakerFailures, circuitBreakerCooldown = 2, time.Hour
+	const station = "TEST"
+	defer forgetBreaker(station)
+	defer circuitBreakerState.DeleteLabelValues(station)
+	failure := errors.New("failed")
+
+	// expect checks the state of the station's breaker, and whether a scrape
+	// is let through in that state
+	expect := func(step string, state int, allowed bool) {
+		t.Helper()
+		breakers.Lock()
+		got := breakers.stations[station].state
+		breakers.Unlock()
+		if got != state {
+			t.Fatalf("%s: state = %d, want %d", step, got, state)
+		}
+		err := allowScrape(station)
+		var open *CircuitOpenError
+		switch {
+		case allowed && err != nil:
+			t.Fatalf("%s: allowScrape = %v, want the scrape allowed", step, err)
+		case !allowed && !errors.As(err, &open):
+			t.Fatalf("%s: allowScrape = %v, want a CircuitOpenError", step, err)
+		}
+	}
+	cooledDown := func() {
+		breakers.Lock()
+		breakers.stations[station].openedAt = time.Now().Add(-circuitBreakerCooldown)
+		breakers.Unlock()
+	}
+
+	recordScrape(station, failure)
+	expect("after one failure", breakerClosed, true)
+	recordScrape(station, failure)
+	expect("after two failures", breakerOpen, false)
+
+	// once cooled down a single trial scrape is let through, and others
+	// wait for it
+	cooledDown()
+	expect("cooled down", breakerOpen, true)
+	expect("during the trial", breakerHalfOpen, false)
+	recordScrape(station, failure)
+	expect("after a failed trial", breakerOpen, false)
+
+	cooledDown()
+	expect("cooled down again", breakerOpen, true)
+	recordScrape(station, nil)
+	expect("after a successful trial", breakerClosed, true)
+	recordScrape(station, failure)
+	expect("after a failure following the trial", breakerClosed, true)
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	defer func(failures int) { circuitBreakerFailures = failures }(circuitBreakerFailures)
+	circuitBreakerFailures = 0
+	for i := 0; i < 10; i++ {
+		recordScrape("TEST", errors.New("failed"))
+	}
+	if err := allowScrape("TEST"); err != nil {
+		t.Errorf("allowScrape with the breaker disabled = %v, want nil", err)
+	}
+}
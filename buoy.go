@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	buoyWaterTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "buoy_water_temperature_celsius",
+			Help: "sea surface temperature measured by the buoy in celsius",
+		},
+		[]string{"station"},
+	)
+	buoyWaveHeight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "buoy_wave_height_meters",
+			Help: "significant wave height measured by the buoy in meters",
+		},
+		[]string{"station"},
+	)
+	buoyDominantWavePeriod = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "buoy_dominant_wave_period_seconds",
+			Help: "period of the waves with the most energy measured by the buoy in seconds",
+		},
+		[]string{"station"},
+	)
+	buoySwellDirection = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "buoy_swell_direction_degrees",
+			Help: "direction the waves of the dominant period come from measured by the buoy in degrees",
+		},
+		[]string{"station"},
+	)
+	buoyObservationTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "buoy_observation_timestamp_seconds",
+			Help: "time of the latest observation of the buoy as a unix timestamp",
+		},
+		[]string{"station"},
+	)
+)
+
+// buoyColumns maps the columns of the national data buoy center's realtime
+// data to the gauges they are exported by.
+var buoyColumns = map[string]*prometheus.GaugeVec{
+	"WTMP": buoyWaterTemperature,
+	"WVHT": buoyWaveHeight,
+	"DPD":  buoyDominantWavePeriod,
+	"MWD":  buoySwellDirection,
+}
+
+// buoyValueMaxAge is how much older than the buoy's latest observation a
+// measurement may be and still be exported. Waves are measured less often
+// than the weather, so most observations leave them out.
+const buoyValueMaxAge = 2 * time.Hour
+
+func init() {
+	registerCollector("buoy", true, &buoyCollector{},
+		buoyWaterTemperature, buoyWaveHeight, buoyDominantWavePeriod,
+		buoySwellDirection, buoyObservationTimestamp)
+}
+
+// buoyCollector exports the latest observations of the stations of type buoy,
+// retrieved from the national data buoy center at -buoy.address.
+type buoyCollector struct{}
+
+func (*buoyCollector) observes() {}
+
+func (c *buoyCollector) StationType() string {
+	return stationTypeBuoy
+}
+
+func (c *buoyCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	addr, t := buoyAddress, timeout
+	configMu.RUnlock()
+	observations, err := RetrieveBuoyObservations(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	if len(observations) == 0 {
+		return fmt.Errorf("buoy %s has no observations", config.ID)
+	}
+	updateBuoyMetrics(config.ID, observations)
+	return nil
+}
+
+// BuoyObservation is a single line of the realtime data of a buoy. Values
+// holds the measurements by column name, such as WTMP, leaving out those the
+// buoy did not report.
+type BuoyObservation struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// RetrieveBuoyObservations retrieves the realtime data of the last 45 days of
+// a buoy, latest first.
+func RetrieveBuoyObservations(ctx context.Context, buoy string, address string, timeout int) ([]BuoyObservation, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   fmt.Sprintf("/data/realtime2/%s.txt", strings.ToUpper(buoy)),
+	}
+
+	body, err := fetch(ctx, requestURL, timeout, "text/plain")
+	if err != nil {
+		return nil, err
+	}
+	return ParseBuoyObservations(body)
+}
+
+// ParseBuoyObservations parses the realtime standard meteorological data of a
+// buoy: a header naming the columns, a header of their units, and a line of
+// whitespace separated values per observation, with MM for missing values.
+func ParseBuoyObservations(data []byte) ([]BuoyObservation, error) {
+	var columns []string
+	var observations []BuoyObservation
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "#") {
+			if columns == nil {
+				columns = fields
+				columns[0] = strings.TrimPrefix(columns[0], "#")
+			}
+			continue
+		}
+		if len(fields) != len(columns) || len(columns) < 5 {
+			return nil, fmt.Errorf("invalid buoy observation %q", scanner.Text())
+		}
+
+		var date [5]int
+		for i := range date {
+			v, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid buoy observation time %q", strings.Join(fields[:5], " "))
+			}
+			date[i] = v
+		}
+		observation := BuoyObservation{
+			Time:   time.Date(date[0], time.Month(date[1]), date[2], date[3], date[4], 0, 0, time.UTC),
+			Values: map[string]float64{},
+		}
+		for i := 5; i < len(fields); i++ {
+			if v, err := strconv.ParseFloat(fields[i], 64); err == nil {
+				observation.Values[columns[i]] = v
+			}
+		}
+		observations = append(observations, observation)
+	}
+	return observations, scanner.Err()
+}
+
+// latestBuoyValue returns the latest measurement of the column that is at most
+// buoyValueMaxAge older than the latest observation, reporting whether there
+// is one.
+func latestBuoyValue(observations []BuoyObservation, column string) (float64, bool) {
+	for _, observation := range observations {
+		if observations[0].Time.Sub(observation.Time) > buoyValueMaxAge {
+			break
+		}
+		if v, ok := observation.Values[column]; ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// updateBuoyMetrics sets the buoy's series to its latest measurements, deleting
+// those of measurements it has not reported lately.
+func updateBuoyMetrics(buoy string, observations []BuoyObservation) {
+	buoyObservationTimestamp.WithLabelValues(buoy).Set(float64(observations[0].Time.Unix()))
+	for column, gauge := range buoyColumns {
+		if v, ok := latestBuoyValue(observations, column); ok {
+			gauge.WithLabelValues(buoy).Set(v)
+		} else {
+			gauge.DeleteLabelValues(buoy)
+		}
+	}
+}
+
+// ValidateBuoy checks that the buoy exists and has reported an observation
+// within maxAge.
+func ValidateBuoy(ctx context.Context, buoy string, maxAge time.Duration) error {
+	observations, err := RetrieveBuoyObservations(ctx, buoy, buoyAddress, timeout)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("buoy %s does not exist", buoy)
+		}
+		return fmt.Errorf("retrieving observations of buoy %s: %w", buoy, err)
+	}
+	if len(observations) == 0 {
+		return fmt.Errorf("buoy %s has not reported any observations", buoy)
+	}
+	if age := time.Since(observations[0].Time); age > maxAge {
+		return fmt.Errorf("buoy %s has not reported an observation in %v", buoy, age.Round(time.Minute))
+	}
+	return nil
+}
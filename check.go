@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// CheckFlags returns every problem with the values of the flags, after the
+// environment and config file have been applied.
+func CheckFlags() []error {
+	var errs []error
+	if timeout <= 0 {
+		errs = append(errs, errors.New("-timeout must be positive"))
+	}
+	if backofftime <= 0 {
+		errs = append(errs, errors.New("-backofftime must be positive"))
+	}
+	if scrapeInterval <= 0 || errorBackoff <= 0 {
+		errs = append(errs, errors.New("-scrape-interval and -error-backoff must be positive"))
+	}
+	if errorBackoffMultiplier < 1 {
+		errs = append(errs, errors.New("-error-backoff.multiplier must be at least 1"))
+	}
+	if errorBackoffMax < errorBackoffDuration() {
+		errs = append(errs, errors.New("-error-backoff.max must not be less than -error-backoff"))
+	}
+	if errorBackoffJitter < 0 || errorBackoffJitter >= 1 {
+		errs = append(errs, errors.New("-error-backoff.jitter must be in [0, 1)"))
+	}
+	if circuitBreakerFailures < 0 || circuitBreakerCooldown <= 0 {
+		errs = append(errs, errors.New("-circuit-breaker.failures must not be negative and -circuit-breaker.cooldown must be positive"))
+	}
+	if degradedAfter < 1 {
+		errs = append(errs, errors.New("-degraded-after must be at least 1"))
+	}
+	if staleAfter < 0 {
+		errs = append(errs, errors.New("-stale-after must not be negative"))
+	}
+	if jitter < 0 || jitter >= 1 {
+		errs = append(errs, errors.New("-jitter must be in [0, 1)"))
+	}
+	if maxConcurrentFetches < 0 {
+		errs = append(errs, errors.New("-max-concurrent-fetches must not be negative"))
+	}
+	if requestsPerMinute < 0 || requestsBurst < 1 {
+		errs = append(errs, errors.New("-requests-per-minute must not be negative and -requests-burst must be at least 1"))
+	}
+	if requestRetries < 0 || requestRetryDelay < 0 {
+		errs = append(errs, errors.New("-request-retries and -request-retries.delay must not be negative"))
+	}
+	if unitSystem != "metric" && unitSystem != "imperial" && unitSystem != "both" {
+		errs = append(errs, errors.New("-units must be metric, imperial or both"))
+	}
+	switch windCardinalPoints {
+	case 0, 4, 8, 16:
+	default:
+		errs = append(errs, errors.New("-wind.cardinal-points must be 0, 4, 8 or 16"))
+	}
+	if gddCap <= gddBase {
+		errs = append(errs, errors.New("-gdd.cap must be above -gdd.base"))
+	}
+	if forecastInterval <= 0 {
+		errs = append(errs, errors.New("-forecast.interval must be positive"))
+	}
+	if forecastHours < 1 || forecastHours > 156 {
+		errs = append(errs, errors.New("-forecast.hours must be between 1 and 156"))
+	}
+	if _, err := selectedGridpointElements(); err != nil {
+		errs = append(errs, fmt.Errorf("-gridpoint.elements: %w", err))
+	}
+	if alertsInterval <= 0 {
+		errs = append(errs, errors.New("-alerts.interval must be positive"))
+	}
+	if _, err := ParseAlertZones(alertZones); alertZones != "auto" && err != nil {
+		errs = append(errs, fmt.Errorf("-alerts.zone: %w", err))
+	}
+	if alertsWebhookURL != "" {
+		if u, err := url.Parse(alertsWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, errors.New("-alerts.webhook-url must be an http or https url"))
+		}
+	}
+	if alertsWebhookRetries < 0 {
+		errs = append(errs, errors.New("-alerts.webhook-retries must not be negative"))
+	}
+	if alertmanagerURL != "" {
+		if u, err := url.Parse(alertmanagerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, errors.New("-alertmanager.url must be an http or https url"))
+		}
+	}
+	if _, err := ParseAlertFieldMapping(alertmanagerLabels); err != nil {
+		errs = append(errs, fmt.Errorf("-alertmanager.labels: %w", err))
+	}
+	if _, err := ParseAlertFieldMapping(alertmanagerAnnotations); err != nil {
+		errs = append(errs, fmt.Errorf("-alertmanager.annotations: %w", err))
+	}
+	if _, err := ParseRegion(aviationRegion); err != nil {
+		errs = append(errs, fmt.Errorf("-aviation.region: %w", err))
+	}
+	if aviationInterval <= 0 {
+		errs = append(errs, errors.New("-aviation.interval must be positive"))
+	}
+	if _, err := ParseAlertZones(marineZones); err != nil {
+		errs = append(errs, fmt.Errorf("-marine.zone: %w", err))
+	}
+	if _, err := ParseRiverGauges(riverGauges); err != nil {
+		errs = append(errs, fmt.Errorf("-river.gauges: %w", err))
+	}
+	if riverInterval <= 0 {
+		errs = append(errs, errors.New("-river.interval must be positive"))
+	}
+	if tidesInterval <= 0 {
+		errs = append(errs, errors.New("-tides.interval must be positive"))
+	}
+	if spcInterval <= 0 {
+		errs = append(errs, errors.New("-spc.interval must be positive"))
+	}
+	if tropicalInterval <= 0 {
+		errs = append(errs, errors.New("-tropical.interval must be positive"))
+	}
+	if airnowInterval <= 0 {
+		errs = append(errs, errors.New("-airnow.interval must be positive"))
+	}
+	if productsInterval <= 0 {
+		errs = append(errs, errors.New("-products.interval must be positive"))
+	}
+	if nearest < 1 {
+		errs = append(errs, errors.New("-nearest must be at least 1"))
+	}
+	if nearest > 1 && latlon == "" {
+		errs = append(errs, errors.New("-nearest requires -latlon"))
+	}
+	if latlon != "" {
+		if _, _, err := ParseLatLon(latlon); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if stationsFilePoll <= 0 {
+		errs = append(errs, errors.New("-stations-file-poll must be positive"))
+	}
+	if namespace != "" && !metricNameRE.MatchString(namespace) {
+		errs = append(errs, fmt.Errorf("-namespace %q is not a valid metric name prefix", namespace))
+	}
+	if _, err := compileMetricFilter(metricsInclude); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -metrics.include: %w", err))
+	}
+	if _, err := compileMetricFilter(metricsExclude); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -metrics.exclude: %w", err))
+	}
+	if !strings.HasPrefix(telemetryPath, "/") {
+		errs = append(errs, fmt.Errorf("-web.telemetry-path %q must start with /", telemetryPath))
+	}
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		errs = append(errs, errors.New("-tls.cert-file and -tls.key-file must be given together"))
+	}
+	if systemdSocket && (tlsCertFile != "" || tlsKeyFile != "") {
+		errs = append(errs, errors.New("-web.systemd-socket cannot be used with -tls.cert-file, use -web.config.file to serve HTTPS"))
+	}
+	if debugAddress != "" && !enableDebug {
+		errs = append(errs, errors.New("-web.debug-address requires -web.enable-debug"))
+	}
+	if webConfigFile != "" && (tlsCertFile != "" || tlsKeyFile != "") {
+		errs = append(errs, errors.New("-web.config.file cannot be used with -tls.cert-file and -tls.key-file"))
+	}
+	return errs
+}
+
+// Check validates the configuration without starting the exporter, printing
+// every problem found, and returns the exit code for the check subcommand:
+// 0 when the configuration is valid and 1 otherwise.
+//
+// Beyond CheckFlags it verifies that the stations resolve with the nws api,
+// that station intervals are sane, and that the TLS files and -web.config.file
+// can be loaded.
+func Check() int {
+	var errs []error
+	if err := LoadEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	RecordExplicitFlags()
+	if configFile != "" {
+		if err := LoadConfig(configFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, CheckFlags()...)
+
+	if tlsCertFile != "" && tlsKeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("loading TLS certificate: %w", err))
+		}
+	}
+	if err := web.Validate(webConfigFile); err != nil {
+		errs = append(errs, fmt.Errorf("-web.config.file: %w", err))
+	}
+
+	ctx := context.Background()
+	var configs []StationConfig
+	var err error
+	switch {
+	case latlon != "":
+		// the station is only known once resolved, which checks the location
+		_, err = NearestStations(ctx, latlon, nearest, address, timeout)
+	case stationsFile != "":
+		configs, err = ReadStationsFile(stationsFile)
+	default:
+		configs, err = stationList()
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, config := range configs {
+		if config.Interval > 0 && config.Interval < time.Minute {
+			errs = append(errs, fmt.Errorf("interval %v of station %s is below the minimum of 1m", config.Interval, config.ID))
+		}
+		if config.Type == stationTypeBuoy {
+			if _, err := RetrieveBuoyObservations(ctx, config.ID, buoyAddress, timeout); err != nil {
+				errs = append(errs, fmt.Errorf("resolving buoy %s: %w", config.ID, err))
+			}
+		} else if _, err := RetrieveStation(ctx, config.ID, address, timeout); err != nil {
+			errs = append(errs, fmt.Errorf("resolving station %s: %w", config.ID, err))
+		}
+	}
+
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	if len(errs) != 0 {
+		return 1
+	}
+	fmt.Println("configuration is valid")
+	return 0
+}
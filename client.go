@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fetchSlots bounds the number of requests to the national weather service
+// api in flight at once, a slot is taken for the duration of every request to
+// an -addr host. It is nil when the number of requests is unbounded.
+var fetchSlots chan struct{}
+
+// limiter caps the rate of requests to the national weather service api
+// across every station, other services being left to limit their own. It is
+// nil when the rate is unlimited.
+var limiter *RateLimiter
+
+// RateLimiter is a token bucket allowing Rate requests per second on average
+// with bursts of up to Burst requests.
+type RateLimiter struct {
+	Rate  float64
+	Burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing perMinute requests a minute,
+// starting with a full bucket.
+func NewRateLimiter(perMinute float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		Rate:   perMinute / 60,
+		Burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made, or returns the error of ctx once
+// it is done. Tokens are reserved in the order Wait is called, so waiting
+// callers are served first come first served, and the token of a caller that
+// gives up waiting is handed back.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.Rate
+	if l.tokens > l.Burst {
+		l.tokens = l.Burst
+	}
+	l.last = now
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.Rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if !sleep(ctx, wait, nil) {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+	return nil
+}
+
+// StatusError is returned when the national weather service responds with a
+// status other than 200. RetryAfter is the delay asked for by the Retry-After
+// header of a 429 or 503 response, 0 otherwise.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("err: %d, %s", e.StatusCode, e.Body)
+}
+
+// retrieve performs a GET request for the given national weather service url
+// and decodes the json body into v, returning the raw body alongside it.
+func retrieve(ctx context.Context, requestURL url.URL, timeout int, v any) ([]byte, error) {
+	return retrieveJSON(ctx, requestURL, timeout, "application/geo+json", v)
+}
+
+// retrieveJSON is retrieve for the json apis of other services, accepting the
+// media type they serve.
+func retrieveJSON(ctx context.Context, requestURL url.URL, timeout int, accept string, v any) ([]byte, error) {
+	body, err := fetch(ctx, requestURL, timeout, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// scrapeResponsesKey is the context key of the scrapeResponses of a scrape.
+type scrapeResponsesKey struct{}
+
+// scrapeResponses are the responses to the requests made during a scrape of a
+// station, by media type and url, so that collectors retrieving the same
+// resource, such as the gridpoint and fire weather collectors both retrieving
+// the station's forecast grid, share a single request.
+type scrapeResponses struct {
+	mu        sync.Mutex
+	responses map[string]scrapeResponse
+}
+
+type scrapeResponse struct {
+	body []byte
+	err  error
+}
+
+// withScrapeResponses returns a context under which fetch makes each request
+// once, later requests for the same resource getting the same response.
+func withScrapeResponses(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scrapeResponsesKey{}, &scrapeResponses{responses: map[string]scrapeResponse{}})
+}
+
+// fetch performs a GET request for url accepting the given media type and
+// returns the body, or the response already fetched during the scrape when ctx
+// is a scrape's.
+func fetch(ctx context.Context, requestURL url.URL, timeout int, accept string) ([]byte, error) {
+	shared, ok := ctx.Value(scrapeResponsesKey{}).(*scrapeResponses)
+	if !ok {
+		return fetchFailingOver(ctx, requestURL, timeout, accept)
+	}
+	key := accept + " " + requestURL.String()
+	// the collectors of a scrape run one at a time, so holding the lock
+	// across the request holds up no one
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if response, ok := shared.responses[key]; ok {
+		return response.body, response.err
+	}
+	body, err := fetchFailingOver(ctx, requestURL, timeout, accept)
+	shared.responses[key] = scrapeResponse{body, err}
+	return body, err
+}
+
+// fetchFailingOver makes the request for fetch. Requests to the first -addr
+// host that fail on it are made to each further host in turn, until one
+// succeeds or fails in a way every host would. The request, and any wait
+// before it, is aborted once ctx is cancelled or the exporter shuts down.
+func fetchFailingOver(ctx context.Context, requestURL url.URL, timeout int, accept string) ([]byte, error) {
+	ctx, cancel := withUpstream(ctx)
+	defer cancel()
+
+	// the flags are read up front, as configMu is not held while waiting on
+	// the request
+	configMu.RLock()
+	hosts, allHosts := apiHosts(requestURL.Host), addresses.Hosts()
+	retries, retryDelay := requestRetries, requestRetryDelay
+	configMu.RUnlock()
+
+	var err error
+	for _, host := range hosts {
+		requestURL.Host = host
+		var body []byte
+		body, err = fetchRetrying(ctx, requestURL, timeout, accept, retries, retryDelay, isAPIHost(host, allHosts))
+		if err == nil {
+			recordActiveHost(host, allHosts)
+			return body, nil
+		}
+		if !failover(err) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// fetchRetrying makes a request for fetchFailingOver to a single host, counting against
+// fetchSlots and limiter when limited. Requests failing with a 5xx status, a
+// timeout or a refused connection are retried up to retries times, as
+// -request-retries, waiting delay, as -request-retries.delay, before the first
+// retry and twice as long before each further one, as most such failures of
+// the api are one-off. 5xx responses with a Retry-After header are not
+// retried.
+func fetchRetrying(ctx context.Context, requestURL url.URL, timeout int, accept string, retries int, delay time.Duration, limited bool) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := fetchOnce(ctx, requestURL, timeout, accept, limited)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return body, err
+		}
+		requestRetriesTotal.WithLabelValues(requestURL.Host, endpoint(requestURL.Path)).Inc()
+		if !sleep(ctx, delay, nil) {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether a failed request is worth retrying straight away.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return false
+	}
+	switch classifyError(err) {
+	case "http_5xx", "timeout", "connect":
+		return true
+	}
+	return false
+}
+
+// fetchOnce makes a single request for fetchRetrying.
+func fetchOnce(ctx context.Context, requestURL url.URL, timeout int, accept string, limited bool) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkHeld(requestURL.Host); err != nil {
+		return nil, err
+	}
+	if limiter != nil && limited {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if fetchSlots != nil && limited {
+		select {
+		case fetchSlots <- struct{}{}:
+			defer func() { <-fetchSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	client := http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Accept", accept)
+
+	// failed requests are observed too, a timeout being the slowest request
+	start := time.Now()
+	requestEndpoint := endpoint(requestURL.Path)
+	observe := requestDuration.WithLabelValues(requestURL.Host, requestEndpoint).Observe
+	resp, err := client.Do(req)
+	if err != nil {
+		observe(time.Since(start).Seconds())
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	apiResponses.WithLabelValues(requestURL.Host, strconv.Itoa(resp.StatusCode)).Inc()
+	body, err := ioutil.ReadAll(resp.Body)
+	observe(time.Since(start).Seconds())
+	responseBytes.WithLabelValues(requestURL.Host, requestEndpoint).Add(float64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	retryAfter := recordRetryAfter(requestURL.Host, resp)
+	if resp.StatusCode != 200 {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body), RetryAfter: retryAfter}
+	}
+
+	atomic.StoreInt32(&fetched, 1)
+	return body, nil
+}
+
+// endpoint returns the path of an upstream request with the ids of stations,
+// offices, zones and the like replaced by {id}, so that requests for every
+// station share a single endpoint. A path segment is taken to be an id when,
+// leaving out its extension, it has no lower case letters, as in
+// /stations/KPHL/observations/latest or /points/39.8680,-75.2312.
+func endpoint(requestPath string) string {
+	segments := strings.Split(requestPath, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		name := strings.TrimSuffix(segment, path.Ext(segment))
+		if name == "" || strings.ToUpper(name) == name {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
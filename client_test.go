@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEndpoint(t *testing.T) {
+	// the request duration histogram is labelled by endpoint, so the ids in
+	// a path must not add a series per station, zone or office
+	endpoints := map[string]string{
+		"/stations/KPHL/observations/latest":    "/stations/{id}/observations/latest",
+		"/points/39.8680,-75.2312":              "/points/{id}",
+		"/products/types/AFD/locations/PHI":     "/products/types/{id}/locations/{id}",
+		"/zones/forecast/PAZ106/forecast":       "/zones/forecast/{id}/forecast",
+		"/gridpoints/PHI/49,75/forecast/hourly": "/gridpoints/{id}/{id}/forecast/hourly",
+		"/alerts/active":                        "/alerts/active",
+		"/":                                     "/",
+		"":                                      "",
+	}
+	for path, want := range endpoints {
+		if got := endpoint(path); got != want {
+			t.Errorf("endpoint(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	retried := []error{
+		&StatusError{StatusCode: 503},
+		context.DeadlineExceeded,
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+	}
+	for _, err := range retried {
+		if !retryable(err) {
+			t.Errorf("retryable(%v) = false, want the request retried", err)
+		}
+	}
+
+	// hosts asking to be left alone, and failures a retry will not fix, are
+	// not retried within the scrape
+	notRetried := []error{
+		&StatusError{StatusCode: 503, RetryAfter: time.Minute},
+		&StatusError{StatusCode: 429, RetryAfter: time.Minute},
+		&StatusError{StatusCode: 404},
+		&net.DNSError{Err: "no such host", Name: "api.weather.gov"},
+		&RetryAfterError{Host: "api.weather.gov", Until: time.Now().Add(time.Minute)},
+		context.Canceled,
+	}
+	for _, err := range notRetried {
+		if retryable(err) {
+			t.Errorf("retryable(%v) = true, want the request not retried", err)
+		}
+	}
+}
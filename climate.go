@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	climateNormalTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "climate_normal_temperature_celsius",
+			Help: "1991-2020 normal mean, maximum and minimum temperature of today at the station's normals station in celsius",
+		},
+		[]string{"station", "statistic"},
+	)
+	climateNormalPrecipitation = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "climate_normal_precipitation_meters",
+			Help: "1991-2020 normal precipitation of today at the station's normals station in meters",
+		},
+		[]string{"station"},
+	)
+	climateTemperatureDeparture = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "climate_temperature_departure_celsius",
+			Help: "latest observed temperature minus the normal mean temperature of the day in celsius",
+		},
+		[]string{"station"},
+	)
+	climatePrecipitationDeparture = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "climate_precipitation_departure_meters",
+			Help: "precipitation since local midnight minus the normal precipitation of the day in meters",
+		},
+		[]string{"station"},
+	)
+)
+
+// normalsInterval is the time between retrievals of the normals of a station.
+// The normals do not change, but are retrieved again in case the first
+// retrieval was incomplete.
+const normalsInterval = 24 * time.Hour
+
+func init() {
+	registerCollector("normals", false, &normalsCollector{},
+		climateNormalTemperature, climateNormalPrecipitation,
+		climateTemperatureDeparture, climatePrecipitationDeparture)
+}
+
+// normalsCollector exports the climate normals of the stations given a normals
+// station in the -config file, retrieved from the national centers for
+// environmental information at -normals.address. The departures from the
+// normals are worked out by updateClimateDepartures from every observation.
+type normalsCollector struct {
+	refreshTracker
+}
+
+func (c *normalsCollector) Update(ctx context.Context, config StationConfig) error {
+	if config.NormalsStation == "" {
+		return nil
+	}
+	if c.Due(config.ID, normalsInterval) {
+		configMu.RLock()
+		addr, t := normalsAddress, timeout
+		configMu.RUnlock()
+		normals, err := RetrieveDailyNormals(ctx, config.NormalsStation, addr, t)
+		if err != nil {
+			return fmt.Errorf("retrieving normals of %s: %w", config.NormalsStation, err)
+		}
+		stationNormals.Lock()
+		stationNormals.days[config.ID] = normals
+		stationNormals.Unlock()
+		c.Done(config.ID)
+	}
+
+	labels := prometheus.Labels{"station": config.ID}
+	climateNormalTemperature.DeletePartialMatch(labels)
+	climateNormalPrecipitation.DeletePartialMatch(labels)
+	normal, ok := normalsOf(config.ID, time.Now())
+	if !ok {
+		return nil
+	}
+	for statistic, v := range map[string]*float64{"mean": normal.Mean, "max": normal.Max, "min": normal.Min} {
+		if v != nil {
+			climateNormalTemperature.WithLabelValues(config.ID, statistic).Set(*v)
+		}
+	}
+	if normal.Precipitation != nil {
+		climateNormalPrecipitation.WithLabelValues(config.ID).Set(*normal.Precipitation)
+	}
+	return nil
+}
+
+// Forget also drops the normals kept for the station.
+func (c *normalsCollector) Forget(station string) {
+	c.refreshTracker.Forget(station)
+	stationNormals.Lock()
+	defer stationNormals.Unlock()
+	delete(stationNormals.days, station)
+}
+
+var normalsStationRE = regexp.MustCompile(`^[A-Z0-9]{11}$`)
+
+// ValidateNormalsStation checks that id is an eleven character global
+// historical climatology network station id, such as USW00013739.
+func ValidateNormalsStation(id string) error {
+	if !normalsStationRE.MatchString(id) {
+		return fmt.Errorf("invalid normals station id %q", id)
+	}
+	return nil
+}
+
+// DailyNormals are the normals of a day of the year. Temperatures are in
+// celsius and the precipitation in meters, values the normals station does
+// not have are nil.
+type DailyNormals struct {
+	Mean, Max, Min *float64
+	Precipitation  *float64
+}
+
+// stationNormals holds the normals of every station, keyed by day of the year
+// as MM-DD.
+var stationNormals = struct {
+	sync.Mutex
+	days map[string]map[string]DailyNormals
+}{days: map[string]map[string]DailyNormals{}}
+
+// normalsOf returns the station's normals of the local day of t. The normals
+// of February 28th are used on leap days when there are none of the 29th.
+func normalsOf(station string, t time.Time) (DailyNormals, bool) {
+	day := t.In(time.Local).Format("01-02")
+	stationNormals.Lock()
+	defer stationNormals.Unlock()
+	days := stationNormals.days[station]
+	normal, ok := days[day]
+	if !ok && day == "02-29" {
+		normal, ok = days["02-28"]
+	}
+	return normal, ok
+}
+
+// RetrieveDailyNormals retrieves the 1991-2020 daily normals of a normals
+// station, keyed by day of the year as MM-DD.
+func RetrieveDailyNormals(ctx context.Context, station string, address string, timeout int) (map[string]DailyNormals, error) {
+	query := url.Values{
+		"dataset":   {"normals-daily-1991-2020"},
+		"stations":  {station},
+		"dataTypes": {"DLY-TAVG-NORMAL,DLY-TMAX-NORMAL,DLY-TMIN-NORMAL,MTD-PRCP-NORMAL"},
+		"startDate": {"0001-01-01"},
+		"endDate":   {"9996-12-31"},
+		"units":     {"metric"},
+		"format":    {"json"},
+	}
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/access/services/data/v1",
+		RawQuery: query.Encode(),
+	}
+
+	var rows []map[string]any
+	if _, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &rows); err != nil {
+		return nil, err
+	}
+	return ParseDailyNormals(rows), nil
+}
+
+// ParseDailyNormals parses the rows of daily normals returned by the
+// national centers for environmental information. Precipitation is given
+// month to date in millimeters, so the precipitation of a day is worked out
+// from that of the day before.
+func ParseDailyNormals(rows []map[string]any) map[string]DailyNormals {
+	normals := map[string]DailyNormals{}
+	monthToDate := map[string]float64{}
+	for _, row := range rows {
+		day := strings.TrimSpace(fmt.Sprint(row["DATE"]))
+		if _, err := time.Parse("01-02", day); err != nil {
+			continue
+		}
+		normals[day] = DailyNormals{
+			Mean: normalValue(row["DLY-TAVG-NORMAL"]),
+			Max:  normalValue(row["DLY-TMAX-NORMAL"]),
+			Min:  normalValue(row["DLY-TMIN-NORMAL"]),
+		}
+		if mtd := normalValue(row["MTD-PRCP-NORMAL"]); mtd != nil {
+			monthToDate[day] = *mtd
+		}
+	}
+
+	for day, mtd := range monthToDate {
+		t, _ := time.Parse("01-02", day)
+		daily := mtd
+		if t.Day() != 1 {
+			previous, ok := monthToDate[t.AddDate(0, 0, -1).Format("01-02")]
+			if !ok {
+				continue
+			}
+			daily -= previous
+		}
+		meters := daily / 1000
+		normal := normals[day]
+		normal.Precipitation = &meters
+		normals[day] = normal
+	}
+	return normals
+}
+
+// normalValue parses a value of the normals, which are given as strings or
+// numbers. Trace amounts, -7777, are zero, and other negative flags such as
+// -9999 are missing.
+func normalValue(raw any) *float64 {
+	if raw == nil {
+		return nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(raw)), 64)
+	if err != nil {
+		return nil
+	}
+	switch {
+	case v == -7777:
+		v = 0
+	case v <= -6666:
+		return nil
+	}
+	return &v
+}
+
+// updateClimateDepartures sets the station's departures from its normals from
+// an observation. Departures are removed when the station has no normals or
+// the observation lacks the values they need.
+func updateClimateDepartures(station string, response ObservationResponse) {
+	observed := response.Properties.Timestamp
+	normal, hasNormal := normalsOf(station, observed)
+
+	t, hasT := value(response.Properties.Temperature)
+	if hasNormal && hasT && normal.Mean != nil {
+		climateTemperatureDeparture.WithLabelValues(station).Set(t - *normal.Mean)
+	} else {
+		climateTemperatureDeparture.DeleteLabelValues(station)
+	}
+
+	today, hasToday := totals.Today(station, "precipitation_total_meters", observed)
+	if hasNormal && hasToday && normal.Precipitation != nil {
+		climatePrecipitationDeparture.WithLabelValues(station).Set(today - *normal.Precipitation)
+	} else {
+		climatePrecipitationDeparture.DeleteLabelValues(station)
+	}
+}
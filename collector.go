@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Collector fetches one family of nws data for a station and updates the
+// station's series.
+type Collector interface {
+	Update(ctx context.Context, config StationConfig) error
+}
+
+// globalCollector fetches nws data that belongs to no station, such as the
+// aviation advisories, every Interval.
+type globalCollector interface {
+	UpdateGlobal(ctx context.Context) error
+	Interval() time.Duration
+}
+
+// registeredCollector is a Collector, or a globalCollector, along with the flag
+// enabling it and the metrics it exports.
+type registeredCollector struct {
+	name      string
+	enabled   *bool
+	collector Collector
+	global    globalCollector
+	metrics   []prometheus.Collector
+}
+
+// collectors are every collector, in the order they were registered.
+var collectors []*registeredCollector
+
+// registerCollector makes collector available behind a -collector.<name> flag.
+// The collector's metrics are only registered when it is enabled. It must be
+// called from an init function so the flag exists when flags are parsed.
+func registerCollector(name string, enabledByDefault bool, collector Collector, metrics ...prometheus.Collector) {
+	c := &registeredCollector{name: name, collector: collector, metrics: metrics, enabled: new(bool)}
+	help := fmt.Sprintf("enable the %s collector", name)
+	flag.BoolVar(c.enabled, "collector."+name, enabledByDefault, help)
+	collectors = append(collectors, c)
+}
+
+// registerGlobalCollector makes collector available behind a
+// -collector.<name> flag like registerCollector. Rather than in the scrape of
+// every station, the collector runs on a loop of its own started by
+// startGlobalCollectors, and its failures are not charged to any station.
+func registerGlobalCollector(name string, enabledByDefault bool, collector globalCollector, metrics ...prometheus.Collector) {
+	c := &registeredCollector{name: name, global: collector, metrics: metrics, enabled: new(bool)}
+	help := fmt.Sprintf("enable the %s collector", name)
+	flag.BoolVar(c.enabled, "collector."+name, enabledByDefault, help)
+	collectors = append(collectors, c)
+}
+
+// startGlobalCollectors starts the loop of every enabled global collector,
+// which runs until ctx is cancelled.
+func startGlobalCollectors(ctx context.Context) {
+	for _, c := range enabledCollectors() {
+		if c.global != nil {
+			go runGlobalCollector(ctx, c)
+		}
+	}
+}
+
+// runGlobalCollector runs the global collector every interval, or sooner after
+// a failure, backing off like a failing station.
+func runGlobalCollector(ctx context.Context, c *registeredCollector) {
+	failures := 0
+	for {
+		err := c.global.UpdateGlobal(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		configMu.RLock()
+		wait := c.global.Interval()
+		if err != nil {
+			failures++
+			if backoff := backoffDuration(failures); backoff < wait {
+				wait = backoff
+			}
+			collectorErrors.WithLabelValues(c.name, classifyError(err)).Inc()
+			collectorUp.WithLabelValues(c.name).Set(0)
+			log.Printf("Problem running the %s collector (%d consecutive failures): %s", c.name, failures, err)
+		} else {
+			failures = 0
+			collectorUp.WithLabelValues(c.name).Set(1)
+		}
+		configMu.RUnlock()
+
+		if !sleep(ctx, wait, nil) {
+			return
+		}
+	}
+}
+
+// enabledCollectors returns the collectors enabled by their flags.
+func enabledCollectors() []*registeredCollector {
+	var enabled []*registeredCollector
+	for _, c := range collectors {
+		if *c.enabled {
+			enabled = append(enabled, c)
+		}
+	}
+	return enabled
+}
+
+// refreshTracker records when a collector last refreshed each station, for
+// collectors of data that changes less often than stations are scraped.
+type refreshTracker struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// Due reports whether the station was last refreshed at least interval ago,
+// or has never been refreshed.
+func (r *refreshTracker) Due(station string, interval time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last, ok := r.last[station]
+	return !ok || time.Since(last) >= interval
+}
+
+// Claim reports whether the key is due like Due, and when it is records it as
+// refreshed straight away, so that scrapes of other stations sharing the key
+// do not refresh it too while it is being refreshed. A failed refresh is
+// forgotten with Forget, so it is retried.
+func (r *refreshTracker) Claim(key string, interval time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last, ok := r.last[key]
+	if ok && time.Since(last) < interval {
+		return false
+	}
+	if r.last == nil {
+		r.last = map[string]time.Time{}
+	}
+	r.last[key] = time.Now()
+	return true
+}
+
+// Forget forgets when the station was refreshed, so it is refreshed on the
+// next scrape.
+func (r *refreshTracker) Forget(station string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.last, station)
+}
+
+// Done records a successful refresh of the station.
+func (r *refreshTracker) Done(station string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		r.last = map[string]time.Time{}
+	}
+	r.last[station] = time.Now()
+}
+
+// registerer registers every metric of the exporter, prefixing their names
+// with -namespace. It is set up by registerMetrics.
+var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+
+// registerMetrics registers the exporter's own metrics along with those of
+// every enabled collector, leaving out those not exported in -units or
+// filtered out by -metrics.include and -metrics.exclude. With
+// -web.disable-exporter-metrics the go runtime and process metrics registered
+// by default are unregistered.
+func registerMetrics() error {
+	filter, err := metricFilter()
+	if err != nil {
+		return err
+	}
+	if disableExporterMetrics {
+		prometheus.Unregister(promcollectors.NewGoCollector())
+		prometheus.Unregister(promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}))
+	}
+	if len(constLabels) != 0 {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels(constLabels), registerer)
+	}
+	if namespace != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(namespace+"_", registerer)
+	}
+
+	metrics := []prometheus.Collector{nearestRank, stationInfo, stationBackingOff, stationBackoff, consecutiveFailures, stationDegraded, scrapeRetries, stationUp, lastSuccessfulScrape, scrapeDuration, scrapeErrors, scrapeCollectorSuccess, collectorUp, collectorErrors, requestDuration, apiResponses, responseBytes, requestRetriesTotal, retryAfterDelay, upstreamActiveHost, circuitBreakerState, buildInfo, configReloadSuccessful, configReloadTimestamp}
+	for _, c := range enabledCollectors() {
+		metrics = append(metrics, c.metrics...)
+	}
+	for _, metric := range metrics {
+		if !exportedInUnits(metric) || (filter != nil && !filter.keepsAny(metric)) {
+			continue
+		}
+		if err := registerer.Register(metric); err != nil {
+			return fmt.Errorf("registering metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// partialDeleter is implemented by every metric vector.
+type partialDeleter interface {
+	DeletePartialMatch(labels prometheus.Labels) int
+}
+
+// forgetter is implemented by collectors keeping state about each station,
+// which is dropped along with the station's series.
+type forgetter interface {
+	Forget(station string)
+}
+
+// deleteMetrics removes every series belonging to station.
+func deleteMetrics(station string) {
+	forgetBreaker(station)
+	labels := prometheus.Labels{"station": station}
+	metrics := []prometheus.Collector{nearestRank, stationInfo, stationBackingOff, stationBackoff, consecutiveFailures, stationDegraded, scrapeRetries, stationUp, lastSuccessfulScrape, scrapeDuration, scrapeErrors, scrapeCollectorSuccess, circuitBreakerState}
+	for _, c := range collectors {
+		metrics = append(metrics, c.metrics...)
+		if f, ok := c.collector.(forgetter); ok {
+			f.Forget(station)
+		}
+	}
+	for _, metric := range metrics {
+		if vec, ok := metric.(partialDeleter); ok {
+			vec.DeletePartialMatch(labels)
+		}
+	}
+}
+
+// remover is implemented by collectors keeping state about each station that
+// outlives restarts of its scrape loop, which is only dropped once the station
+// is no longer scraped.
+type remover interface {
+	Remove(station string)
+}
+
+// removeStation deletes the series of a station that is no longer scraped,
+// along with the state kept across restarts of its scrape loop.
+func removeStation(station string) {
+	deleteMetrics(station)
+	for _, c := range collectors {
+		if r, ok := c.collector.(remover); ok {
+			r.Remove(station)
+		}
+	}
+}
+
+// stationTyped is implemented by collectors of stations other than national
+// weather service stations, such as buoys.
+type stationTyped interface {
+	StationType() string
+}
+
+// collects reports whether the collector collects the station. Collectors only
+// collect stations of their type, national weather service stations unless
+// they implement stationTyped, and global collectors collect none.
+func (c *registeredCollector) collects(config StationConfig) bool {
+	if c.collector == nil {
+		return false
+	}
+	var stationType string
+	if typed, ok := c.collector.(stationTyped); ok {
+		stationType = typed.StationType()
+	}
+	return stationType == config.Type
+}
+
+// CollectError is returned by collect when collectors fail, holding the error
+// of each failed collector.
+type CollectError []error
+
+func (e CollectError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// observer is implemented by the collectors retrieving the observations of a
+// station, which the station's series are mostly made of.
+type observer interface {
+	observes()
+}
+
+// collect runs every enabled collector of the station's type for the station.
+// Every collector runs even when an earlier one fails, and the outcome of each
+// is exported as nws_scrape_collector_success. Only the failures of the
+// collectors retrieving the station's observations are returned together,
+// failing the scrape, so that a failing forecast or alerts endpoint does not
+// hold back the observations of the station. When no such collector is
+// enabled, the failures of every collector are returned. Stations being probed
+// live are not counted in nws_scrape_errors_total.
+//
+// collect is called without holding configMu. Collectors copy the flags they
+// need holding it, release it while they make their requests, and hold it
+// again while they update series depending on flags.
+func collect(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	enabled := enabledCollectors()
+	configMu.RUnlock()
+
+	// collectors share the responses to the requests they have in common
+	ctx = withScrapeResponses(ctx)
+	probe := probing(config.ID)
+	var failed, others CollectError
+	observed := false
+	for _, c := range enabled {
+		if !c.collects(config) {
+			continue
+		}
+		_, isObserver := c.collector.(observer)
+		observed = observed || isObserver
+		err := c.collector.Update(ctx, config)
+		if err == nil {
+			scrapeCollectorSuccess.WithLabelValues(config.ID, c.name).Set(1)
+			continue
+		}
+		scrapeCollectorSuccess.WithLabelValues(config.ID, c.name).Set(0)
+		if !probe {
+			scrapeErrors.WithLabelValues(config.ID, c.name, classifyError(err)).Inc()
+		}
+		err = fmt.Errorf("%s collector: %w", c.name, err)
+		if isObserver {
+			failed = append(failed, err)
+		} else {
+			others = append(others, err)
+		}
+	}
+	if !observed {
+		failed = append(failed, others...)
+	} else if len(others) != 0 && ctx.Err() == nil {
+		log.Printf("Problem updating station %s: %s", config.ID, others)
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
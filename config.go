@@ -0,0 +1,345 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// labelsFlag is a repeatable flag collecting key=value pairs. A single value
+// may also hold several comma separated pairs, and an empty value clears the
+// labels.
+type labelsFlag map[string]string
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		for key := range l {
+			delete(l, key)
+		}
+		return nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !labelNameRE.MatchString(key) || strings.HasPrefix(key, "__") {
+			return fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		l[key] = strings.TrimSpace(val)
+	}
+	return nil
+}
+
+// defaultScrapeInterval returns -scrape-interval, or the deprecated
+// -backofftime when only it was changed from its default.
+func defaultScrapeInterval() time.Duration {
+	return durationOrBackofftime("scrape-interval", scrapeInterval)
+}
+
+// errorBackoffDuration returns -error-backoff, or the deprecated -backofftime
+// when only it was changed from its default.
+func errorBackoffDuration() time.Duration {
+	return durationOrBackofftime("error-backoff", errorBackoff)
+}
+
+func durationOrBackofftime(name string, d time.Duration) time.Duration {
+	if flag.Lookup(name).Value.String() == flag.Lookup(name).DefValue &&
+		flag.Lookup("backofftime").Value.String() != flag.Lookup("backofftime").DefValue {
+		return time.Duration(backofftime) * time.Second
+	}
+	return d
+}
+
+// envAliases are additional environment variable names accepted for a flag.
+var envAliases = map[string]string{
+	"localaddr": "NWS_EXPORTER_LISTEN",
+}
+
+// EnvName returns the environment variable configuring the named flag, for
+// example NWS_EXPORTER_MAX_CONCURRENT_FETCHES for -max-concurrent-fetches.
+func EnvName(name string) string {
+	return "NWS_EXPORTER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// LoadEnv applies the NWS_EXPORTER_* environment variables to every flag that
+// was not given on the command line.
+func LoadEnv() error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		env := EnvName(f.Name)
+		value, ok := os.LookupEnv(env)
+		if alias, hasAlias := envAliases[f.Name]; !ok && hasAlias {
+			env = alias
+			value, ok = os.LookupEnv(env)
+		}
+		if !ok {
+			return
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %w", value, env, setErr)
+		}
+	})
+	return err
+}
+
+// configStations holds the stations listed in the -config file.
+var configStations []StationConfig
+
+// explicitFlags are the flags given on the command line or in the environment,
+// which the -config file never overrides. It is recorded by
+// RecordExplicitFlags before the config file is first loaded.
+var explicitFlags map[string]bool
+
+// configFlags are the flags set by the most recently loaded config file.
+var configFlags = map[string]bool{}
+
+// RecordExplicitFlags records every flag set so far as explicitly given, so
+// that neither loading nor reloading the config file overrides it.
+func RecordExplicitFlags() {
+	explicitFlags = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicitFlags[f.Name] = true })
+}
+
+// configMu guards the flags against a config reload changing them while they
+// are read. LoadConfig holds it for writing, while scrapes, the http handlers
+// reading the flags and alert notifications hold it for reading. It is never
+// held while waiting on a request, so that a reload, and the handlers blocked
+// behind it, do not wait for a slow upstream: the flags a request needs are
+// copied holding it beforehand.
+var configMu sync.RWMutex
+
+// readingConfig holds configMu for reading while handler serves each request.
+func readingConfig(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		configMu.RLock()
+		defer configMu.RUnlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// LoadConfig reads the yaml configuration file at path and applies it to every
+// flag that was not given on the command line or in the environment. Flags
+// set by a previously loaded config file are first reset to their defaults, so
+// options removed from the file are reset and repeated values aren't added to
+// those of the previous file. The file is applied as a whole: when any of its
+// values is invalid, or the flags fail CheckFlags, every flag is left as it
+// was.
+//
+// Keys in the file are flag names, with nested maps joined by dots so that
+//
+//	tls:
+//	  cert-file: /etc/nws_exporter/cert.pem
+//
+// sets -tls.cert-file. Lists of values set a flag once per element. The one
+// exception is stations, which is a list of either ID[:interval][=name]
+// strings or maps with id, interval, name, type, tide_station and
+// normals_station keys.
+func LoadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	var parsedStations []StationConfig
+	if rawStations, ok := raw["stations"]; ok {
+		delete(raw, "stations")
+		parsedStations, err = parseConfigStations(rawStations)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	values := map[string][]string{}
+	if err := flattenConfig("", raw, values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	// the previous values are restored when the file turns out to be invalid
+	previous := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) { previous[f.Name] = f.Value.String() })
+	previousFlags, previousStations := configFlags, configStations
+	rollback := func() {
+		flag.VisitAll(func(f *flag.Flag) {
+			if f.Value.String() != previous[f.Name] {
+				resetFlag(f.Name)
+				flag.Set(f.Name, previous[f.Name])
+			}
+		})
+		configFlags, configStations = previousFlags, previousStations
+	}
+
+	for name := range configFlags {
+		resetFlag(name)
+	}
+	configFlags = map[string]bool{}
+	if !explicitFlags["station"] && !explicitFlags["stations"] {
+		configStations = parsedStations
+	}
+	for _, name := range names {
+		if explicitFlags[name] {
+			continue
+		}
+		configFlags[name] = true
+		for _, value := range values[name] {
+			if err := flag.Set(name, value); err != nil {
+				rollback()
+				return fmt.Errorf("%s: invalid value %q for %s: %w", path, value, name, err)
+			}
+		}
+	}
+	if errs := CheckFlags(); len(errs) != 0 {
+		rollback()
+		return fmt.Errorf("%s: %w", path, errs[0])
+	}
+	if _, err := stationList(); err != nil {
+		rollback()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// resetFlag sets the named flag back to its default. Repeatable flags, whose
+// default is empty, are cleared.
+func resetFlag(name string) {
+	flag.Set(name, flag.Lookup(name).DefValue)
+}
+
+// flattenConfig collects the values of the nested config map m into values,
+// keyed by flag name.
+func flattenConfig(prefix string, m map[string]any, values map[string][]string) error {
+	for key, value := range m {
+		name := prefix + key
+		switch value := value.(type) {
+		case map[string]any:
+			if err := flattenConfig(name+".", value, values); err != nil {
+				return err
+			}
+		case []any:
+			for _, element := range value {
+				switch element.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("option %q must be a list of values", name)
+				}
+				values[name] = append(values[name], fmt.Sprint(element))
+			}
+		case nil:
+		default:
+			values[name] = append(values[name], fmt.Sprint(value))
+		}
+	}
+	return nil
+}
+
+// parseConfigStations parses the stations list of the config file.
+func parseConfigStations(raw any) ([]StationConfig, error) {
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("stations must be a list")
+	}
+
+	var configs []StationConfig
+	seen := map[string]bool{}
+	for i, element := range list {
+		var config StationConfig
+		switch element := element.(type) {
+		case string:
+			var err error
+			config, err = ParseStationConfig(element)
+			if err != nil {
+				return nil, fmt.Errorf("station %d: %w", i+1, err)
+			}
+		case map[string]any:
+			for key := range element {
+				if key != "id" && key != "name" && key != "interval" && key != "type" && key != "tide_station" && key != "normals_station" {
+					return nil, fmt.Errorf("station %d: unknown key %q", i+1, key)
+				}
+			}
+			config.ID = strings.TrimSpace(fmt.Sprint(element["id"]))
+			if element["id"] == nil || config.ID == "" {
+				return nil, fmt.Errorf("station %d: missing id", i+1)
+			}
+			if name, ok := element["name"]; ok {
+				config.Name = fmt.Sprint(name)
+			}
+			if interval, ok := element["interval"]; ok {
+				d, err := time.ParseDuration(fmt.Sprint(interval))
+				if err != nil || d <= 0 {
+					return nil, fmt.Errorf("station %s: invalid interval %v", config.ID, interval)
+				}
+				config.Interval = d
+			}
+			if stationType, ok := element["type"]; ok {
+				var err error
+				config.Type, err = ParseStationType(fmt.Sprint(stationType))
+				if err != nil {
+					return nil, fmt.Errorf("station %s: %w", config.ID, err)
+				}
+			}
+			if tideStation, ok := element["tide_station"]; ok {
+				config.TideStation = strings.TrimSpace(fmt.Sprint(tideStation))
+				if err := ValidateTideStation(config.TideStation); err != nil {
+					return nil, fmt.Errorf("station %s: %w", config.ID, err)
+				}
+			}
+			if normalsStation, ok := element["normals_station"]; ok {
+				config.NormalsStation = strings.TrimSpace(fmt.Sprint(normalsStation))
+				if err := ValidateNormalsStation(config.NormalsStation); err != nil {
+					return nil, fmt.Errorf("station %s: %w", config.ID, err)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("station %d must be a string or a map", i+1)
+		}
+
+		if seen[config.ID] {
+			return nil, fmt.Errorf("duplicate station %s", config.ID)
+		}
+		seen[config.ID] = true
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
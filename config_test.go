@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testConfig = `
+addr: api.weather.gov
+timeout: 10
+verbose: true
+error-backoff:
+  max: 5m
+  jitter: 0.1
+circuit-breaker:
+  failures: 3
+label:
+  - site=home
+  - region=east
+missing:
+a:
+  b:
+    c: d
+`
+
+func TestFlattenConfig(t *testing.T) {
+	var raw map[string]any
+	if err := yaml.Unmarshal([]byte(testConfig), &raw); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	if err := flattenConfig("", raw, got); err != nil {
+		t.Fatalf("flattenConfig failed: %v", err)
+	}
+
+	want := map[string][]string{
+		"addr":                     {"api.weather.gov"},
+		"timeout":                  {"10"},
+		"verbose":                  {"true"},
+		"error-backoff.max":        {"5m"},
+		"error-backoff.jitter":     {"0.1"},
+		"circuit-breaker.failures": {"3"},
+		"label":                    {"site=home", "region=east"},
+		"a.b.c":                    {"d"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenConfig = %v, want %v", got, want)
+	}
+}
+
+func TestFlattenConfigRejectsNestedLists(t *testing.T) {
+	for _, config := range []string{
+		"label:\n  - site: home\n",
+		"error-backoff:\n  max:\n    - - 5m\n",
+	} {
+		var raw map[string]any
+		if err := yaml.Unmarshal([]byte(config), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if err := flattenConfig("", raw, map[string][]string{}); err == nil {
+			t.Errorf("flattenConfig of %q succeeded, want an error", config)
+		}
+	}
+}
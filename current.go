@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// quantityNames are the names of the canonical units of each quantity as
+// given in the current conditions api.
+var quantityNames = map[Quantity]string{
+	Temperature: "celsius",
+	Speed:       "kilometers_per_hour",
+	Pressure:    "pascals",
+	Distance:    "meters",
+	Depth:       "millimeters",
+	Angle:       "degrees",
+	Percent:     "percent",
+	Index:       "index",
+	Flow:        "cubic_meters_per_second",
+}
+
+// latestObservations holds the latest observation of every station, after
+// quality control and with its values converted to canonical units.
+var latestObservations = struct {
+	sync.Mutex
+	responses map[string]ObservationResponse
+}{responses: map[string]ObservationResponse{}}
+
+func storeObservation(station string, response ObservationResponse) {
+	latestObservations.Lock()
+	defer latestObservations.Unlock()
+	latestObservations.responses[station] = response
+}
+
+func forgetObservation(station string) {
+	latestObservations.Lock()
+	defer latestObservations.Unlock()
+	delete(latestObservations.responses, station)
+}
+
+// CurrentValue is a value of the current conditions and its unit.
+type CurrentValue struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// CurrentConditions is the latest observation of a station as served by the
+// current conditions api. Values the station did not report are left out.
+type CurrentConditions struct {
+	Station     string                  `json:"station"`
+	Timestamp   time.Time               `json:"timestamp"`
+	Description string                  `json:"description,omitempty"`
+	Values      map[string]CurrentValue `json:"values"`
+}
+
+// NewCurrentConditions returns the current conditions of the station from its
+// observation, keyed by the snake cased names of the observation's properties
+// such as relative_humidity.
+func NewCurrentConditions(station string, response ObservationResponse) CurrentConditions {
+	conditions := CurrentConditions{
+		Station:     station,
+		Timestamp:   response.Properties.Timestamp,
+		Description: response.Properties.TextDescription,
+		Values:      map[string]CurrentValue{},
+	}
+	for _, m := range response.measurements() {
+		if v, ok := value(*m.measurement); ok {
+			conditions.Values[snakeCase(m.property)] = CurrentValue{Value: v, Unit: quantityNames[m.quantity]}
+		}
+	}
+	return conditions
+}
+
+// snakeCase converts a name such as PrecipitationLast3Hours to
+// precipitation_last_3_hours.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && (unicode.IsUpper(r) || unicode.IsDigit(r) && !unicode.IsDigit(rune(name[i-1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// CurrentHandler serves the latest observation of a station as json at
+// /api/v1/current?station=KPHL, for scripts that would rather not parse the
+// prometheus text format.
+type CurrentHandler struct{}
+
+func (CurrentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed, use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	station := r.URL.Query().Get("station")
+	if station == "" {
+		http.Error(w, "station parameter is missing", http.StatusBadRequest)
+		return
+	}
+	latestObservations.Lock()
+	response, ok := latestObservations.responses[station]
+	latestObservations.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("no observation of station %s", station), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewCurrentConditions(station, response))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// debugHandler serves the pprof profiles of the exporter under /debug/pprof/
+// and its expvar variables at /debug/vars.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// serveDebug serves debugHandler on a listener of its own, keeping the debug
+// endpoints off the address prometheus scrapes. It is served like the metrics
+// listener until shut down.
+func serveDebug(server *http.Server) {
+	log.Printf("Serving debug endpoints on %s", server.Addr)
+	if err := listenAndServe(server, "debug"); err != http.ErrServerClosed {
+		log.Fatalf("error: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+func init() {
+	addAccumulation(&Accumulation{
+		Name:      "growing_degree_days_total",
+		Help:      "growing degree days in celsius above -gdd.base, with temperatures capped at -gdd.cap",
+		TodayName: "growing_degree_days_today",
+		TodayHelp: "growing degree days in celsius since local midnight",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			t, ok := value(response.Properties.Temperature)
+			if !ok {
+				return 0, false
+			}
+			return GrowingDegrees(t, gddBase, gddCap) * elapsed.Hours() / 24, true
+		},
+	})
+	addAccumulation(&Accumulation{
+		Name: "heating_degree_hours_total",
+		Help: "heating degree hours in celsius, the hours weighted by how far the temperature is below -hdh.base",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			t, ok := value(response.Properties.Temperature)
+			if !ok {
+				return 0, false
+			}
+			return math.Max(heatingBase-t, 0) * elapsed.Hours(), true
+		},
+	})
+	addAccumulation(&Accumulation{
+		Name: "cooling_degree_hours_total",
+		Help: "cooling degree hours in celsius, the hours weighted by how far the temperature is above -cdh.base",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			t, ok := value(response.Properties.Temperature)
+			if !ok {
+				return 0, false
+			}
+			return math.Max(t-coolingBase, 0) * elapsed.Hours(), true
+		},
+	})
+}
+
+// GrowingDegrees returns the degrees a temperature contributes to growing
+// degree days, with the temperature capped at upper and nothing contributed
+// below base.
+func GrowingDegrees(celsius, base, upper float64) float64 {
+	return math.Max(math.Min(celsius, upper)-base, 0)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics derived from the values of an observation rather than reported by
+// the api.
+var (
+	apparentTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apparent_temperature_celsius",
+			Help: "temperature it feels like in celsius, the heat index in hot weather, the wind chill in cold weather, and the temperature otherwise",
+		},
+		[]string{"station"},
+	)
+	wetBulbTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wet_bulb_temperature_celsius",
+			Help: "wet bulb temperature in celsius",
+		},
+		[]string{"station"},
+	)
+	absoluteHumidity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "absolute_humidity_grams_per_cubic_meter",
+			Help: "mass of water vapor per volume of air in grams per cubic meter",
+		},
+		[]string{"station"},
+	)
+	mixingRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mixing_ratio_grams_per_kilogram",
+			Help: "mass of water vapor per mass of dry air in grams per kilogram",
+		},
+		[]string{"station"},
+	)
+	specificHumidity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "specific_humidity_grams_per_kilogram",
+			Help: "mass of water vapor per mass of moist air in grams per kilogram",
+		},
+		[]string{"station"},
+	)
+	dewpointDepression = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dewpoint_depression_celsius",
+			Help: "difference between the temperature and the dewpoint in celsius",
+		},
+		[]string{"station"},
+	)
+	fogRisk = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fog_risk",
+			Help: "1 when the dewpoint depression is within -fog.max-spread and the wind is at most -fog.max-wind, 0 otherwise",
+		},
+		[]string{"station"},
+	)
+	pressureAltitude = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pressure_altitude_meters",
+			Help: "altitude in the standard atmosphere of the pressure at the station in meters",
+		},
+		[]string{"station"},
+	)
+	densityAltitude = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "density_altitude_meters",
+			Help: "altitude in the standard atmosphere of the air density at the station in meters",
+		},
+		[]string{"station"},
+	)
+	vaporPressureDeficit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vapor_pressure_deficit_pascals",
+			Help: "difference between the saturation and actual vapor pressure of the air in pascals",
+		},
+		[]string{"station"},
+	)
+	estimatedCloudBase = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "estimated_cloud_base_meters",
+			Help: "estimated base of cumulus clouds above the station in meters, from the dewpoint depression",
+		},
+		[]string{"station"},
+	)
+	wetBulbGlobeTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wet_bulb_globe_temperature_celsius",
+			Help: "estimated wet bulb globe temperature in celsius, a measure of heat stress",
+		},
+		[]string{"station"},
+	)
+)
+
+// derivedMetrics are exported by the observations collector along with the
+// values of the observation.
+var derivedMetrics = []prometheus.Collector{
+	apparentTemperature, apparentTemperatureFahrenheit,
+	wetBulbTemperature, wetBulbTemperatureFahrenheit,
+	wetBulbGlobeTemperature, wetBulbGlobeTemperatureFahrenheit,
+	absoluteHumidity, mixingRatio, specificHumidity,
+	dewpointDepression, dewpointDepressionFahrenheit, fogRisk,
+	estimatedCloudBase, estimatedCloudBaseFeet,
+	pressureAltitude, pressureAltitudeFeet, densityAltitude, densityAltitudeFeet,
+	vaporPressureDeficit,
+	pressureTendency, pressureTendencyInchesOfMercury, pressureTendencyInfo,
+	evapotranspirationRate, headwind, crosswind, totals,
+}
+
+// value returns the value of a measurement, reporting whether it has one.
+func value(m *Measurement) (float64, bool) {
+	if m == nil || m.Value == nil {
+		return 0, false
+	}
+	return *m.Value, true
+}
+
+// updateDerived sets the derived gauges of the station from an observation
+// whose values have been converted to canonical units. Derived values whose
+// inputs are missing are removed.
+func updateDerived(station string, response ObservationResponse) {
+	updatePressureTendency(station, response)
+	if !probing(station) {
+		totals.Add(station, response)
+	}
+	updateEvapotranspiration(station, response)
+	updateWindComponents(station, response)
+	updateForecastErrors(station, response)
+	updateClimateDepartures(station, response)
+
+	p := response.Properties
+	t, hasT := value(p.Temperature)
+	rh, hasRH := value(p.RelativeHumidity)
+	wind, hasWind := value(p.WindSpeed)
+	dewpoint, hasDewpoint := value(p.Dewpoint)
+	pressure, hasPressure := stationPressure(response)
+
+	if hasT {
+		apparent := t
+		if heatIndex, ok := value(p.HeatIndex); ok {
+			apparent = heatIndex
+		} else if windChill, ok := value(p.WindChill); ok {
+			apparent = windChill
+		} else if t >= 27 && hasRH {
+			apparent = HeatIndex(t, rh)
+		} else if t <= 10 && hasWind && wind > 4.8 {
+			apparent = WindChill(t, wind)
+		}
+		setGauge(apparentTemperature, station, apparent)
+	} else {
+		deleteGauge(apparentTemperature, station)
+	}
+
+	if hasT && hasRH {
+		wetBulb := WetBulbTemperature(t, rh)
+		setGauge(wetBulbTemperature, station, wetBulb)
+
+		globe := t
+		if wbgtSolar {
+			globe = GlobeTemperature(t, solarRadiation(response), wind)
+		}
+		setGauge(wetBulbGlobeTemperature, station, 0.7*wetBulb+0.2*globe+0.1*t)
+	} else {
+		deleteGauge(wetBulbTemperature, station)
+		deleteGauge(wetBulbGlobeTemperature, station)
+	}
+
+	if hasT && hasRH {
+		vaporPressureDeficit.WithLabelValues(station).Set(VaporPressure(t) * (1 - rh/100))
+	} else {
+		vaporPressureDeficit.DeleteLabelValues(station)
+	}
+	if hasT && hasDewpoint {
+		e := VaporPressure(dewpoint)
+		absoluteHumidity.WithLabelValues(station).Set(e / (461.5 * (t + 273.15)) * 1000)
+
+		spread := t - dewpoint
+		setGauge(dewpointDepression, station, spread)
+		// rising air cools about 8°C per 1000 meters faster than its
+		// dewpoint falls, so it saturates 125 meters up per degree of spread
+		setGauge(estimatedCloudBase, station, math.Max(spread, 0)*125)
+		if hasWind {
+			risk := 0.0
+			if spread <= fogMaxSpread && wind <= fogMaxWind {
+				risk = 1
+			}
+			fogRisk.WithLabelValues(station).Set(risk)
+		} else {
+			fogRisk.DeleteLabelValues(station)
+		}
+	} else {
+		absoluteHumidity.DeleteLabelValues(station)
+		deleteGauge(dewpointDepression, station)
+		deleteGauge(estimatedCloudBase, station)
+		fogRisk.DeleteLabelValues(station)
+	}
+	if hasDewpoint && hasPressure {
+		e := VaporPressure(dewpoint)
+		mixingRatio.WithLabelValues(station).Set(622 * e / (pressure - e))
+		specificHumidity.WithLabelValues(station).Set(622 * e / (pressure - 0.378*e))
+	} else {
+		mixingRatio.DeleteLabelValues(station)
+		specificHumidity.DeleteLabelValues(station)
+	}
+
+	if hasPressure {
+		setGauge(pressureAltitude, station, 44307.69*(1-math.Pow(pressure/101325, 0.190284)))
+	} else {
+		deleteGauge(pressureAltitude, station)
+	}
+	if hasPressure && hasT {
+		// the vapor pressure is taken as zero without a dewpoint, which
+		// slightly underestimates the density altitude of humid air
+		e := 0.0
+		if hasDewpoint {
+			e = VaporPressure(dewpoint)
+		}
+		kelvin := t + 273.15
+		density := (pressure-e)/(287.05*kelvin) + e/(461.5*kelvin)
+		setGauge(densityAltitude, station, 44307.69*(1-math.Pow(density/1.225, 0.234969)))
+	} else {
+		deleteGauge(densityAltitude, station)
+	}
+}
+
+// VaporPressure returns the saturation vapor pressure in pascals over water at
+// a temperature in celsius, using the formula of Bolton (1980). At the
+// dewpoint this is the actual vapor pressure of the air.
+func VaporPressure(celsius float64) float64 {
+	return 611.2 * math.Exp(17.67*celsius/(celsius+243.5))
+}
+
+// stationPressure returns the pressure in pascals at the station's elevation,
+// reporting whether the observation has both a pressure and an elevation. The
+// api's barometric pressure is the altimeter setting, reduced to sea level
+// with the standard atmosphere, so it is raised back up to the station's
+// elevation.
+func stationPressure(response ObservationResponse) (float64, bool) {
+	altimeter, ok := value(response.Properties.BarometricPressure)
+	if !ok {
+		return 0, false
+	}
+	elevation, ok := value(response.Properties.Elevation)
+	if !ok {
+		return 0, false
+	}
+	return altimeter * math.Pow(1-0.0065*elevation/288.15, 5.2559), true
+}
+
+// HeatIndex returns the heat index in celsius of a temperature in celsius and
+// a relative humidity in percent, using the regression of the National Weather
+// Service. It is only meaningful above about 27°C.
+func HeatIndex(celsius, humidity float64) float64 {
+	t := celsiusToFahrenheit(celsius)
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + humidity*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*humidity -
+			0.22475541*t*humidity - 0.00683783*t*t -
+			0.05481717*humidity*humidity + 0.00122874*t*t*humidity +
+			0.00085282*t*humidity*humidity - 0.00000199*t*t*humidity*humidity
+		switch {
+		case humidity < 13 && t >= 80 && t <= 112:
+			hi -= (13 - humidity) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case humidity > 85 && t >= 80 && t <= 87:
+			hi += (humidity - 85) / 10 * (87 - t) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9
+}
+
+// WindChill returns the wind chill in celsius of a temperature in celsius and
+// a wind speed in kilometers per hour. It is only meaningful at or below 10°C
+// and with winds above 4.8 kilometers per hour.
+func WindChill(celsius, kmh float64) float64 {
+	v := math.Pow(kmh, 0.16)
+	return 13.12 + 0.6215*celsius - 11.37*v + 0.3965*celsius*v
+}
+
+// WetBulbTemperature returns the wet bulb temperature in celsius of a
+// temperature in celsius and a relative humidity in percent, using the
+// approximation of Stull (2011).
+func WetBulbTemperature(celsius, humidity float64) float64 {
+	return celsius*math.Atan(0.151977*math.Sqrt(humidity+8.313659)) +
+		math.Atan(celsius+humidity) - math.Atan(humidity-1.676331) +
+		0.00391838*math.Pow(humidity, 1.5)*math.Atan(0.023101*humidity) -
+		4.686035
+}
+
+// GlobeTemperature returns a rough estimate in celsius of the temperature of
+// a black globe thermometer in the sun, given the air temperature in celsius,
+// the solar radiation in watts per square meter and the wind speed in
+// kilometers per hour. The globe warms above the air with the radiation it
+// absorbs and is cooled by the wind.
+func GlobeTemperature(celsius, radiation, kmh float64) float64 {
+	wind := math.Max(kmh/3.6, 0.5)
+	return celsius + 0.017*radiation/math.Sqrt(wind)
+}
+
+// skyCover is the fraction of the sky covered by each METAR cloud amount.
+var skyCover = map[string]float64{
+	"SKC": 0, "CLR": 0, "FEW": 2.0 / 8, "SCT": 4.0 / 8, "BKN": 6.0 / 8, "OVC": 1, "VV": 1,
+}
+
+// solarRadiation estimates the solar radiation reaching the ground at the
+// station at the time of the observation, in watts per square meter, from the
+// elevation of the sun and the sky cover of the observation's cloud layers.
+func solarRadiation(response ObservationResponse) float64 {
+	if len(response.Geometry.Coordinates) < 2 {
+		return 0
+	}
+	lon, lat := response.Geometry.Coordinates[0], response.Geometry.Coordinates[1]
+	elevation := SolarElevation(lat, lon, response.Properties.Timestamp)
+	if elevation <= 0 {
+		return 0
+	}
+
+	// clear sky radiation reduced by cloud cover, after Kasten and Czeplak
+	clear := 990*math.Sin(elevation*math.Pi/180) - 30
+	return math.Max(clear, 0) * cloudTransmittance(response)
+}
+
+// cloudTransmittance returns the fraction of clear sky solar radiation passing
+// through the cloud layers of the observation, after Kasten and Czeplak.
+func cloudTransmittance(response ObservationResponse) float64 {
+	cover := 0.0
+	if response.Properties.CloudLayers != nil {
+		for _, layer := range *response.Properties.CloudLayers {
+			cover = math.Max(cover, skyCover[layer.Amount])
+		}
+	}
+	return 1 - 0.75*math.Pow(cover, 3.4)
+}
+
+// SolarElevation returns the elevation of the sun in degrees above the horizon
+// at the given latitude and longitude at time t.
+func SolarElevation(lat, lon float64, t time.Time) float64 {
+	t = t.UTC()
+	day := float64(t.YearDay())
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+
+	// fractional year in radians
+	gamma := 2 * math.Pi / 365 * (day - 1 + (hour-12)/24)
+	declination := 0.006918 - 0.399912*math.Cos(gamma) + 0.070257*math.Sin(gamma) -
+		0.006758*math.Cos(2*gamma) + 0.000907*math.Sin(2*gamma) -
+		0.002697*math.Cos(3*gamma) + 0.00148*math.Sin(3*gamma)
+	equationOfTime := 229.18 * (0.000075 + 0.001868*math.Cos(gamma) - 0.032077*math.Sin(gamma) -
+		0.014615*math.Cos(2*gamma) - 0.040849*math.Sin(2*gamma))
+
+	solarTime := hour*60 + equationOfTime + 4*lon
+	hourAngle := (solarTime/4 - 180) * math.Pi / 180
+	latitude := lat * math.Pi / 180
+
+	sin := math.Sin(latitude)*math.Sin(declination) +
+		math.Cos(latitude)*math.Cos(declination)*math.Cos(hourAngle)
+	return math.Asin(sin) * 180 / math.Pi
+}
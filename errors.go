@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StaleError is returned by the observations collector when the latest
+// observation of a station is older than -stale-after.
+type StaleError struct {
+	Station string
+	Age     time.Duration
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("latest observation of station %s is %v old", e.Station, e.Age.Round(time.Minute))
+}
+
+// classifyError returns the class of a collector's error exported as the class
+// label of nws_scrape_errors_total: dns, connect, tls, timeout, http_4xx,
+// http_5xx, decode, stale, retry_after for requests not made while a host asked
+// not to be retried, or other for errors matching none of them.
+func classifyError(err error) string {
+	var staleErr *StaleError
+	var retryAfterErr *RetryAfterError
+	var statusErr *StatusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+
+	// the failures of a collector retrieving several items are classified by
+	// the first
+	var failed CollectError
+	if errors.As(err, &failed) && len(failed) != 0 {
+		return classifyError(failed[0])
+	}
+
+	switch {
+	case errors.As(err, &staleErr):
+		return "stale"
+	case errors.As(err, &retryAfterErr):
+		return "retry_after"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+		return "http_5xx"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 400:
+		return "http_4xx"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &recordErr), errors.As(err, &authorityErr),
+		errors.As(err, &invalidErr), errors.As(err, &hostnameErr),
+		strings.Contains(err.Error(), "tls: "):
+		return "tls"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "connect"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return "decode"
+	}
+	return "other"
+}
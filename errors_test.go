@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	var n int
+	syntaxErr := json.Unmarshal([]byte("{"), &n)
+	typeErr := json.Unmarshal([]byte(`"12"`), &n)
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	get := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://api.weather.gov", Err: err}
+	}
+
+	classes := map[string][]error{
+		"stale":       {&StaleError{Station: "KPHL", Age: time.Hour}},
+		"retry_after": {&RetryAfterError{Host: "api.weather.gov", Until: time.Now().Add(time.Minute)}},
+		"http_5xx":    {&StatusError{StatusCode: 503}, fmt.Errorf("station KPHL: %w", &StatusError{StatusCode: 500})},
+		"http_4xx":    {&StatusError{StatusCode: 404}, CollectError{&StatusError{StatusCode: 404}, dial}},
+		"dns":         {get(&net.DNSError{Err: "no such host", Name: "api.weather.gov"})},
+		"timeout":     {get(context.DeadlineExceeded)},
+		"tls":         {get(x509.UnknownAuthorityError{}), errors.New("remote error: tls: handshake failure")},
+		"connect":     {get(dial)},
+		"decode":      {syntaxErr, fmt.Errorf("decoding station KPHL: %w", typeErr)},
+		"other":       {errors.New("something else")},
+	}
+	for class, errs := range classes {
+		for _, err := range errs {
+			if got := classifyError(err); got != class {
+				t.Errorf("classifyError(%v) = %q, want %q", err, got, class)
+			}
+		}
+	}
+}
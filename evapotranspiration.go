@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var evapotranspirationRate = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "evapotranspiration_rate_millimeters_per_hour",
+		Help: "estimated reference evapotranspiration (ET0) of short grass in millimeters per hour",
+	},
+	[]string{"station"},
+)
+
+func init() {
+	addAccumulation(&Accumulation{
+		Name:      "evapotranspiration_meters_total",
+		Help:      "estimated reference evapotranspiration (ET0) of short grass in meters",
+		TodayName: "evapotranspiration_today_meters",
+		TodayHelp: "estimated reference evapotranspiration (ET0) of short grass in meters since local midnight",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			rate, ok := ReferenceEvapotranspiration(response)
+			if !ok {
+				return 0, false
+			}
+			return rate / 1000 * elapsed.Hours(), true
+		},
+	})
+}
+
+// updateEvapotranspiration sets the station's reference evapotranspiration
+// rate, removing it when the observation lacks the values it needs.
+func updateEvapotranspiration(station string, response ObservationResponse) {
+	if rate, ok := ReferenceEvapotranspiration(response); ok {
+		evapotranspirationRate.WithLabelValues(station).Set(rate)
+	} else {
+		evapotranspirationRate.DeleteLabelValues(station)
+	}
+}
+
+// ReferenceEvapotranspiration returns the hourly reference evapotranspiration
+// of short grass in millimeters per hour, using the FAO-56 Penman-Monteith
+// equation. The stations don't measure solar radiation, so it is estimated
+// from the elevation of the sun and the sky cover. It reports false when the
+// observation lacks a temperature, humidity or wind speed.
+func ReferenceEvapotranspiration(response ObservationResponse) (float64, bool) {
+	p := response.Properties
+	t, hasT := value(p.Temperature)
+	rh, hasRH := value(p.RelativeHumidity)
+	wind, hasWind := value(p.WindSpeed)
+	if !hasT || !hasRH || !hasWind {
+		return 0, false
+	}
+	pressure, ok := stationPressure(response)
+	if !ok {
+		pressure = 101325
+	}
+
+	// wind at the standard 2 meters from the 10 meters it is measured at
+	u2 := wind / 3.6 * 4.87 / math.Log(67.8*10-5.42)
+	es := VaporPressure(t) / 1000
+	ea := es * rh / 100
+	delta := 4098 * es / math.Pow(t+237.3, 2)
+	gamma := 0.000665 * pressure / 1000
+
+	// radiation in MJ per square meter per hour
+	shortwave := 0.77 * solarRadiation(response) * 0.0036
+	longwave := 2.042e-10 * math.Pow(t+273.15, 4) * (0.34 - 0.14*math.Sqrt(ea)) *
+		(1.35*cloudTransmittance(response) - 0.35)
+	net := shortwave - longwave
+	soil := 0.5 * net
+	if shortwave > 0 {
+		soil = 0.1 * net
+	}
+
+	et0 := (0.408*delta*(net-soil) + gamma*37/(t+273.15)*u2*(es-ea)) /
+		(delta + gamma*(1+0.34*u2))
+	return math.Max(et0, 0), true
+}
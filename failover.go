@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var upstreamActiveHost = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "upstream_active_host",
+		Help: "1 for the -addr host that served the latest successful request to the nws api, 0 for the others",
+	},
+	[]string{"host"},
+)
+
+// hostsFlag is a flag holding the ordered, comma separated list of hosts the
+// nws api is requested from, such as a caching proxy followed by
+// api.weather.gov. Setting it also sets address to the first host, which the
+// urls of requests are built with. Like every flag, the hosts and address are
+// guarded by configMu, as a config reload may set them again while stations
+// are being scraped.
+type hostsFlag struct {
+	hosts []string
+}
+
+func (h *hostsFlag) String() string {
+	if h == nil {
+		return ""
+	}
+	return strings.Join(h.hosts, ",")
+}
+
+func (h *hostsFlag) Set(value string) error {
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if strings.Contains(host, "/") {
+			return fmt.Errorf("invalid host %q, expected a host with an optional port", host)
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return errors.New("no host given")
+	}
+	h.hosts = hosts
+	address = hosts[0]
+	return nil
+}
+
+// Hosts returns a copy of the hosts.
+func (h *hostsFlag) Hosts() []string {
+	return append([]string(nil), h.hosts...)
+}
+
+// apiHosts returns the hosts to request from in turn in place of host, every
+// -addr host when host is the first of them, or only host otherwise. The
+// caller holds configMu.
+func apiHosts(host string) []string {
+	hosts := addresses.Hosts()
+	if len(hosts) == 0 || hosts[0] != host {
+		return []string{host}
+	}
+	return hosts
+}
+
+// failover reports whether a request that failed on one -addr host is worth
+// making to the next one. Requests rejected as invalid, which every host
+// would reject alike, are not, nor are requests aborted on shutdown.
+func failover(err error) bool {
+	var statusErr *StatusError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// isAPIHost reports whether host is one of hosts, the -addr hosts, rather
+// than the host of another service.
+func isAPIHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// recordActiveHost marks host as the -addr host that served the latest
+// successful request, when it is one of hosts, the -addr hosts.
+func recordActiveHost(host string, hosts []string) {
+	if !isAPIHost(host, hosts) {
+		return
+	}
+	// hosts dropped from -addr by a reload are removed
+	upstreamActiveHost.Reset()
+	for _, h := range hosts {
+		if h == host {
+			upstreamActiveHost.WithLabelValues(h).Set(1)
+		} else {
+			upstreamActiveHost.WithLabelValues(h).Set(0)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFailover(t *testing.T) {
+	// failures of the host itself move on to the next host
+	for _, err := range []error{
+		&StatusError{StatusCode: 500},
+		&StatusError{StatusCode: 503},
+		&StatusError{StatusCode: 429},
+		&net.DNSError{Err: "no such host", Name: "proxy.local"},
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		context.DeadlineExceeded,
+	} {
+		if !failover(err) {
+			t.Errorf("failover(%v) = false, want true", err)
+		}
+	}
+
+	// every host would reject an invalid request alike
+	for _, err := range []error{
+		&StatusError{StatusCode: 404},
+		&StatusError{StatusCode: 400},
+		context.Canceled,
+		fmt.Errorf("Get: %w", context.Canceled),
+	} {
+		if failover(err) {
+			t.Errorf("failover(%v) = true, want false", err)
+		}
+	}
+}
+
+func TestHostsFlag(t *testing.T) {
+	defer func(hosts []string, addr string) {
+		addresses.hosts, address = hosts, addr
+	}(addresses.hosts, address)
+
+	valid := map[string][]string{
+		"api.weather.gov":                   {"api.weather.gov"},
+		"proxy.local:8080, api.weather.gov": {"proxy.local:8080", "api.weather.gov"},
+		"proxy.local,,":                     {"proxy.local"},
+	}
+	for value, want := range valid {
+		t.Run(value, func(t *testing.T) {
+			var h hostsFlag
+			if err := h.Set(value); err != nil {
+				t.Fatalf("Set(%q) failed: %v", value, err)
+			}
+			if !reflect.DeepEqual(h.Hosts(), want) || h.String() != strings.Join(want, ",") {
+				t.Errorf("Set(%q) = %v (%q), want %v", value, h.Hosts(), h.String(), want)
+			}
+			if address != want[0] {
+				t.Errorf("Set(%q) set address %q, want the first host %q", value, address, want[0])
+			}
+		})
+	}
+
+	for _, value := range []string{"", " , ", "https://api.weather.gov/"} {
+		var h hostsFlag
+		if err := h.Set(value); err == nil {
+			t.Errorf("Set(%q) = %v, want an error", value, h.Hosts())
+		}
+	}
+}
+
+func TestAPIHosts(t *testing.T) {
+	defer func(hosts []string) { addresses.hosts = hosts }(addresses.hosts)
+	addresses.hosts = []string{"proxy.local", "api.weather.gov"}
+
+	// only requests to the first host fail over, so a request for a later
+	// host, or for another service, is only made to it
+	if got, want := apiHosts("proxy.local"), addresses.hosts; !reflect.DeepEqual(got, want) {
+		t.Errorf("apiHosts(proxy.local) = %v, want %v", got, want)
+	}
+	for _, host := range []string{"api.weather.gov", "aviationweather.gov"} {
+		if got := apiHosts(host); !reflect.DeepEqual(got, []string{host}) {
+			t.Errorf("apiHosts(%q) = %v, want only %s", host, got, host)
+		}
+	}
+
+	if !isAPIHost("api.weather.gov", addresses.hosts) || isAPIHost("aviationweather.gov", addresses.hosts) {
+		t.Errorf("isAPIHost: only the -addr hosts %v are api hosts", addresses.hosts)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	fireHainesIndex = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fire_haines_index",
+			Help: "forecast haines index of the current hour, from 2 to 6, the potential of dry unstable air for large wildfires",
+		},
+		[]string{"station"},
+	)
+	fireRedFlagThreatIndex = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fire_red_flag_threat_index",
+			Help: "forecast red flag threat index of the current hour, where available",
+		},
+		[]string{"station"},
+	)
+	fireMixingHeight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fire_mixing_height_meters",
+			Help: "forecast mixing height of the current hour in meters",
+		},
+		[]string{"station"},
+	)
+	fireTransportWindSpeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fire_transport_wind_speed_kilometers_per_hour",
+			Help: "forecast transport wind speed of the current hour in kilometers per hour",
+		},
+		[]string{"station"},
+	)
+	fireWeatherAlert = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fire_weather_alert_active",
+			Help: "whether a red flag warning or fire weather watch is in effect for the station, 1 when it is and 0 otherwise",
+		},
+		[]string{"station", "event"},
+	)
+)
+
+// fireElements are the gridpoint elements exported as the current fire
+// weather of a station.
+var fireElements = []struct {
+	name     string
+	quantity Quantity
+	gauge    *prometheus.GaugeVec
+}{
+	{"hainesIndex", Index, fireHainesIndex},
+	{"redFlagThreatIndex", Index, fireRedFlagThreatIndex},
+	{"mixingHeight", Distance, fireMixingHeight},
+	{"transportWindSpeed", Speed, fireTransportWindSpeed},
+}
+
+// fireWeatherEvents are the alert events exported by nws_fire_weather_alert_active.
+var fireWeatherEvents = []string{"Red Flag Warning", "Fire Weather Watch"}
+
+func init() {
+	registerCollector("fire_weather", false, &fireWeatherCollector{},
+		fireHainesIndex, fireRedFlagThreatIndex, fireMixingHeight,
+		fireTransportWindSpeed, fireWeatherAlert)
+}
+
+// fireWeatherCollector exports the fire weather of a station: the fire weather
+// elements of the forecast grid covering it for the current hour, retrieved
+// every -forecast.interval, and the red flag warnings and fire weather watches
+// in effect there, retrieved every -alerts.interval. The grid and alerts are
+// retrieved alongside the gridpoint and alerts collectors, sharing their
+// responses within a scrape.
+type fireWeatherCollector struct {
+	grid, alerts refreshTracker
+}
+
+// Update refreshes the grid and the alerts when they are due, the alerts
+// being refreshed even when the grid fails.
+func (c *fireWeatherCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	gridInterval, alertInterval, addr, t := forecastInterval, alertsInterval, address, timeout
+	configMu.RUnlock()
+	var failed CollectError
+	if c.grid.Due(config.ID, gridInterval) {
+		if err := c.updateGrid(ctx, config.ID, addr, t); err != nil {
+			failed = append(failed, fmt.Errorf("retrieving forecast grid: %w", err))
+		} else {
+			c.grid.Done(config.ID)
+		}
+	}
+	if c.alerts.Due(config.ID, alertInterval) {
+		if err := c.updateAlerts(ctx, config.ID, addr, t); err != nil {
+			failed = append(failed, fmt.Errorf("retrieving alerts: %w", err))
+		} else {
+			c.alerts.Done(config.ID)
+		}
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+func (c *fireWeatherCollector) updateGrid(ctx context.Context, station, address string, timeout int) error {
+	point, err := StationPoint(ctx, station, address, timeout)
+	if err != nil {
+		return err
+	}
+	layers, err := RetrieveGridpoint(ctx, point, address, timeout)
+	if err != nil {
+		return err
+	}
+	return updateFireWeatherMetrics(station, layers, time.Now())
+}
+
+func (c *fireWeatherCollector) updateAlerts(ctx context.Context, station, address string, timeout int) error {
+	query, err := stationAlertsQuery(ctx, station, address, timeout)
+	if err != nil {
+		return err
+	}
+	alerts, err := RetrieveActiveAlerts(ctx, query, address, timeout)
+	if err != nil {
+		return err
+	}
+	for _, event := range fireWeatherEvents {
+		active := 0.0
+		for _, alert := range alerts {
+			if alert.Event == event {
+				active = 1
+			}
+		}
+		fireWeatherAlert.WithLabelValues(station, event).Set(active)
+	}
+	return nil
+}
+
+// Forget forgets when the station's grid and alerts were refreshed.
+func (c *fireWeatherCollector) Forget(station string) {
+	c.grid.Forget(station)
+	c.alerts.Forget(station)
+}
+
+// updateFireWeatherMetrics sets the station's fire weather series to the values
+// of the fire weather elements holding at now. Elements the forecast office
+// does not forecast are not exported.
+func updateFireWeatherMetrics(station string, layers map[string]GridpointLayer, now time.Time) error {
+	for _, element := range fireElements {
+		v, ok, err := layers[element.name].ValueAt(now, element.quantity)
+		if err != nil {
+			return err
+		}
+		if ok {
+			element.gauge.WithLabelValues(station).Set(v)
+		} else {
+			element.gauge.DeleteLabelValues(station)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	forecastTemperatureHigh = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_temperature_high_celsius",
+			Help: "forecast high temperature of each daytime forecast period in celsius",
+		},
+		[]string{"station", "period", "day_offset"},
+	)
+	forecastTemperatureLow = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_temperature_low_celsius",
+			Help: "forecast low temperature of each overnight forecast period in celsius",
+		},
+		[]string{"station", "period", "day_offset"},
+	)
+	forecastPrecipitationProbability = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_precipitation_probability_percent",
+			Help: "forecast probability of precipitation of each forecast period in percent",
+		},
+		[]string{"station", "period", "day_offset"},
+	)
+	forecastWindSpeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_wind_speed_kilometers_per_hour",
+			Help: "forecast wind speed of each forecast period in kilometers per hour, the upper end when a range is forecast",
+		},
+		[]string{"station", "period", "day_offset"},
+	)
+	forecastWindDirection = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_wind_direction_degrees",
+			Help: "forecast wind direction of each forecast period in degrees",
+		},
+		[]string{"station", "period", "day_offset"},
+	)
+	forecastUpdated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_update_timestamp_seconds",
+			Help: "time the forecast was last updated by the forecast office as a unix timestamp",
+		},
+		[]string{"station"},
+	)
+)
+
+func init() {
+	registerCollector("forecast", false, &forecastCollector{},
+		forecastTemperatureHigh, forecastTemperatureLow,
+		forecastPrecipitationProbability, forecastWindSpeed,
+		forecastWindDirection, forecastUpdated)
+}
+
+// forecastCollector exports the daily forecast of the grid covering a
+// station. Forecasts are updated far less often than observations, so the
+// forecast is only retrieved every -forecast.interval.
+type forecastCollector struct {
+	refreshTracker
+}
+
+func (c *forecastCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, addr, t := forecastInterval, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	point, err := StationPoint(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	forecast, err := RetrieveForecast(ctx, point, addr, t)
+	if err != nil {
+		return err
+	}
+
+	updateForecastMetrics(config.ID, forecast, time.Now())
+	c.Done(config.ID)
+	return nil
+}
+
+// ForecastResponse is the json structure returned by the national weather
+// service forecast apis.
+type ForecastResponse struct {
+	Properties struct {
+		UpdateTime time.Time        `json:"updateTime"`
+		Periods    []ForecastPeriod `json:"periods"`
+	} `json:"properties"`
+}
+
+// ForecastPeriod is a single period of a forecast, such as "Tonight" in the
+// daily forecast or a single hour of the hourly forecast.
+type ForecastPeriod struct {
+	Number                     int          `json:"number"`
+	Name                       string       `json:"name"`
+	StartTime                  time.Time    `json:"startTime"`
+	EndTime                    time.Time    `json:"endTime"`
+	IsDaytime                  bool         `json:"isDaytime"`
+	Temperature                *float64     `json:"temperature"`
+	TemperatureUnit            string       `json:"temperatureUnit"`
+	ProbabilityOfPrecipitation *Measurement `json:"probabilityOfPrecipitation"`
+	RelativeHumidity           *Measurement `json:"relativeHumidity"`
+	Dewpoint                   *Measurement `json:"dewpoint"`
+	WindSpeed                  string       `json:"windSpeed"`
+	WindDirection              string       `json:"windDirection"`
+	ShortForecast              string       `json:"shortForecast"`
+}
+
+// RetrieveForecast retrieves the daily forecast of the grid covering point.
+func RetrieveForecast(ctx context.Context, point PointResponse, address string, timeout int) (ForecastResponse, error) {
+	return retrieveForecast(ctx, point, "forecast", address, timeout)
+}
+
+// RetrieveHourlyForecast retrieves the hourly forecast of the grid covering
+// point.
+func RetrieveHourlyForecast(ctx context.Context, point PointResponse, address string, timeout int) (ForecastResponse, error) {
+	return retrieveForecast(ctx, point, "forecast/hourly", address, timeout)
+}
+
+func retrieveForecast(ctx context.Context, point PointResponse, endpoint string, address string, timeout int) (ForecastResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path: fmt.Sprintf("/gridpoints/%s/%d,%d/%s",
+			point.Properties.GridID, point.Properties.GridX, point.Properties.GridY, endpoint),
+	}
+
+	response := ForecastResponse{}
+	_, err := retrieve(ctx, requestURL, timeout, &response)
+	return response, err
+}
+
+// TemperatureCelsius returns the forecast temperature of the period in
+// celsius, reporting whether the period has one.
+func (p ForecastPeriod) TemperatureCelsius() (float64, bool) {
+	if p.Temperature == nil {
+		return 0, false
+	}
+	m := &Measurement{Value: p.Temperature, UnitCode: "deg" + p.TemperatureUnit}
+	if err := Normalize(m, Temperature); err != nil {
+		return 0, false
+	}
+	return *m.Value, true
+}
+
+var forecastWindSpeedRE = regexp.MustCompile(`^(\d+)(?:\s+to\s+(\d+))?\s*(mph|km/h|kt)$`)
+
+// forecastWindUnits maps the units of forecast wind speeds to unit codes.
+var forecastWindUnits = map[string]string{
+	"mph":  "mi_h-1",
+	"km/h": "km_h-1",
+	"kt":   "kt",
+}
+
+// WindSpeedKilometersPerHour returns the forecast wind speed of the period in
+// kilometers per hour, the upper end when a range such as "10 to 15 mph" is
+// forecast, reporting whether the period has one.
+func (p ForecastPeriod) WindSpeedKilometersPerHour() (float64, bool) {
+	match := forecastWindSpeedRE.FindStringSubmatch(strings.TrimSpace(p.WindSpeed))
+	if match == nil {
+		return 0, false
+	}
+	speed := match[1]
+	if match[2] != "" {
+		speed = match[2]
+	}
+	v, _ := strconv.ParseFloat(speed, 64)
+	m := &Measurement{Value: &v, UnitCode: forecastWindUnits[match[3]]}
+	if err := Normalize(m, Speed); err != nil {
+		return 0, false
+	}
+	return *m.Value, true
+}
+
+// WindDirectionDegrees returns the forecast compass wind direction of the
+// period in degrees, reporting whether the period has one.
+func (p ForecastPeriod) WindDirectionDegrees() (float64, bool) {
+	for i, point := range compassPoints {
+		if point == p.WindDirection {
+			return float64(i) * 360 / float64(len(compassPoints)), true
+		}
+	}
+	return 0, false
+}
+
+// dayOffset returns the number of days between now and start, in the time
+// zone of start, so periods starting later today are 0 and tomorrow's are 1.
+func dayOffset(start, now time.Time) int {
+	now = now.In(start.Location())
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return int(startDay.Sub(today).Hours() / 24)
+}
+
+// updateForecastMetrics replaces the station's forecast series with the
+// periods of the forecast.
+func updateForecastMetrics(station string, forecast ForecastResponse, now time.Time) {
+	labels := prometheus.Labels{"station": station}
+	for _, vec := range []*prometheus.GaugeVec{
+		forecastTemperatureHigh, forecastTemperatureLow,
+		forecastPrecipitationProbability, forecastWindSpeed, forecastWindDirection,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+
+	if !forecast.Properties.UpdateTime.IsZero() {
+		forecastUpdated.WithLabelValues(station).Set(float64(forecast.Properties.UpdateTime.Unix()))
+	}
+	for _, period := range forecast.Properties.Periods {
+		if !period.EndTime.After(now) {
+			continue
+		}
+		name := strings.ToLower(period.Name)
+		offset := strconv.Itoa(dayOffset(period.StartTime, now))
+
+		if t, ok := period.TemperatureCelsius(); ok {
+			if period.IsDaytime {
+				forecastTemperatureHigh.WithLabelValues(station, name, offset).Set(t)
+			} else {
+				forecastTemperatureLow.WithLabelValues(station, name, offset).Set(t)
+			}
+		}
+		if pop, ok := value(period.ProbabilityOfPrecipitation); ok {
+			forecastPrecipitationProbability.WithLabelValues(station, name, offset).Set(pop)
+		}
+		if speed, ok := period.WindSpeedKilometersPerHour(); ok {
+			forecastWindSpeed.WithLabelValues(station, name, offset).Set(speed)
+		}
+		if direction, ok := period.WindDirectionDegrees(); ok {
+			forecastWindDirection.WithLabelValues(station, name, offset).Set(direction)
+		}
+	}
+}
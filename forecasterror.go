@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	forecastTemperatureError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_temperature_error_celsius",
+			Help: "hourly forecast temperature of the latest observation's hour minus the observed temperature in celsius, by how long before the hour it was forecast",
+		},
+		[]string{"station", "lead_time"},
+	)
+	forecastDewpointError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_dewpoint_error_celsius",
+			Help: "hourly forecast dewpoint of the latest observation's hour minus the observed dewpoint in celsius, by how long before the hour it was forecast",
+		},
+		[]string{"station", "lead_time"},
+	)
+	forecastWindSpeedError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_wind_speed_error_kilometers_per_hour",
+			Help: "hourly forecast wind speed of the latest observation's hour minus the observed wind speed in kilometers per hour, by how long before the hour it was forecast",
+		},
+		[]string{"station", "lead_time"},
+	)
+)
+
+// forecastLeadTimes are how long before an hour its forecast is kept to be
+// compared with the hour's observations.
+var forecastLeadTimes = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// forecastErrors are the forecast values compared with the observations.
+var forecastErrors = []struct {
+	gauge    *prometheus.GaugeVec
+	forecast func(ForecastPeriod) (float64, bool)
+	observed func(ObservationResponse) (float64, bool)
+}{
+	{
+		forecastTemperatureError,
+		ForecastPeriod.TemperatureCelsius,
+		func(r ObservationResponse) (float64, bool) { return value(r.Properties.Temperature) },
+	},
+	{
+		forecastDewpointError,
+		func(p ForecastPeriod) (float64, bool) { return value(p.Dewpoint) },
+		func(r ObservationResponse) (float64, bool) { return value(r.Properties.Dewpoint) },
+	},
+	{
+		forecastWindSpeedError,
+		ForecastPeriod.WindSpeedKilometersPerHour,
+		func(r ObservationResponse) (float64, bool) { return value(r.Properties.WindSpeed) },
+	},
+}
+
+// forecastHistory holds the hourly forecast periods of every station as they
+// were forecast each lead time before they started, keyed by their start.
+var forecastHistory = struct {
+	sync.Mutex
+	periods map[string]map[time.Time]map[time.Duration]ForecastPeriod
+}{periods: map[string]map[time.Time]map[time.Duration]ForecastPeriod{}}
+
+// recordForecast keeps the periods of an hourly forecast retrieved at
+// retrieved starting each lead time later. Only the first forecast of a period
+// at each lead time is kept, as later ones were made closer to it.
+func recordForecast(station string, forecast ForecastResponse, retrieved time.Time) {
+	forecastHistory.Lock()
+	defer forecastHistory.Unlock()
+	periods, ok := forecastHistory.periods[station]
+	if !ok {
+		periods = map[time.Time]map[time.Duration]ForecastPeriod{}
+		forecastHistory.periods[station] = periods
+	}
+	for start := range periods {
+		if retrieved.Sub(start) > 2*time.Hour {
+			delete(periods, start)
+		}
+	}
+
+	for _, lead := range forecastLeadTimes {
+		at := retrieved.Add(lead)
+		for _, period := range forecast.Properties.Periods {
+			if at.Before(period.StartTime) || !at.Before(period.EndTime) {
+				continue
+			}
+			leads, ok := periods[period.StartTime]
+			if !ok {
+				leads = map[time.Duration]ForecastPeriod{}
+				periods[period.StartTime] = leads
+			}
+			if _, ok := leads[lead]; !ok {
+				leads[lead] = period
+			}
+			break
+		}
+	}
+}
+
+// forgetForecasts drops the forecasts kept for the station.
+func forgetForecasts(station string) {
+	forecastHistory.Lock()
+	defer forecastHistory.Unlock()
+	delete(forecastHistory.periods, station)
+}
+
+// updateForecastErrors compares the observation with the forecasts kept for
+// the period it falls in. Lead times without a forecast of the period, such as
+// shortly after the exporter starts, are not exported.
+func updateForecastErrors(station string, response ObservationResponse) {
+	observed := response.Properties.Timestamp
+	leads := map[time.Duration]ForecastPeriod{}
+	forecastHistory.Lock()
+	for start, periodLeads := range forecastHistory.periods[station] {
+		for lead, period := range periodLeads {
+			if !observed.Before(start) && observed.Before(period.EndTime) {
+				leads[lead] = period
+			}
+		}
+	}
+	forecastHistory.Unlock()
+
+	for _, e := range forecastErrors {
+		e.gauge.DeletePartialMatch(prometheus.Labels{"station": station})
+		actual, ok := e.observed(response)
+		if !ok {
+			continue
+		}
+		for lead, period := range leads {
+			if forecast, ok := e.forecast(period); ok {
+				e.gauge.WithLabelValues(station, fmt.Sprintf("%dh", int(lead.Hours()))).Set(forecast - actual)
+			}
+		}
+	}
+}
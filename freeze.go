@@ -0,0 +1,33 @@
+package main
+
+import "time"
+
+func init() {
+	addAccumulation(&Accumulation{
+		Name: "freeze_seconds_total",
+		Help: "seconds the temperature has been below 0 celsius",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			return secondsBelow(response, 0, elapsed)
+		},
+	})
+	addAccumulation(&Accumulation{
+		Name: "hard_freeze_seconds_total",
+		Help: "seconds the temperature has been below -freeze.hard-threshold",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			return secondsBelow(response, hardFreezeThreshold, elapsed)
+		},
+	})
+}
+
+// secondsBelow returns elapsed in seconds when the temperature of the
+// observation is below threshold and zero otherwise.
+func secondsBelow(response ObservationResponse, threshold float64, elapsed time.Duration) (float64, bool) {
+	t, ok := value(response.Properties.Temperature)
+	if !ok {
+		return 0, false
+	}
+	if t < threshold {
+		return elapsed.Seconds(), true
+	}
+	return 0, true
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gridpointElement is a raw forecast grid element that can be exported.
+type gridpointElement struct {
+	quantity Quantity
+	// amount is set for elements forecasting an amount over each period,
+	// such as precipitation, rather than a value holding through it.
+	amount bool
+	gauge  *prometheus.GaugeVec
+}
+
+func newGridpointGauge(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, []string{"station", "hour_offset"})
+}
+
+// gridpointElements are the raw forecast grid elements that can be exported,
+// keyed by their name in the api.
+var gridpointElements = map[string]gridpointElement{
+	"temperature":                {Temperature, false, newGridpointGauge("gridpoint_temperature_celsius", "forecast temperature of each upcoming hour in celsius")},
+	"dewpoint":                   {Temperature, false, newGridpointGauge("gridpoint_dewpoint_celsius", "forecast dewpoint of each upcoming hour in celsius")},
+	"relativeHumidity":           {Percent, false, newGridpointGauge("gridpoint_relative_humidity_percent", "forecast relative humidity of each upcoming hour in percent")},
+	"skyCover":                   {Percent, false, newGridpointGauge("gridpoint_sky_cover_percent", "forecast sky cover of each upcoming hour in percent")},
+	"windSpeed":                  {Speed, false, newGridpointGauge("gridpoint_wind_speed_kilometers_per_hour", "forecast wind speed of each upcoming hour in kilometers per hour")},
+	"windGust":                   {Speed, false, newGridpointGauge("gridpoint_wind_gust_kilometers_per_hour", "forecast wind gust of each upcoming hour in kilometers per hour")},
+	"probabilityOfPrecipitation": {Percent, false, newGridpointGauge("gridpoint_precipitation_probability_percent", "forecast probability of precipitation of each upcoming hour in percent")},
+	"probabilityOfThunder":       {Percent, false, newGridpointGauge("gridpoint_thunder_probability_percent", "forecast probability of thunder of each upcoming hour in percent")},
+	"quantitativePrecipitation":  {Depth, true, newGridpointGauge("gridpoint_quantitative_precipitation_millimeters", "forecast precipitation of each upcoming hour in millimeters")},
+	"snowfallAmount":             {Depth, true, newGridpointGauge("gridpoint_snowfall_amount_millimeters", "forecast snowfall of each upcoming hour in millimeters")},
+	"iceAccumulation":            {Depth, true, newGridpointGauge("gridpoint_ice_accumulation_millimeters", "forecast ice accumulation of each upcoming hour in millimeters")},
+	"hainesIndex":                {Index, false, newGridpointGauge("gridpoint_haines_index", "forecast haines index of each upcoming hour")},
+	"redFlagThreatIndex":         {Index, false, newGridpointGauge("gridpoint_red_flag_threat_index", "forecast red flag threat index of each upcoming hour")},
+	"mixingHeight":               {Distance, false, newGridpointGauge("gridpoint_mixing_height_meters", "forecast mixing height of each upcoming hour in meters")},
+	"transportWindSpeed":         {Speed, false, newGridpointGauge("gridpoint_transport_wind_speed_kilometers_per_hour", "forecast transport wind speed of each upcoming hour in kilometers per hour")},
+}
+
+func init() {
+	names := make([]string, 0, len(gridpointElements))
+	for name := range gridpointElements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var metrics []prometheus.Collector
+	for _, name := range names {
+		metrics = append(metrics, gridpointElements[name].gauge)
+	}
+	registerCollector("gridpoint", false, &gridpointCollector{}, metrics...)
+}
+
+// selectedGridpointElements returns the names of the elements listed in
+// -gridpoint.elements.
+func selectedGridpointElements() ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(gridpointElementNames, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := gridpointElements[name]; !ok {
+			return nil, fmt.Errorf("unknown gridpoint element %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// gridpointCollector exports the raw forecast grid elements listed in
+// -gridpoint.elements for the grid covering a station, retrieved every
+// -forecast.interval.
+type gridpointCollector struct {
+	refreshTracker
+}
+
+func (c *gridpointCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, addr, t := forecastInterval, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	point, err := StationPoint(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	gridpoint, err := RetrieveGridpoint(ctx, point, addr, t)
+	if err != nil {
+		return err
+	}
+
+	configMu.RLock()
+	err = updateGridpointMetrics(config.ID, gridpoint, time.Now())
+	configMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	c.Done(config.ID)
+	return nil
+}
+
+// GridpointLayer is the time series of a single raw forecast element. Each
+// value holds for the ISO 8601 interval of its valid time, such as
+// "2024-06-21T10:00:00+00:00/PT2H".
+type GridpointLayer struct {
+	UOM    string `json:"uom"`
+	Values []struct {
+		ValidTime string   `json:"validTime"`
+		Value     *float64 `json:"value"`
+	} `json:"values"`
+}
+
+// RetrieveGridpoint retrieves the raw forecast data of the grid covering
+// point.
+func RetrieveGridpoint(ctx context.Context, point PointResponse, address string, timeout int) (map[string]GridpointLayer, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path: fmt.Sprintf("/gridpoints/%s/%d,%d",
+			point.Properties.GridID, point.Properties.GridX, point.Properties.GridY),
+	}
+
+	response := struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}{}
+	if _, err := retrieve(ctx, requestURL, timeout, &response); err != nil {
+		return nil, err
+	}
+	// the properties hold metadata about the grid as well as its elements,
+	// which are the properties decoding to a layer with values
+	layers := map[string]GridpointLayer{}
+	for name, raw := range response.Properties {
+		var layer GridpointLayer
+		if err := json.Unmarshal(raw, &layer); err != nil || layer.Values == nil {
+			continue
+		}
+		layers[name] = layer
+	}
+	return layers, nil
+}
+
+var isoDurationRE = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?)?$`)
+
+// ParseValidTime parses an ISO 8601 interval given as a start time and a
+// duration, such as "2024-06-21T10:00:00+00:00/PT2H".
+func ParseValidTime(validTime string) (time.Time, time.Duration, error) {
+	rawStart, rawDuration, ok := strings.Cut(validTime, "/")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid valid time %q", validTime)
+	}
+	start, err := time.Parse(time.RFC3339, rawStart)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid valid time %q: %w", validTime, err)
+	}
+	match := isoDurationRE.FindStringSubmatch(rawDuration)
+	if match == nil || rawDuration == "P" || rawDuration == "PT" {
+		return time.Time{}, 0, fmt.Errorf("invalid duration in valid time %q", validTime)
+	}
+	var duration time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if match[i+1] != "" {
+			n, _ := strconv.Atoi(match[i+1])
+			duration += time.Duration(n) * unit
+		}
+	}
+	return start, duration, nil
+}
+
+// ValueAt returns the value of the layer holding at t in the canonical unit of
+// q, reporting whether the layer has one.
+func (l GridpointLayer) ValueAt(t time.Time, q Quantity) (float64, bool, error) {
+	for _, v := range l.Values {
+		if v.Value == nil {
+			continue
+		}
+		start, duration, err := ParseValidTime(v.ValidTime)
+		if err != nil {
+			return 0, false, err
+		}
+		if t.Before(start) || !t.Before(start.Add(duration)) {
+			continue
+		}
+		m := &Measurement{Value: v.Value, UnitCode: l.UOM}
+		if err := Normalize(m, q); err != nil {
+			return 0, false, err
+		}
+		return *m.Value, true, nil
+	}
+	return 0, false, nil
+}
+
+// updateGridpointMetrics replaces the station's gridpoint series with the
+// upcoming -forecast.hours hours of each selected element. Values holding for
+// several hours are exported for each of them, while amounts are spread
+// evenly over their hours.
+func updateGridpointMetrics(station string, layers map[string]GridpointLayer, now time.Time) error {
+	names, err := selectedGridpointElements()
+	if err != nil {
+		return err
+	}
+
+	labels := prometheus.Labels{"station": station}
+	for _, element := range gridpointElements {
+		element.gauge.DeletePartialMatch(labels)
+	}
+
+	hour := now.Truncate(time.Hour)
+	for _, name := range names {
+		element := gridpointElements[name]
+		layer, ok := layers[name]
+		if !ok {
+			continue
+		}
+		for _, v := range layer.Values {
+			if v.Value == nil {
+				continue
+			}
+			start, duration, err := ParseValidTime(v.ValidTime)
+			if err != nil {
+				return err
+			}
+			m := &Measurement{Value: v.Value, UnitCode: layer.UOM}
+			if err := Normalize(m, element.quantity); err != nil {
+				return fmt.Errorf("gridpoint element %s: %w", name, err)
+			}
+
+			hours := int(duration / time.Hour)
+			if hours < 1 {
+				hours = 1
+			}
+			value := *m.Value
+			if element.amount {
+				value /= float64(hours)
+			}
+			for h := 0; h < hours; h++ {
+				offset := int(start.Add(time.Duration(h)*time.Hour).Sub(hour) / time.Hour)
+				if offset < 0 || offset >= forecastHours {
+					continue
+				}
+				element.gauge.WithLabelValues(station, strconv.Itoa(offset)).Set(value)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseValidTime(t *testing.T) {
+	start := time.Date(2024, 6, 21, 10, 0, 0, 0, time.UTC)
+	for validTime, want := range map[string]time.Duration{
+		"2024-06-21T10:00:00+00:00/PT1H":     time.Hour,
+		"2024-06-21T10:00:00+00:00/PT2H30M":  150 * time.Minute,
+		"2024-06-21T10:00:00+00:00/P1D":      24 * time.Hour,
+		"2024-06-21T10:00:00+00:00/P2DT6H":   54 * time.Hour,
+		"2024-06-21T06:00:00-04:00/PT45M":    45 * time.Minute,
+		"2024-06-21T10:00:00+00:00/P1DT1H1M": 25*time.Hour + time.Minute,
+	} {
+		gotStart, got, err := ParseValidTime(validTime)
+		if err != nil {
+			t.Errorf("ParseValidTime(%q) failed: %v", validTime, err)
+			continue
+		}
+		if !gotStart.Equal(start) || got != want {
+			t.Errorf("ParseValidTime(%q) = %v, %v, want %v, %v", validTime, gotStart, got, start, want)
+		}
+	}
+
+	for _, validTime := range []string{
+		"",
+		"2024-06-21T10:00:00+00:00",
+		"2024-06-21T10:00:00+00:00/",
+		"2024-06-21T10:00:00+00:00/P",
+		"2024-06-21T10:00:00+00:00/PT",
+		"2024-06-21T10:00:00+00:00/PT1S",
+		"2024-06-21T10:00:00+00:00/1H",
+		"tomorrow/PT1H",
+	} {
+		if _, _, err := ParseValidTime(validTime); err == nil {
+			t.Errorf("ParseValidTime(%q) succeeded, want an error", validTime)
+		}
+	}
+}
+
+func TestGridpointLayerValueAt(t *testing.T) {
+	var layer GridpointLayer
+	err := json.Unmarshal([]byte(`{
+		"uom": "wmoUnit:degF",
+		"values": [
+			{"validTime": "2024-06-21T10:00:00+00:00/PT2H", "value": 68},
+			{"validTime": "2024-06-21T12:00:00+00:00/PT1H", "value": null}
+		]
+	}`), &layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, minute int) time.Time { return time.Date(2024, 6, 21, hour, minute, 0, 0, time.UTC) }
+
+	// values are converted to the canonical unit of the quantity
+	want := 20.0
+	if v, ok, err := layer.ValueAt(at(11, 59), Temperature); err != nil || !ok || !sameValue(&v, &want) {
+		t.Errorf("ValueAt within the first value = %v, %v, %v, want %v", v, ok, err, want)
+	}
+	// the end of a valid time belongs to the next one, here without a value
+	if _, ok, err := layer.ValueAt(at(12, 0), Temperature); err != nil || ok {
+		t.Errorf("ValueAt a missing value = %v, %v, want no value", ok, err)
+	}
+	if _, ok, _ := layer.ValueAt(at(9, 0), Temperature); ok {
+		t.Error("ValueAt before the first value has a value")
+	}
+	if _, _, err := layer.ValueAt(at(10, 0), Speed); err == nil {
+		t.Error("ValueAt of a temperature as a speed succeeded, want an error")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// started and fetched are set to 1 once the exporter has loaded its
+// configuration and started its stations, and once a request upstream has
+// succeeded. started is set back to 0 when shutting down.
+var started, fetched int32
+
+// HealthHandler answers /healthz, reporting that the exporter is alive
+// whenever it is able to serve requests.
+type HealthHandler struct{}
+
+func (HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ReadyHandler answers /readyz, reporting that the exporter is ready once it
+// has started its stations and a request upstream has succeeded, so the
+// series it serves hold data. An exporter without stations of its own, only
+// answering /probe, is ready once started.
+type ReadyHandler struct {
+	Manager *StationManager
+}
+
+func (h ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case atomic.LoadInt32(&started) == 0:
+		http.Error(w, "not ready: starting up or shutting down", http.StatusServiceUnavailable)
+	case atomic.LoadInt32(&fetched) == 0 && len(h.Manager.Stations()) != 0:
+		http.Error(w, "not ready: no successful request upstream yet", http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
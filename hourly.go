@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hourlyForecastTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hourly_forecast_temperature_celsius",
+			Help: "forecast temperature of each upcoming hour in celsius",
+		},
+		[]string{"station", "hour_offset"},
+	)
+	hourlyForecastPrecipitationProbability = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hourly_forecast_precipitation_probability_percent",
+			Help: "forecast probability of precipitation of each upcoming hour in percent",
+		},
+		[]string{"station", "hour_offset"},
+	)
+	hourlyForecastWindSpeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hourly_forecast_wind_speed_kilometers_per_hour",
+			Help: "forecast wind speed of each upcoming hour in kilometers per hour",
+		},
+		[]string{"station", "hour_offset"},
+	)
+	hourlyForecastHumidity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hourly_forecast_humidity_percent",
+			Help: "forecast relative humidity of each upcoming hour in percent",
+		},
+		[]string{"station", "hour_offset"},
+	)
+)
+
+func init() {
+	registerCollector("hourly_forecast", false, &hourlyForecastCollector{},
+		hourlyForecastTemperature, hourlyForecastPrecipitationProbability,
+		hourlyForecastWindSpeed, hourlyForecastHumidity,
+		forecastTemperatureError, forecastDewpointError, forecastWindSpeedError)
+}
+
+// hourlyForecastCollector exports the next -forecast.hours hours of the hourly
+// forecast of the grid covering a station, retrieved every -forecast.interval.
+// The forecasts are kept to export their error once the hours are observed.
+type hourlyForecastCollector struct {
+	refreshTracker
+}
+
+func (c *hourlyForecastCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, addr, t := forecastInterval, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	point, err := StationPoint(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	forecast, err := RetrieveHourlyForecast(ctx, point, addr, t)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	configMu.RLock()
+	updateHourlyForecastMetrics(config.ID, forecast, now)
+	configMu.RUnlock()
+	recordForecast(config.ID, forecast, now)
+	c.Done(config.ID)
+	return nil
+}
+
+// Forget also drops the forecasts kept to compare with the station's
+// observations.
+func (c *hourlyForecastCollector) Forget(station string) {
+	c.refreshTracker.Forget(station)
+	forgetForecasts(station)
+}
+
+// updateHourlyForecastMetrics replaces the station's hourly forecast series
+// with the hours of the forecast, labelled by the number of hours from the
+// current hour they start at.
+func updateHourlyForecastMetrics(station string, forecast ForecastResponse, now time.Time) {
+	labels := prometheus.Labels{"station": station}
+	for _, vec := range []*prometheus.GaugeVec{
+		hourlyForecastTemperature, hourlyForecastPrecipitationProbability,
+		hourlyForecastWindSpeed, hourlyForecastHumidity,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+
+	hour := now.Truncate(time.Hour)
+	for _, period := range forecast.Properties.Periods {
+		if !period.EndTime.After(now) {
+			continue
+		}
+		offset := int(period.StartTime.Sub(hour) / time.Hour)
+		if offset < 0 {
+			offset = 0
+		}
+		if offset >= forecastHours {
+			break
+		}
+		label := strconv.Itoa(offset)
+
+		if t, ok := period.TemperatureCelsius(); ok {
+			hourlyForecastTemperature.WithLabelValues(station, label).Set(t)
+		}
+		if pop, ok := value(period.ProbabilityOfPrecipitation); ok {
+			hourlyForecastPrecipitationProbability.WithLabelValues(station, label).Set(pop)
+		}
+		if speed, ok := period.WindSpeedKilometersPerHour(); ok {
+			hourlyForecastWindSpeed.WithLabelValues(station, label).Set(speed)
+		}
+		if humidity, ok := value(period.RelativeHumidity); ok {
+			hourlyForecastHumidity.WithLabelValues(station, label).Set(humidity)
+		}
+	}
+}
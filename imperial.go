@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newImperialGauge returns a gauge of a station's observation in imperial
+// units, exported only with -units=imperial or -units=both.
+func newImperialGauge(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, []string{"station"})
+}
+
+var (
+	temperatureFahrenheit               = newImperialGauge("temperature_fahrenheit", "temperature in fahrenheit")
+	dewpointFahrenheit                  = newImperialGauge("dewpoint_fahrenheit", "dewpoint in fahrenheit")
+	heatIndexFahrenheit                 = newImperialGauge("heat_index_fahrenheit", "heat index in fahrenheit, only reported in warm weather")
+	windChillFahrenheit                 = newImperialGauge("wind_chill_fahrenheit", "wind chill in fahrenheit, only reported in cold weather")
+	maxTemperatureLast24HoursFahrenheit = newImperialGauge("temperature_max_last_24_hours_fahrenheit", "maximum temperature over the last 24 hours in fahrenheit, as of the last daily report")
+	minTemperatureLast24HoursFahrenheit = newImperialGauge("temperature_min_last_24_hours_fahrenheit", "minimum temperature over the last 24 hours in fahrenheit, as of the last daily report")
+	windSpeedMilesPerHour               = newImperialGauge("wind_speed_miles_per_hour", "wind speed in miles per hour")
+	windGustMilesPerHour                = newImperialGauge("wind_gust_miles_per_hour", "wind gust in miles per hour")
+	barometricPressureInchesOfMercury   = newImperialGauge("barometric_pressure_inches_of_mercury", "barometric pressure in inches of mercury")
+	sealevelPressureInchesOfMercury     = newImperialGauge("sealevel_pressure_inches_of_mercury", "sealevel pressure in inches of mercury")
+	visibilityMiles                     = newImperialGauge("visibility_miles", "visibility in miles")
+	precipitationLastHourInches         = newImperialGauge("precipitation_last_hour_inches", "precipitation over the last hour in inches")
+	precipitationLast3HoursInches       = newImperialGauge("precipitation_last_3_hours_inches", "precipitation over the last 3 hours in inches")
+	precipitationLast6HoursInches       = newImperialGauge("precipitation_last_6_hours_inches", "precipitation over the last 6 hours in inches")
+	apparentTemperatureFahrenheit       = newImperialGauge("apparent_temperature_fahrenheit", "temperature it feels like in fahrenheit")
+	wetBulbTemperatureFahrenheit        = newImperialGauge("wet_bulb_temperature_fahrenheit", "wet bulb temperature in fahrenheit")
+	dewpointDepressionFahrenheit        = newImperialGauge("dewpoint_depression_fahrenheit", "difference between the temperature and the dewpoint in fahrenheit")
+	pressureAltitudeFeet                = newImperialGauge("pressure_altitude_feet", "altitude in the standard atmosphere of the pressure at the station in feet")
+	densityAltitudeFeet                 = newImperialGauge("density_altitude_feet", "altitude in the standard atmosphere of the air density at the station in feet")
+	pressureTendencyInchesOfMercury     = newImperialGauge("pressure_tendency_inches_of_mercury", "change in barometric pressure over the last 3 hours in inches of mercury")
+	estimatedCloudBaseFeet              = newImperialGauge("estimated_cloud_base_feet", "estimated base of cumulus clouds above the station in feet, from the dewpoint depression")
+	wetBulbGlobeTemperatureFahrenheit   = newImperialGauge("wet_bulb_globe_temperature_fahrenheit", "estimated wet bulb globe temperature in fahrenheit, a measure of heat stress")
+)
+
+// imperialGauge is the imperial counterpart of a gauge exported in metric
+// units, along with the conversion from the metric unit.
+type imperialGauge struct {
+	gauge   *prometheus.GaugeVec
+	convert func(float64) float64
+}
+
+func celsiusToFahrenheit(c float64) float64 { return c*9/5 + 32 }
+
+// imperialGauges maps each metric gauge with an imperial counterpart to it.
+var imperialGauges = map[*prometheus.GaugeVec]imperialGauge{
+	temperature:               {temperatureFahrenheit, celsiusToFahrenheit},
+	dewpoint:                  {dewpointFahrenheit, celsiusToFahrenheit},
+	heatindex:                 {heatIndexFahrenheit, celsiusToFahrenheit},
+	windchill:                 {windChillFahrenheit, celsiusToFahrenheit},
+	maxTemperatureLast24Hours: {maxTemperatureLast24HoursFahrenheit, celsiusToFahrenheit},
+	minTemperatureLast24Hours: {minTemperatureLast24HoursFahrenheit, celsiusToFahrenheit},
+	windspeed:                 {windSpeedMilesPerHour, scale(1 / 1.609344)},
+	windgust:                  {windGustMilesPerHour, scale(1 / 1.609344)},
+	barometricpressure:        {barometricPressureInchesOfMercury, scale(1 / 3386.389)},
+	sealevelpressure:          {sealevelPressureInchesOfMercury, scale(1 / 3386.389)},
+	visibility:                {visibilityMiles, scale(1 / 1609.344)},
+	precipitationLastHour:     {precipitationLastHourInches, scale(1 / 25.4)},
+	precipitationLast3Hours:   {precipitationLast3HoursInches, scale(1 / 25.4)},
+	precipitationLast6Hours:   {precipitationLast6HoursInches, scale(1 / 25.4)},
+	apparentTemperature:       {apparentTemperatureFahrenheit, celsiusToFahrenheit},
+	wetBulbTemperature:        {wetBulbTemperatureFahrenheit, celsiusToFahrenheit},
+	wetBulbGlobeTemperature:   {wetBulbGlobeTemperatureFahrenheit, celsiusToFahrenheit},
+	dewpointDepression:        {dewpointDepressionFahrenheit, scale(9.0 / 5)},
+	pressureAltitude:          {pressureAltitudeFeet, scale(1 / 0.3048)},
+	estimatedCloudBase:        {estimatedCloudBaseFeet, scale(1 / 0.3048)},
+	pressureTendency:          {pressureTendencyInchesOfMercury, scale(1 / 3386.389)},
+	densityAltitude:           {densityAltitudeFeet, scale(1 / 0.3048)},
+}
+
+// exportedInUnits reports whether metric is exported with the -units system.
+// Gauges in metric units with an imperial counterpart are only exported with
+// metric or both, and their counterparts only with imperial or both. Every
+// other metric is always exported.
+func exportedInUnits(metric prometheus.Collector) bool {
+	if gauge, ok := metric.(*prometheus.GaugeVec); ok {
+		if _, ok := imperialGauges[gauge]; ok {
+			return unitSystem != "imperial"
+		}
+		for _, imperial := range imperialGauges {
+			if imperial.gauge == gauge {
+				return unitSystem != "metric"
+			}
+		}
+	}
+	return true
+}
+
+// setGauge sets the station's series of a gauge in metric units along with
+// that of its imperial counterpart, if it has one.
+func setGauge(gauge *prometheus.GaugeVec, station string, value float64) {
+	gauge.WithLabelValues(station).Set(value)
+	if imperial, ok := imperialGauges[gauge]; ok {
+		imperial.gauge.WithLabelValues(station).Set(imperial.convert(value))
+	}
+}
+
+// deleteGauge deletes the station's series of a gauge in metric units along
+// with that of its imperial counterpart, if it has one.
+func deleteGauge(gauge *prometheus.GaugeVec, station string) {
+	gauge.DeleteLabelValues(station)
+	if imperial, ok := imperialGauges[gauge]; ok {
+		imperial.gauge.DeleteLabelValues(station)
+	}
+}
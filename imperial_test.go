@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestImperialConversions(t *testing.T) {
+	tests := []struct {
+		metric  float64
+		convert func(float64) float64
+		want    float64
+	}{
+		{0, celsiusToFahrenheit, 32},
+		{100, celsiusToFahrenheit, 212},
+		{-40, celsiusToFahrenheit, -40},
+		{1.609344, imperialGauges[windspeed].convert, 1},
+		{3386.389, imperialGauges[barometricpressure].convert, 1},
+		{1609.344, imperialGauges[visibility].convert, 1},
+		{25.4, imperialGauges[precipitationLastHour].convert, 1},
+		{0.3048, imperialGauges[pressureAltitude].convert, 1},
+		// a difference of temperatures is scaled without an offset
+		{5, imperialGauges[dewpointDepression].convert, 9},
+	}
+
+	for i, test := range tests {
+		if got := test.convert(test.metric); !sameValue(&got, &test.want) {
+			t.Errorf("conversion %d of %v = %v, want %v", i, test.metric, got, test.want)
+		}
+	}
+}
+
+func TestExportedInUnits(t *testing.T) {
+	defer func(units string) { unitSystem = units }(unitSystem)
+
+	for units, want := range map[string][2]bool{
+		"metric":   {true, false},
+		"imperial": {false, true},
+		"both":     {true, true},
+	} {
+		unitSystem = units
+		if got := exportedInUnits(temperature); got != want[0] {
+			t.Errorf("with -units %s, temperature exported = %v, want %v", units, got, want[0])
+		}
+		if got := exportedInUnits(temperatureFahrenheit); got != want[1] {
+			t.Errorf("with -units %s, temperature in fahrenheit exported = %v, want %v", units, got, want[1])
+		}
+		if !exportedInUnits(stationUp) {
+			t.Errorf("with -units %s, nws_up is not exported", units)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+)
+
+var landingTemplate = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"interval": StationConfig.interval,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>NWS Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>NWS Exporter</h1>
+<p>Version {{.Version}}, commit {{.Commit}}, built {{.BuildDate}}</p>
+<ul>
+{{range .Links}}<li><a href="{{.Path}}">{{.Path}}</a> {{.Description}}</li>
+{{end}}</ul>
+<h2>Stations</h2>
+{{if .Stations}}<table>
+<tr><th>Station</th><th>Name</th><th>Type</th><th>Interval</th><th></th></tr>
+{{range .Stations}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.Type}}</td><td>{{interval .}}</td><td><a href="/probe?station={{.ID}}">probe</a> <a href="/api/v1/current?station={{.ID}}">current conditions</a></td></tr>
+{{end}}</table>
+{{else}}<p>No stations are being scraped.</p>
+{{end}}</body>
+</html>
+`))
+
+// landingLink is a link on the landing page to another endpoint of the
+// exporter.
+type landingLink struct {
+	Path        string
+	Description string
+}
+
+// LandingHandler serves an html page at / linking to the other endpoints and
+// listing the version of the exporter and the stations it scrapes, each linked
+// to its probe and current conditions, for a quick check in a browser. Other paths not handled elsewhere are not found.
+type LandingHandler struct {
+	Manager *StationManager
+	Links   []landingLink
+}
+
+func (h LandingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	landingTemplate.Execute(w, struct {
+		Version, Commit, BuildDate string
+		Links                      []landingLink
+		Stations                   []StationConfig
+	}{version, commit, buildDate, h.Links, h.Manager.Stations()})
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,170 +15,514 @@ import (
 )
 
 var (
-	station              string
-	address              string
-	help                 bool
-	verbose              bool
-	timeout, backofftime int
-	failfast             bool
-	localaddr            string
-
-	humidity = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "humidity",
-		Help:      "humidity gauge percentage",
-	})
-	temperature = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "temperature",
-		Help:      "temperature in celsius",
-	})
-	dewpoint = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "dewpoint",
-		Help:      "dewpoint in celsius",
-	})
-	winddirection = prometheus.NewGaugeVec(
+	station                 string
+	stations                string
+	address                 = "api.weather.gov"
+	help                    bool
+	showVersion             bool
+	verbose                 bool
+	timeout, backofftime    int
+	failfast                bool
+	localaddr               string
+	shutdownTimeout         time.Duration
+	enableDebug             bool
+	systemdSocket           bool
+	debugAddress            string
+	adminAddress            string
+	enableLifecycle         bool
+	accessLog               bool
+	latlon                  string
+	nearest                 int
+	nearestMaxAge           time.Duration
+	stationsFile            string
+	stationsFilePoll        time.Duration
+	adminTokenFile          string
+	stagger                 bool
+	jitter                  float64
+	maxConcurrentFetches    int
+	requestsPerMinute       float64
+	requestsBurst           int
+	requestRetries          int
+	requestRetryDelay       time.Duration
+	validate                bool
+	validateMaxAge          time.Duration
+	staleAfter              time.Duration
+	configFile              string
+	tlsCertFile             string
+	tlsKeyFile              string
+	webConfigFile           string
+	namespace               string
+	constLabels             = labelsFlag{}
+	metricsInclude          string
+	metricsExclude          string
+	metricsLegacyNames      bool
+	telemetryPath           string
+	disableExporterMetrics  bool
+	scrapeInterval          time.Duration
+	errorBackoff            time.Duration
+	errorBackoffMultiplier  float64
+	errorBackoffMax         time.Duration
+	errorBackoffJitter      float64
+	degradedAfter           int
+	circuitBreakerFailures  int
+	circuitBreakerCooldown  time.Duration
+	qcReject                string
+	unitSystem              string
+	windDirectionComponents bool
+	windCardinalPoints      int
+	wbgtSolar               bool
+	fogMaxSpread            float64
+	fogMaxWind              float64
+	pressureSteadyThreshold float64
+	gddBase                 float64
+	gddCap                  float64
+	stateFile               string
+	heatingBase             float64
+	coolingBase             float64
+	hardFreezeThreshold     float64
+	runways                 = &headingsFlag{}
+	addresses               = &hostsFlag{hosts: []string{"api.weather.gov"}}
+	forecastInterval        time.Duration
+	forecastHours           int
+	gridpointElementNames   string
+	alertsInterval          time.Duration
+	alertZones              string
+	alertsWebhookURL        string
+	alertsWebhookRetries    int
+	alertmanagerURL         string
+	alertmanagerLabels      string
+	alertmanagerAnnotations string
+	aviationAddress         string
+	aviationRegion          string
+	aviationInterval        time.Duration
+	productTypes            string
+	productsOffice          string
+	productsInterval        time.Duration
+	marineZones             string
+	buoyAddress             string
+	riverGauges             string
+	riverAddress            string
+	riverInterval           time.Duration
+	tidesAddress            string
+	tidesDatum              string
+	tidesInterval           time.Duration
+	spcAddress              string
+	spcInterval             time.Duration
+	tropicalAddress         string
+	tropicalInterval        time.Duration
+	airnowAddress           string
+	airnowAPIKeyFile        string
+	airnowInterval          time.Duration
+	normalsAddress          string
+
+	nearestRank = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nearest_rank",
+			Help: "distance rank of the station supplying data in -nearest mode, 1 being the nearest",
+		},
+		[]string{"station"},
+	)
+	stationInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "station_info",
+			Help: "configured name of the station, always 1",
+		},
+		[]string{"station", "name"},
+	)
+	stationBackingOff = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "station_backing_off",
+			Help: "1 while the station is waiting to retry after a failed scrape, 0 otherwise",
+		},
+		[]string{"station"},
+	)
+	stationBackoff = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "station_backoff_seconds",
+			Help: "time the station is waiting before retrying after a failed scrape in seconds, 0 when its latest scrape succeeded",
+		},
+		[]string{"station"},
+	)
+	consecutiveFailures = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "station_consecutive_failures",
+			Help: "number of scrapes of the station that failed in a row since its latest successful scrape",
+		},
+		[]string{"station"},
+	)
+	stationDegraded = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "station_degraded",
+			Help: "1 when at least -degraded-after scrapes of the station failed in a row, 0 otherwise",
+		},
+		[]string{"station"},
+	)
+	scrapeRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scrape_retries_total",
+			Help: "number of scrapes of the station retrying a failed scrape",
+		},
+		[]string{"station"},
+	)
+	stationUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "up",
+			Help: "1 when the latest scrape of the station succeeded, 0 when it failed",
+		},
+		[]string{"station"},
+	)
+	lastSuccessfulScrape = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "last_successful_scrape_timestamp_seconds",
+			Help: "time of the latest successful scrape of the station as a unix timestamp",
+		},
+		[]string{"station"},
+	)
+	scrapeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scrape_duration_seconds",
+			Help:    "time taken to run every collector for the station in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+		},
+		[]string{"station"},
+	)
+	scrapeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scrape_errors_total",
+			Help: "number of failed updates of the station by each collector by class of error",
+		},
+		[]string{"station", "collector", "class"},
+	)
+	scrapeCollectorSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scrape_collector_success",
+			Help: "1 when the latest update of the station by each collector succeeded, 0 when it failed",
+		},
+		[]string{"station", "collector"},
+	)
+	collectorUp = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace: "nws",
-			Name:      "wind_direction",
-			Help:      "wind direction in degrees",
-		},
-		[]string{"Direction"},
-	)
-	windspeed = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "wind_speed",
-		Help:      "wind speed in kilometers per hour",
-	})
-	barometricpressure = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "barometric_pressure",
-		Help:      "barometric pressure in pascals",
-	})
-	sealevelpressure = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "sealevel_pressure",
-		Help:      "sealevel pressure in pascals",
-	})
-	visibility = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "visibility",
-		Help:      "visibility in meters",
-	})
-	timeSinceUpdate = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "nws",
-		Name:      "time_since_update",
-		Help:      "sesconds since last nws update",
-	})
+			Name: "collector_up",
+			Help: "1 when the latest run of a collector not tied to any station succeeded, 0 when it failed",
+		},
+		[]string{"collector"},
+	)
+	collectorErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_errors_total",
+			Help: "number of failed runs of each collector not tied to any station by class of error",
+		},
+		[]string{"collector", "class"},
+	)
+	apiResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_responses_total",
+			Help: "number of responses from upstream apis by host and status code",
+		},
+		[]string{"host", "code"},
+	)
+	responseBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_response_bytes_total",
+			Help: "number of bytes of response bodies received from upstream apis by host and endpoint",
+		},
+		[]string{"host", "endpoint"},
+	)
+	requestRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_request_retries_total",
+			Help: "number of failed requests to upstream apis retried within the same scrape by host and endpoint",
+		},
+		[]string{"host", "endpoint"},
+	)
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "upstream_request_duration_seconds",
+			Help:    "time taken by requests to upstream apis in seconds, from sending the request to reading the whole response",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host", "endpoint"},
+	)
 )
 
 func init() {
+	flag.StringVar(&configFile, "config", "", "yaml configuration file, flags given on the command line take precedence over its values")
 	flag.StringVar(&station, "station", "KPHL", "nws address")
+	flag.StringVar(&stations, "stations", "", "comma separated list of nws stations as ID[:interval][=name], overrides -station")
+	flag.StringVar(&stationsFile, "stations-file", "", "file listing one nws station per line as ID[:interval][=name], reloaded when it changes")
+	flag.DurationVar(&stationsFilePoll, "stations-file-poll", 30*time.Second, "how often to check -stations-file for changes")
+	flag.StringVar(&latlon, "latlon", "", "latitude,longitude to find the nearest station for, overrides -station")
+	flag.IntVar(&nearest, "nearest", 1, "number of stations nearest to -latlon to monitor, falling back to the next nearest when one stops reporting")
+	flag.DurationVar(&nearestMaxAge, "nearest-max-age", 3*time.Hour, "observation age after which a -nearest station is considered to have stopped reporting")
+	flag.StringVar(&adminTokenFile, "admin-token-file", "", "file holding the bearer token for the /api/v1/stations admin api, the api is disabled when unset")
 	flag.StringVar(&localaddr, "localaddr", ":8080", "The address to listen on for HTTP requests")
-	flag.StringVar(&address, "addr", "api.weather.gov", "nws address")
+	flag.StringVar(&tlsCertFile, "tls.cert-file", "", "certificate to serve HTTPS with, requires -tls.key-file")
+	flag.StringVar(&tlsKeyFile, "tls.key-file", "", "private key of -tls.cert-file")
+	flag.BoolVar(&systemdSocket, "web.systemd-socket", false, "listen on the sockets passed by systemd socket activation instead of -localaddr")
+	flag.BoolVar(&accessLog, "web.access-log", false, "log every request served with its path, status, duration and remote address")
+	flag.StringVar(&adminAddress, "web.admin-address", "", "address to serve the admin api, /-/reload, /-/refresh, /healthz, /readyz and debug endpoints on instead of -localaddr")
+	flag.BoolVar(&enableLifecycle, "web.enable-lifecycle", false, "serve /-/reload and /-/refresh on -localaddr, where anyone able to scrape the exporter can call them, when -web.admin-address is not set")
+	flag.BoolVar(&enableDebug, "web.enable-debug", false, "serve pprof profiles under /debug/pprof/ and expvar variables at /debug/vars")
+	flag.StringVar(&debugAddress, "web.debug-address", "", "address to serve the -web.enable-debug endpoints on instead of -localaddr")
+	flag.DurationVar(&shutdownTimeout, "web.shutdown-timeout", 10*time.Second, "time given to the responses being served to finish on SIGTERM or SIGINT before exiting")
+	flag.StringVar(&webConfigFile, "web.config.file", "", "exporter-toolkit web configuration file enabling TLS and basic or client certificate authentication")
+	flag.StringVar(&namespace, "namespace", "nws", "prefix of every exported metric name")
+	flag.Var(constLabels, "label", "key=value label attached to every exported metric, may be repeated")
+	flag.StringVar(&metricsInclude, "metrics.include", "", "regular expression of metric names to export, all when unset")
+	flag.StringVar(&metricsExclude, "metrics.exclude", "", "regular expression of metric names not to export")
+	flag.BoolVar(&metricsLegacyNames, "metrics.legacy-names", false, "also export metrics renamed to carry their unit under their previous names")
+	flag.StringVar(&telemetryPath, "web.telemetry-path", "/metrics", "path under which to expose metrics")
+	flag.BoolVar(&disableExporterMetrics, "web.disable-exporter-metrics", false, "leave out the go runtime, process and metrics handler metrics of the exporter itself")
+	flag.StringVar(&qcReject, "qc.reject", "X,B", "comma separated quality control codes whose values are dropped")
+	flag.StringVar(&unitSystem, "units", "metric", "units to export observations in, metric, imperial or both")
+	flag.BoolVar(&windDirectionComponents, "wind.direction-components", false, "also export the sine and cosine of the wind direction, which unlike degrees can be averaged")
+	flag.IntVar(&windCardinalPoints, "wind.cardinal-points", 8, "points of the compass the wind direction info metric is given in, 4, 8 or 16, or 0 to only export degrees")
+	flag.BoolVar(&wbgtSolar, "wbgt.solar", true, "estimate the wet bulb globe temperature in the sun, from the sun's elevation and the sky cover, rather than in shade")
+	flag.Float64Var(&fogMaxSpread, "fog.max-spread", 2.5, "largest dewpoint depression in celsius at which nws_fog_risk is raised")
+	flag.Float64Var(&fogMaxWind, "fog.max-wind", 10, "largest wind speed in kilometers per hour at which nws_fog_risk is raised")
+	flag.Float64Var(&pressureSteadyThreshold, "pressure.steady-threshold", 100, "largest change in pascals over 3 hours at which the pressure tendency is steady")
+	flag.Float64Var(&gddBase, "gdd.base", 10, "base temperature in celsius of growing degree days")
+	flag.Float64Var(&gddCap, "gdd.cap", 30, "temperature in celsius above which growing degree days no longer increase")
+	flag.Float64Var(&heatingBase, "hdh.base", 18.3, "temperature in celsius below which heating degree hours accumulate")
+	flag.Float64Var(&coolingBase, "cdh.base", 18.3, "temperature in celsius above which cooling degree hours accumulate")
+	flag.Float64Var(&hardFreezeThreshold, "freeze.hard-threshold", -2.2, "temperature in celsius below which nws_hard_freeze_seconds_total accumulates")
+	flag.Var(runways, "runway", "name=heading of a runway, in degrees, to export the headwind and crosswind along, may be repeated")
+	flag.DurationVar(&forecastInterval, "forecast.interval", 30*time.Minute, "time between retrievals of the forecast of each station")
+	flag.IntVar(&forecastHours, "forecast.hours", 24, "number of upcoming hours of the hourly forecast and gridpoint elements to export")
+	flag.StringVar(&gridpointElementNames, "gridpoint.elements", "skyCover,quantitativePrecipitation,snowfallAmount,probabilityOfThunder,relativeHumidity", "comma separated raw forecast grid elements exported by the gridpoint collector")
+	flag.DurationVar(&alertsInterval, "alerts.interval", time.Minute, "time between retrievals of the active alerts of each station")
+	flag.StringVar(&alertZones, "alerts.zone", "", "comma separated zone ids such as PAZ071 to retrieve alerts for instead of each station's location, or auto for the zones covering each station")
+	flag.StringVar(&alertsWebhookURL, "alerts.webhook-url", "", "url to post a json notification to when an alert appears or is no longer active")
+	flag.IntVar(&alertsWebhookRetries, "alerts.webhook-retries", 3, "number of times a failed alert notification is retried")
+	flag.StringVar(&alertmanagerURL, "alertmanager.url", "", "url of an alertmanager to push the active alerts of each station to")
+	flag.StringVar(&alertmanagerLabels, "alertmanager.labels", "alertname=event,severity=severity,urgency=urgency,alert_id=id", "comma separated label=field pairs setting the labels of alerts pushed to alertmanager from the alert fields")
+	flag.StringVar(&alertmanagerAnnotations, "alertmanager.annotations", "summary=headline,description=description,instruction=instruction,area=area", "comma separated annotation=field pairs setting the annotations of alerts pushed to alertmanager from the alert fields")
+	flag.StringVar(&aviationAddress, "aviation.address", "aviationweather.gov", "aviation weather center address terminal aerodrome forecasts and aviation advisories are retrieved from")
+	flag.StringVar(&aviationRegion, "aviation.region", "", "south,west,north,east edges in degrees of the region aviation advisories are counted over, everywhere when unset")
+	flag.DurationVar(&aviationInterval, "aviation.interval", 5*time.Minute, "time between retrievals of the aviation advisories")
+	flag.StringVar(&productTypes, "products.types", "AFD,HWO", "comma separated text product types whose latest issuance is exported by the products collector")
+	flag.StringVar(&productsOffice, "products.office", "", "forecast office whose products are exported, the office covering each station when unset")
+	flag.DurationVar(&productsInterval, "products.interval", 10*time.Minute, "time between retrievals of the products of each forecast office")
+	flag.StringVar(&marineZones, "marine.zone", "", "comma separated coastal or offshore marine zone ids such as ANZ450 exported by the marine collector")
+	flag.StringVar(&buoyAddress, "buoy.address", "www.ndbc.noaa.gov", "national data buoy center address the observations of buoy stations are retrieved from")
+	flag.StringVar(&riverGauges, "river.gauges", "", "comma separated location ids of river gauges such as PHBP1 exported by the river collector")
+	flag.StringVar(&riverAddress, "river.address", "api.water.noaa.gov", "national water prediction service address river gauges are retrieved from")
+	flag.DurationVar(&riverInterval, "river.interval", 15*time.Minute, "time between retrievals of each river gauge")
+	flag.StringVar(&tidesAddress, "tides.address", "api.tidesandcurrents.noaa.gov", "center for operational oceanographic products and services address tides are retrieved from")
+	flag.StringVar(&tidesDatum, "tides.datum", "MLLW", "tidal datum water levels are given above, such as MLLW or NAVD")
+	flag.DurationVar(&tidesInterval, "tides.interval", 6*time.Minute, "time between retrievals of the observed water level of each tide station")
+	flag.StringVar(&spcAddress, "spc.address", "www.spc.noaa.gov", "storm prediction center address convective outlooks are retrieved from")
+	flag.DurationVar(&spcInterval, "spc.interval", 30*time.Minute, "time between retrievals of the convective outlooks")
+	flag.StringVar(&tropicalAddress, "tropical.address", "www.nhc.noaa.gov", "national hurricane center address active tropical cyclones are retrieved from")
+	flag.DurationVar(&tropicalInterval, "tropical.interval", 30*time.Minute, "time between retrievals of the active tropical cyclones")
+	flag.StringVar(&airnowAddress, "airnow.address", "www.airnowapi.org", "airnow api address air quality is retrieved from")
+	flag.StringVar(&airnowAPIKeyFile, "airnow.api-key-file", "", "file holding the airnow api key, required by the airnow collector")
+	flag.DurationVar(&airnowInterval, "airnow.interval", time.Hour, "time between retrievals of the air quality of each station")
+	flag.StringVar(&normalsAddress, "normals.address", "www.ncei.noaa.gov", "national centers for environmental information address climate normals are retrieved from")
+	flag.StringVar(&stateFile, "state-file", "", "file to save accumulated totals such as growing degree days in, so they survive restarts")
+	flag.Var(addresses, "addr", "comma separated nws api hosts, requested in order with failover to the next host when a request fails")
 	flag.BoolVar(&help, "help", false, "help info")
 	flag.BoolVar(&verbose, "verbose", false, "verbose logging")
 	flag.IntVar(&timeout, "timeout", 10, "timeout in seconds")
-	flag.IntVar(&backofftime, "backofftime", 100, "backofftime in seconds")
+	flag.IntVar(&backofftime, "backofftime", 100, "deprecated, backofftime in seconds, used for -scrape-interval and -error-backoff when they are not given")
+	flag.DurationVar(&scrapeInterval, "scrape-interval", 100*time.Second, "time between scrapes of stations without their own interval")
+	flag.DurationVar(&errorBackoff, "error-backoff", 10*time.Second, "time to wait before scraping a station again after its first failed scrape")
+	flag.Float64Var(&errorBackoffMultiplier, "error-backoff.multiplier", 2, "factor the wait grows by with every further failure in a row")
+	flag.DurationVar(&errorBackoffMax, "error-backoff.max", 10*time.Minute, "longest wait before scraping a station again after failed scrapes")
+	flag.Float64Var(&errorBackoffJitter, "error-backoff.jitter", 0.2, "largest random change of each wait after a failed scrape, as a fraction of the wait")
+	flag.IntVar(&circuitBreakerFailures, "circuit-breaker.failures", 0, "number of failed scrapes in a row after which scrapes of a station are short-circuited for -circuit-breaker.cooldown, 0 to never")
+	flag.DurationVar(&circuitBreakerCooldown, "circuit-breaker.cooldown", 5*time.Minute, "time scrapes of a station are short-circuited for once its circuit breaker opens")
+	flag.IntVar(&degradedAfter, "degraded-after", 3, "number of consecutive failed scrapes after which a station is reported as degraded")
+	flag.BoolVar(&stagger, "stagger", true, "spread the first scrape of each station across its interval instead of scraping every station at startup")
+	flag.Float64Var(&jitter, "jitter", 0.1, "largest random delay added to each scrape, as a fraction of the station's interval")
+	flag.IntVar(&maxConcurrentFetches, "max-concurrent-fetches", 4, "maximum number of simultaneous requests to the nws api, 0 for no limit")
+	flag.Float64Var(&requestsPerMinute, "requests-per-minute", 60, "maximum rate of requests to the nws api across all stations, 0 for no limit")
+	flag.IntVar(&requestsBurst, "requests-burst", 5, "number of requests allowed in a burst above -requests-per-minute")
+	flag.IntVar(&requestRetries, "request-retries", 2, "number of times a request failing with a 5xx status, a timeout or a refused connection is retried before the scrape fails")
+	flag.DurationVar(&requestRetryDelay, "request-retries.delay", 500*time.Millisecond, "time to wait before the first retry of a failed request, doubling with every further retry")
+	flag.BoolVar(&validate, "validate", true, "check at startup that every station exists and is reporting")
+	flag.DurationVar(&staleAfter, "stale-after", 0, "observation age after which a scrape of the station fails as stale, 0 to never fail")
+	flag.DurationVar(&validateMaxAge, "validate-max-age", 6*time.Hour, "observation age after which -validate considers a station to have stopped reporting")
 	flag.BoolVar(&failfast, "failfast", false, "Exit quickly on errors")
-	flag.Parse()
-	prometheus.MustRegister(humidity)
-	prometheus.MustRegister(temperature)
-	prometheus.MustRegister(dewpoint)
-	prometheus.MustRegister(winddirection)
-	prometheus.MustRegister(windspeed)
-	prometheus.MustRegister(barometricpressure)
-	prometheus.MustRegister(sealevelpressure)
-	prometheus.MustRegister(visibility)
-	prometheus.MustRegister(timeSinceUpdate)
+	flag.BoolVar(&showVersion, "version", false, "print the version of the exporter and exit")
 }
 
 func main() {
+	flag.Parse()
 	if help {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if showVersion {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "check" {
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(Check())
+	}
+
+	if err := LoadEnv(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	RecordExplicitFlags()
+	if configFile != "" {
+		if err := LoadConfig(configFile); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+	recordReload(nil)
 
-	log.Printf("Starting up, retrieving from %s at station %s", address, station)
-	log.Printf("Serving on http://%s/metrics...", localaddr)
-	// start scrape loop
-	go func() {
-		for {
-			response, rawJSON, err := RetrieveCurrentObservation(station, address, timeout)
-			if err != nil {
-				if failfast {
-					log.Fatalf("error: %v", err)
-				}
-
-				log.Printf("Problem retrieving from: %s at station %s: %s", address, station, err)
-				backoffseconds := (time.Duration(backofftime) * time.Second)
-				log.Printf("Waiting %v seconds, next scrape at %s", backofftime, time.Now().Add(backoffseconds))
-				time.Sleep(time.Duration(backofftime) * time.Second)
-				continue
-			}
-
-			if verbose {
-				log.Printf("raw json response: %s", rawJSON)
-			}
-
-			timeSinceUpdate.Set(time.Since(response.Properties.Timestamp).Seconds())
-
-			var missingProperties []string
-			if response.Properties.RelativeHumidity != nil && response.Properties.RelativeHumidity.Value != nil {
-				humidity.Set(*response.Properties.RelativeHumidity.Value)
-			} else {
-				missingProperties = append(missingProperties, "RelativeHumidity")
-			}
-			if response.Properties.Temperature != nil && response.Properties.Temperature.Value != nil {
-				temperature.Set(*response.Properties.Temperature.Value)
-			} else {
-				missingProperties = append(missingProperties, "Temperature")
-			}
-			if response.Properties.Dewpoint != nil && response.Properties.Dewpoint.Value != nil {
-				dewpoint.Set(*response.Properties.Dewpoint.Value)
-			} else {
-				missingProperties = append(missingProperties, "Dewpoint")
-			}
-			if response.Properties.WindDirection != nil && response.Properties.WindDirection.Value != nil {
-				winddirection.WithLabelValues(
-					CardinalDirection(*response.Properties.WindDirection.Value)).Set(
-					*response.Properties.WindDirection.Value)
-			} else {
-				missingProperties = append(missingProperties, "WindDirection")
-			}
-			if response.Properties.WindSpeed != nil && response.Properties.WindSpeed.Value != nil {
-				windspeed.Set(*response.Properties.WindSpeed.Value)
-			} else {
-				missingProperties = append(missingProperties, "WindSpeed")
-			}
-			if response.Properties.BarometricPressure != nil && response.Properties.BarometricPressure.Value != nil {
-				barometricpressure.Set(*response.Properties.BarometricPressure.Value)
-			} else {
-				missingProperties = append(missingProperties, "BarometricPressure")
-			}
-			if response.Properties.SeaLevelPressure != nil && response.Properties.SeaLevelPressure.Value != nil {
-				sealevelpressure.Set(*response.Properties.SeaLevelPressure.Value)
-			} else {
-				missingProperties = append(missingProperties, "SeaLevelPressure")
-			}
-			if response.Properties.Visibility != nil && response.Properties.Visibility.Value != nil {
-				visibility.Set(*response.Properties.Visibility.Value)
-			} else {
-				missingProperties = append(missingProperties, "Visibility")
-			}
-			if len(missingProperties) != 0 {
-				log.Printf("some properties are missing in the response: %v", missingProperties)
-			}
-
-			if verbose {
-				log.Printf("Waiting %v seconds, next scrape at %s", backofftime, time.Now().Add(
-					time.Duration(backofftime)*time.Second).String())
-			}
-			time.Sleep(time.Duration(backofftime) * time.Second)
+	if errs := CheckFlags(); len(errs) != 0 {
+		log.Fatalf("error: %v", errs[0])
+	}
+	if err := registerMetrics(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if stateFile != "" {
+		if err := totals.Load(stateFile); err != nil {
+			log.Fatalf("error: reading state file: %v", err)
 		}
-	}()
+	}
+	if maxConcurrentFetches > 0 {
+		fetchSlots = make(chan struct{}, maxConcurrentFetches)
+	}
+	if requestsPerMinute > 0 {
+		limiter = NewRateLimiter(requestsPerMinute, requestsBurst)
+	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(localaddr, nil))
+	go alertNotifications.Run()
+	go alertmanager.Run()
+	startGlobalCollectors(upstreamCtx)
+
+	manager := NewStationManager()
+	switch {
+	case latlon != "":
+		ids, err := NearestStations(upstreamCtx, latlon, nearest, address, timeout)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		log.Printf("Nearest stations to %s are %s", latlon, strings.Join(ids, ", "))
+		manager.Apply([]StationConfig{{ID: ids[0]}})
+		if len(ids) > 1 {
+			go followNearest(upstreamCtx, ids, manager)
+		}
+	case stationsFile != "":
+		configs, err := ReadStationsFile(stationsFile)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		log.Printf("Starting up, retrieving from %s at stations listed in %s", address, stationsFile)
+		if validate {
+			validateStations(upstreamCtx, configs)
+		}
+		manager.Apply(configs)
+		go watchStationsFile(stationsFile, stationsFilePoll, manager)
+	default:
+		configs, err := stationList()
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		var stationIDs []string
+		for _, config := range configs {
+			stationIDs = append(stationIDs, config.ID)
+		}
+		log.Printf("Starting up, retrieving from %s at stations %s", address, strings.Join(stationIDs, ", "))
+		if validate {
+			validateStations(upstreamCtx, configs)
+		}
+		manager.Apply(configs)
+	}
+	log.Printf("Serving on http://%s%s...", localaddr, telemetryPath)
+
+	// the admin endpoints share the metrics listener unless given their own
+	// with -web.admin-address
+	mux := http.NewServeMux()
+	adminMux := mux
+	if adminAddress != "" {
+		adminMux = http.NewServeMux()
+	}
+	var links, adminLinks []landingLink
+	if adminTokenFile != "" {
+		token, err := os.ReadFile(adminTokenFile)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if strings.TrimSpace(string(token)) == "" {
+			log.Fatalf("error: admin token file %s is empty", adminTokenFile)
+		}
+		admin := AdminHandler{Token: strings.TrimSpace(string(token)), Manager: manager}
+		adminMux.Handle("/api/v1/stations", admin)
+		adminMux.Handle("/api/v1/stations/", admin)
+		adminLinks = append(adminLinks, landingLink{"/api/v1/stations", "admin api, requires the admin token"})
+	}
+
+	reloader := &Reloader{Manager: manager}
+	go reloader.WatchSignals()
+	// unlike the admin listener, the metrics listener is reachable by anyone
+	// scraping the exporter, who may only reload or refresh with
+	// -web.enable-lifecycle
+	if adminAddress != "" || enableLifecycle {
+		adminMux.Handle("/-/reload", reloader)
+		adminMux.Handle("/-/refresh", RefreshHandler{Manager: manager})
+	}
+
+	mux.Handle("/sd", readingConfig(SDHandler{Manager: manager}))
+	gatherer, err := metricsGatherer()
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	metricsHandler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	if !disableExporterMetrics {
+		metricsHandler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, metricsHandler)
+	}
+	mux.Handle(telemetryPath, metricsHandler)
+	// probes read the flags they need like scrapes, rather than holding
+	// configMu while retrieving the station
+	mux.Handle("/probe", &ProbeHandler{Manager: manager, Gatherer: gatherer})
+	mux.Handle("/api/v1/current", readingConfig(CurrentHandler{}))
+	links = append(links,
+		landingLink{telemetryPath, "metrics"},
+		landingLink{"/sd", "stations in the prometheus http service discovery format"},
+	)
+	adminMux.Handle("/healthz", HealthHandler{})
+	adminMux.Handle("/readyz", ReadyHandler{Manager: manager})
+	adminLinks = append(adminLinks, landingLink{"/healthz", "liveness"}, landingLink{"/readyz", "readiness"})
+	// the admin and debug listeners are shut down along with the metrics
+	// listener
+	var servers []*http.Server
+	switch {
+	case enableDebug && debugAddress != "":
+		debugServer := &http.Server{Addr: debugAddress, Handler: debugHandler()}
+		servers = append(servers, debugServer)
+		go serveDebug(debugServer)
+	case enableDebug:
+		adminMux.Handle("/debug/", debugHandler())
+		adminLinks = append(adminLinks, landingLink{"/debug/pprof/", "profiles"}, landingLink{"/debug/vars", "expvar variables"})
+	}
+	if adminAddress != "" {
+		adminServer := &http.Server{Addr: adminAddress, Handler: logAccess(adminMux)}
+		servers = append(servers, adminServer)
+		go serveAdmin(adminServer)
+	} else {
+		links = append(links, adminLinks...)
+	}
+	if telemetryPath != "/" {
+		mux.Handle("/", readingConfig(LandingHandler{Manager: manager, Links: links}))
+	}
+	server := &http.Server{Addr: localaddr, Handler: logAccess(mux)}
+	done := make(chan struct{})
+	go shutdownOnSignal(append([]*http.Server{server}, servers...), manager, done)
+
+	atomic.StoreInt32(&started, 1)
+	go notifySystemd(manager)
+	if err := listenAndServe(server, ""); err != http.ErrServerClosed {
+		log.Fatalf("error: %v", err)
+	}
+	<-done
+	log.Printf("Shut down")
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	marineWaveHeight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "marine_wave_height_meters",
+			Help: "forecast seas or wave height of each period of the marine zone forecast in meters, the upper end when a range is forecast",
+		},
+		[]string{"zone", "period"},
+	)
+	marineWindSpeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "marine_wind_speed_kilometers_per_hour",
+			Help: "forecast wind speed of each period of the marine zone forecast in kilometers per hour, the upper end when a range is forecast",
+		},
+		[]string{"zone", "period"},
+	)
+	marineAdvisory = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "marine_advisory_active",
+			Help: "whether each marine advisory or warning is in effect for the marine zone, 1 when it is and 0 otherwise",
+		},
+		[]string{"zone", "event"},
+	)
+)
+
+// marineEvents are the alert events exported by nws_marine_advisory_active.
+var marineEvents = []string{
+	"Small Craft Advisory",
+	"Gale Warning",
+	"Storm Warning",
+	"Hurricane Force Wind Warning",
+	"Hazardous Seas Warning",
+	"Special Marine Warning",
+}
+
+func init() {
+	registerGlobalCollector("marine", false, &marineCollector{}, marineWaveHeight, marineWindSpeed, marineAdvisory)
+}
+
+// marineCollector exports the forecast and advisories of the coastal and
+// offshore marine zones listed in -marine.zone, such as ANZ450. The zones do
+// not belong to a station, so they are retrieved every -forecast.interval on
+// a loop of their own.
+type marineCollector struct {
+	refreshTracker
+}
+
+// Interval returns -forecast.interval, read holding configMu.
+func (c *marineCollector) Interval() time.Duration {
+	return forecastInterval
+}
+
+// UpdateGlobal retrieves every zone that is due, carrying on past the zones
+// that fail, which are retried on the next run.
+func (c *marineCollector) UpdateGlobal(ctx context.Context) error {
+	configMu.RLock()
+	zoneList, interval, addr, t := marineZones, forecastInterval, address, timeout
+	configMu.RUnlock()
+	zones, err := ParseAlertZones(zoneList)
+	if err != nil {
+		return err
+	}
+	var failed CollectError
+	for _, zone := range zones {
+		if !c.Due(zone, interval) {
+			continue
+		}
+		forecast, err := RetrieveZoneForecast(ctx, zone, addr, t)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("retrieving forecast of zone %s: %w", zone, err))
+			continue
+		}
+		alerts, err := RetrieveActiveAlerts(ctx, url.Values{"zone": {zone}}, addr, t)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("retrieving alerts of zone %s: %w", zone, err))
+			continue
+		}
+
+		updateMarineMetrics(zone, forecast, alerts)
+		c.Done(zone)
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+// ZoneForecastResponse is the json structure returned by the national weather
+// service for the text forecast of a zone.
+type ZoneForecastResponse struct {
+	Properties struct {
+		Periods []struct {
+			Number           int    `json:"number"`
+			Name             string `json:"name"`
+			DetailedForecast string `json:"detailedForecast"`
+		} `json:"periods"`
+	} `json:"properties"`
+}
+
+// RetrieveZoneForecast retrieves the text forecast of a zone.
+func RetrieveZoneForecast(ctx context.Context, zone string, address string, timeout int) (ZoneForecastResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   fmt.Sprintf("/zones/forecast/%s/forecast", zone),
+	}
+
+	response := ZoneForecastResponse{}
+	_, err := retrieve(ctx, requestURL, timeout, &response)
+	return response, err
+}
+
+var (
+	marineWindRE = regexp.MustCompile(`(?i)\bwinds?\s+(?:(?:around|less than|up to)\s+)?(\d+)(?:\s+to\s+(\d+))?\s*kt\b`)
+	marineSeasRE = regexp.MustCompile(`(?i)\b(?:seas|waves)\s+(?:(?:around|less than|up to)\s+)?(\d+)(?:\s+to\s+(\d+))?\s*(?:ft|foot|feet)\b`)
+)
+
+// MarineWindSpeed returns the wind speed of a marine forecast text such as
+// "SW winds 10 to 15 kt" in kilometers per hour, the upper end of a range,
+// reporting whether the text forecasts one.
+func MarineWindSpeed(text string) (float64, bool) {
+	knots, ok := upperOfRange(marineWindRE, text)
+	return knots * 1.852, ok
+}
+
+// MarineWaveHeight returns the seas or wave height of a marine forecast text
+// such as "Seas 2 to 3 ft" in meters, the upper end of a range, reporting
+// whether the text forecasts one.
+func MarineWaveHeight(text string) (float64, bool) {
+	feet, ok := upperOfRange(marineSeasRE, text)
+	return feet * 0.3048, ok
+}
+
+// upperOfRange returns the second number matched by re in text, or the first
+// when the match is not a range.
+func upperOfRange(re *regexp.Regexp, text string) (float64, bool) {
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	value := match[1]
+	if match[2] != "" {
+		value = match[2]
+	}
+	v, _ := strconv.ParseFloat(value, 64)
+	return v, true
+}
+
+// updateMarineMetrics replaces the zone's series with the periods of its
+// forecast and the advisories in effect.
+func updateMarineMetrics(zone string, forecast ZoneForecastResponse, alerts []Alert) {
+	labels := prometheus.Labels{"zone": zone}
+	marineWaveHeight.DeletePartialMatch(labels)
+	marineWindSpeed.DeletePartialMatch(labels)
+
+	for _, period := range forecast.Properties.Periods {
+		name := strings.ToLower(period.Name)
+		if height, ok := MarineWaveHeight(period.DetailedForecast); ok {
+			marineWaveHeight.WithLabelValues(zone, name).Set(height)
+		}
+		if speed, ok := MarineWindSpeed(period.DetailedForecast); ok {
+			marineWindSpeed.WithLabelValues(zone, name).Set(speed)
+		}
+	}
+	for _, event := range marineEvents {
+		active := 0.0
+		for _, alert := range alerts {
+			if alert.Event == event {
+				active = 1
+			}
+		}
+		marineAdvisory.WithLabelValues(zone, event).Set(active)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMarineWindSpeed(t *testing.T) {
+	knots := map[string]float64{
+		"SW winds 10 to 15 kt.":                    15,
+		"N WINDS AROUND 5 KT, BECOMING NE.":        5,
+		"Variable winds less than 10 kt.":          10,
+		"E wind up to 20 kt in the afternoon.":     20,
+		"NW winds 20 to 25 kt with gusts to 35 kt": 25,
+	}
+	for text, want := range knots {
+		got, ok := MarineWindSpeed(text)
+		if !ok || math.Abs(got-want*1.852) > 1e-9 {
+			t.Errorf("MarineWindSpeed(%q) = %v, %v, want %v km/h", text, got, ok, want*1.852)
+		}
+	}
+
+	for _, text := range []string{
+		"Seas 2 to 3 ft.",
+		"Rain likely. Visibility 1 nm or less.",
+		"Winds light and variable.",
+		"SW winds 10 to 15 mph.",
+	} {
+		if got, ok := MarineWindSpeed(text); ok {
+			t.Errorf("MarineWindSpeed(%q) = %v, want no wind", text, got)
+		}
+	}
+}
+
+func TestMarineWaveHeight(t *testing.T) {
+	feet := map[string]float64{
+		"Seas 2 to 3 ft.":                        3,
+		"SEAS AROUND 4 FT.":                      4,
+		"Waves 1 foot or less.":                  1,
+		"Waves less than 2 feet.":                2,
+		"S winds 10 kt. Seas 5 to 7 ft. Showers": 7,
+	}
+	for text, want := range feet {
+		got, ok := MarineWaveHeight(text)
+		if !ok || math.Abs(got-want*0.3048) > 1e-9 {
+			t.Errorf("MarineWaveHeight(%q) = %v, %v, want %v m", text, got, ok, want*0.3048)
+		}
+	}
+
+	// swell is not read as seas
+	for _, text := range []string{"SW winds 10 to 15 kt.", "Seas building.", "Swell 3 ft at 8 seconds."} {
+		if got, ok := MarineWaveHeight(text); ok {
+			t.Errorf("MarineWaveHeight(%q) = %v, want no seas", text, got)
+		}
+	}
+}
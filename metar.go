@@ -0,0 +1,194 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metarFallbacks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "metar_fallbacks_total",
+		Help: "number of times a property missing from the decoded observation was filled in from the raw METAR",
+	},
+	[]string{"station", "property"},
+)
+
+var (
+	metarWindRE       = regexp.MustCompile(`^(\d{3}|VRB)(\d{2,3})(?:G(\d{2,3}))?(KT|MPS|KMH)$`)
+	metarVisibilityRE = regexp.MustCompile(`^M?(?:(\d+)|(\d+)/(\d+))SM$`)
+	metarMetersRE     = regexp.MustCompile(`^\d{4}$`)
+	metarTempRE       = regexp.MustCompile(`^(M?\d{2})/(M?\d{2})?$`)
+	metarAltimeterRE  = regexp.MustCompile(`^([AQ])(\d{4})$`)
+	metarSLPRE        = regexp.MustCompile(`^SLP(\d{3})$`)
+	metarTGroupRE     = regexp.MustCompile(`^T([01])(\d{3})(?:([01])(\d{3}))?$`)
+)
+
+// METAR holds the values decoded from a raw METAR report, converted to the
+// units used by the observations api. Values missing from the report are nil.
+type METAR struct {
+	// Temperature and Dewpoint are in celsius.
+	Temperature *float64
+	Dewpoint    *float64
+	// WindDirection is in degrees, and is nil for calm or variable winds.
+	WindDirection *float64
+	// WindSpeed and WindGust are in kilometers per hour.
+	WindSpeed *float64
+	WindGust  *float64
+	// Altimeter and SeaLevelPressure are in pascals.
+	Altimeter        *float64
+	SeaLevelPressure *float64
+	// Visibility is in meters.
+	Visibility *float64
+}
+
+// ParseMETAR decodes the fields of a raw METAR report the exporter can use,
+// for example "KPHL 151254Z 27015G25KT 10SM FEW050 22/12 A2992 RMK SLP132".
+// Fields that cannot be decoded are left nil rather than failing the parse.
+func ParseMETAR(raw string) METAR {
+	var m METAR
+	tokens := strings.Fields(raw)
+	remarks := false
+	for i, token := range tokens {
+		if token == "RMK" {
+			remarks = true
+			continue
+		}
+
+		if remarks {
+			if match := metarSLPRE.FindStringSubmatch(token); match != nil {
+				tenths, _ := strconv.ParseFloat(match[1], 64)
+				hpa := 1000 + tenths/10
+				// only the last three digits are reported, 500 and up
+				// are read as 9xx hPa
+				if tenths >= 500 {
+					hpa = 900 + tenths/10
+				}
+				m.SeaLevelPressure = float(hpa * 100)
+			} else if match := metarTGroupRE.FindStringSubmatch(token); match != nil {
+				// the T group carries temperatures to a tenth of a degree
+				m.Temperature = float(metarTenths(match[1], match[2]))
+				if match[3] != "" {
+					m.Dewpoint = float(metarTenths(match[3], match[4]))
+				}
+			}
+			continue
+		}
+
+		switch {
+		case metarWindRE.MatchString(token):
+			match := metarWindRE.FindStringSubmatch(token)
+			factor := map[string]float64{"KT": 1.852, "MPS": 3.6, "KMH": 1}[match[4]]
+			speed, _ := strconv.ParseFloat(match[2], 64)
+			m.WindSpeed = float(speed * factor)
+			// calm winds are reported as 00000KT, without a direction
+			if match[1] != "VRB" && speed != 0 {
+				direction, _ := strconv.ParseFloat(match[1], 64)
+				m.WindDirection = float(direction)
+			}
+			if match[3] != "" {
+				gust, _ := strconv.ParseFloat(match[3], 64)
+				m.WindGust = float(gust * factor)
+			}
+		case metarVisibilityRE.MatchString(token):
+			match := metarVisibilityRE.FindStringSubmatch(token)
+			var miles float64
+			if match[1] != "" {
+				miles, _ = strconv.ParseFloat(match[1], 64)
+			} else {
+				numerator, _ := strconv.ParseFloat(match[2], 64)
+				denominator, _ := strconv.ParseFloat(match[3], 64)
+				if denominator != 0 {
+					miles = numerator / denominator
+				}
+				// whole miles come in their own token, as in "1 1/2SM"
+				if i > 0 {
+					if whole, err := strconv.Atoi(tokens[i-1]); err == nil && whole < 10 {
+						miles += float64(whole)
+					}
+				}
+			}
+			m.Visibility = float(miles * 1609.344)
+		case metarMetersRE.MatchString(token) && m.Visibility == nil && m.WindSpeed != nil:
+			meters, _ := strconv.ParseFloat(token, 64)
+			// 9999 stands for 10 kilometers or more
+			if meters == 9999 {
+				meters = 10000
+			}
+			m.Visibility = float(meters)
+		case token == "CAVOK":
+			m.Visibility = float(10000)
+		case metarTempRE.MatchString(token):
+			match := metarTempRE.FindStringSubmatch(token)
+			m.Temperature = float(metarTemperature(match[1]))
+			if match[2] != "" {
+				m.Dewpoint = float(metarTemperature(match[2]))
+			}
+		case metarAltimeterRE.MatchString(token):
+			match := metarAltimeterRE.FindStringSubmatch(token)
+			value, _ := strconv.ParseFloat(match[2], 64)
+			if match[1] == "A" {
+				// hundredths of inches of mercury
+				m.Altimeter = float(value / 100 * 3386.389)
+			} else {
+				// hectopascals
+				m.Altimeter = float(value * 100)
+			}
+		}
+	}
+	return m
+}
+
+// metarTemperature decodes a body temperature such as "22" or "M05".
+func metarTemperature(s string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimPrefix(s, "M"), 64)
+	if strings.HasPrefix(s, "M") {
+		return -value
+	}
+	return value
+}
+
+// metarTenths decodes a remark temperature in tenths of a degree, with a sign
+// digit of 1 for negative temperatures.
+func metarTenths(sign, tenths string) float64 {
+	value, _ := strconv.ParseFloat(tenths, 64)
+	if sign == "1" {
+		return -value / 10
+	}
+	return value / 10
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// fillFromMETAR fills in the properties of the response that are missing but
+// can be decoded from its raw METAR, counting each property filled in.
+func fillFromMETAR(station string, response *ObservationResponse) {
+	if response.Properties.RawMessage == "" {
+		return
+	}
+	m := ParseMETAR(response.Properties.RawMessage)
+
+	fill := func(property string, measurement **Measurement, value *float64, unitCode string) {
+		if value == nil || (*measurement != nil && (*measurement).Value != nil) {
+			return
+		}
+		*measurement = &Measurement{Value: value, UnitCode: unitCode}
+		metarFallbacks.WithLabelValues(station, property).Inc()
+	}
+	p := &response.Properties
+	fill("Temperature", &p.Temperature, m.Temperature, "wmoUnit:degC")
+	fill("Dewpoint", &p.Dewpoint, m.Dewpoint, "wmoUnit:degC")
+	fill("WindSpeed", &p.WindSpeed, m.WindSpeed, "wmoUnit:km_h-1")
+	// a direction is meaningless for calm winds, whichever speed is reported
+	if speed, ok := value(p.WindSpeed); !ok || speed != 0 {
+		fill("WindDirection", &p.WindDirection, m.WindDirection, "wmoUnit:degree_(angle)")
+	}
+	fill("WindGust", &p.WindGust, m.WindGust, "wmoUnit:km_h-1")
+	fill("BarometricPressure", &p.BarometricPressure, m.Altimeter, "wmoUnit:Pa")
+	fill("SeaLevelPressure", &p.SeaLevelPressure, m.SeaLevelPressure, "wmoUnit:Pa")
+	fill("Visibility", &p.Visibility, m.Visibility, "wmoUnit:m")
+}
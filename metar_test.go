@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestParseMETAR(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want METAR
+	}{
+		{
+			name: "us units with remarks",
+			raw:  "KPHL 151254Z 27015G25KT 10SM FEW050 22/12 A2992 RMK AO2 SLP132 T02220117",
+			want: METAR{
+				Temperature:      float(22.2),
+				Dewpoint:         float(11.7),
+				WindDirection:    float(270),
+				WindSpeed:        float(15 * 1.852),
+				WindGust:         float(25 * 1.852),
+				Altimeter:        float(29.92 * 3386.389),
+				SeaLevelPressure: float(101320),
+				Visibility:       float(10 * 1609.344),
+			},
+		},
+		{
+			// calm winds have no direction
+			name: "calm",
+			raw:  "KPHL 151254Z 00000KT 1 1/2SM M05/M10",
+			want: METAR{Temperature: float(-5), Dewpoint: float(-10), WindSpeed: float(0), Visibility: float(1.5 * 1609.344)},
+		},
+		{
+			name: "metric units",
+			raw:  "EGLL 151250Z VRB03MPS 9999 Q1013 RMK SLP987",
+			want: METAR{WindSpeed: float(3 * 3.6), Visibility: float(10000), Altimeter: float(101300), SeaLevelPressure: float(99870)},
+		},
+		{
+			name: "cavok and missing dewpoint",
+			raw:  "LFPG 151230Z 18010KMH CAVOK 15/",
+			want: METAR{WindDirection: float(180), WindSpeed: float(10), Visibility: float(10000), Temperature: float(15)},
+		},
+		{
+			name: "missing groups",
+			raw:  "KPHL 151254Z AUTO ///// RMK T1012",
+			want: METAR{Temperature: float(-1.2)},
+		},
+		{name: "empty"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ParseMETAR(test.raw)
+			fields := []struct {
+				name      string
+				got, want *float64
+			}{
+				{"Temperature", got.Temperature, test.want.Temperature},
+				{"Dewpoint", got.Dewpoint, test.want.Dewpoint},
+				{"WindDirection", got.WindDirection, test.want.WindDirection},
+				{"WindSpeed", got.WindSpeed, test.want.WindSpeed},
+				{"WindGust", got.WindGust, test.want.WindGust},
+				{"Altimeter", got.Altimeter, test.want.Altimeter},
+				{"SeaLevelPressure", got.SeaLevelPressure, test.want.SeaLevelPressure},
+				{"Visibility", got.Visibility, test.want.Visibility},
+			}
+			for _, field := range fields {
+				if !sameValue(field.got, field.want) {
+					t.Errorf("%s = %s, want %s", field.name, describe(field.got), describe(field.want))
+				}
+			}
+		})
+	}
+}
+
+// sameValue reports whether two optional values are both missing or equal up
+// to rounding.
+func sameValue(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return math.Abs(*a-*b) < 1e-6
+}
+
+func describe(v *float64) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*v)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// FilterGatherer drops the metric families of Gatherer whose names do not
+// match Include or do match Exclude. Either regular expression may be nil.
+type FilterGatherer struct {
+	Gatherer prometheus.Gatherer
+	Include  *regexp.Regexp
+	Exclude  *regexp.Regexp
+}
+
+func (g FilterGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	filtered := families[:0]
+	for _, family := range families {
+		if g.keeps(family.GetName()) {
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered, err
+}
+
+// keeps reports whether the metric family named name is exported.
+func (g FilterGatherer) keeps(name string) bool {
+	if g.Include != nil && !g.Include.MatchString(name) {
+		return false
+	}
+	return g.Exclude == nil || !g.Exclude.MatchString(name)
+}
+
+// keepsAny reports whether any of the metric families described by metric is
+// exported.
+func (g FilterGatherer) keepsAny(metric prometheus.Collector) bool {
+	for _, name := range metricNames(metric) {
+		if g.keeps(name) {
+			return true
+		}
+	}
+	return false
+}
+
+var descNameRE = regexp.MustCompile(`^Desc{fqName: "([^"]*)"`)
+
+// metricNames returns the names of the metric families described by metric,
+// prefixed with -namespace. The client library does not expose the name of a
+// Desc other than through its description.
+func metricNames(metric prometheus.Collector) []string {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		metric.Describe(descs)
+		close(descs)
+	}()
+	var names []string
+	for desc := range descs {
+		match := descNameRE.FindStringSubmatch(desc.String())
+		if match == nil {
+			continue
+		}
+		name := match[1]
+		if namespace != "" {
+			name = namespace + "_" + name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// legacyMetricNames maps the names of metrics renamed to carry their unit to
+// their names before the rename, without the -namespace prefix.
+var legacyMetricNames = map[string]string{
+	"humidity_percent":                       "humidity",
+	"temperature_celsius":                    "temperature",
+	"dewpoint_celsius":                       "dewpoint",
+	"wind_direction_degrees":                 "wind_direction",
+	"wind_speed_kilometers_per_hour":         "wind_speed",
+	"wind_gust_kilometers_per_hour":          "wind_gust",
+	"barometric_pressure_pascals":            "barometric_pressure",
+	"sealevel_pressure_pascals":              "sealevel_pressure",
+	"visibility_meters":                      "visibility",
+	"heat_index_celsius":                     "heat_index",
+	"wind_chill_celsius":                     "wind_chill",
+	"temperature_max_last_24_hours_celsius":  "temperature_max_last_24_hours",
+	"temperature_min_last_24_hours_celsius":  "temperature_min_last_24_hours",
+	"precipitation_last_hour_millimeters":    "precipitation_last_hour",
+	"precipitation_last_3_hours_millimeters": "precipitation_last_3_hours",
+	"precipitation_last_6_hours_millimeters": "precipitation_last_6_hours",
+	"time_since_update_seconds":              "time_since_update",
+}
+
+// LegacyNamesGatherer adds a copy of every metric family of Gatherer listed in
+// Names under its legacy name, so dashboards and alerts can be migrated to
+// renamed metrics while both names are exported.
+type LegacyNamesGatherer struct {
+	Gatherer prometheus.Gatherer
+	Names    map[string]string
+}
+
+func (g LegacyNamesGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	for _, family := range families {
+		legacy, ok := g.Names[family.GetName()]
+		if !ok {
+			continue
+		}
+		families = append(families, &dto.MetricFamily{
+			Name:   &legacy,
+			Help:   family.Help,
+			Type:   family.Type,
+			Metric: family.Metric,
+		})
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	return families, err
+}
+
+// compileMetricFilter compiles a -metrics.include or -metrics.exclude regular
+// expression, anchored to match whole metric names. An empty expression
+// compiles to nil.
+func compileMetricFilter(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// metricFilter returns a FilterGatherer applying -metrics.include and
+// -metrics.exclude, without its Gatherer, or nil when neither is set.
+func metricFilter() (*FilterGatherer, error) {
+	include, err := compileMetricFilter(metricsInclude)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileMetricFilter(metricsExclude)
+	if err != nil {
+		return nil, err
+	}
+	if include == nil && exclude == nil {
+		return nil, nil
+	}
+	return &FilterGatherer{Include: include, Exclude: exclude}, nil
+}
+
+// metricsGatherer returns the gatherer serving the metrics endpoint, adding
+// the legacy metric names with -metrics.legacy-names and applying
+// -metrics.include and -metrics.exclude. The metrics of the exporter left out
+// by them are not registered in the first place, so only the go, process and
+// promhttp metrics, the legacy names and collectors exporting some families
+// kept and others left out are filtered here.
+func metricsGatherer() (prometheus.Gatherer, error) {
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if metricsLegacyNames {
+		names := map[string]string{}
+		for name, legacy := range legacyMetricNames {
+			if namespace != "" {
+				name, legacy = namespace+"_"+name, namespace+"_"+legacy
+			}
+			names[name] = legacy
+		}
+		gatherer = LegacyNamesGatherer{Gatherer: gatherer, Names: names}
+	}
+
+	filter, err := metricFilter()
+	if err != nil || filter == nil {
+		return gatherer, err
+	}
+	filter.Gatherer = gatherer
+	return *filter, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AlertNotification is the json payload posted to -alerts.webhook-url when an
+// alert appears or is no longer active.
+type AlertNotification struct {
+	// State is "new" for an alert that just appeared, "cancelled" for one that
+	// stopped being active before it expired and "expired" for one that
+	// stopped being active once it expired.
+	State       string     `json:"state"`
+	Stations    []string   `json:"stations"`
+	ID          string     `json:"id"`
+	Event       string     `json:"event"`
+	Severity    string     `json:"severity"`
+	Urgency     string     `json:"urgency"`
+	Certainty   string     `json:"certainty"`
+	MessageType string     `json:"messageType"`
+	Headline    string     `json:"headline"`
+	Description string     `json:"description"`
+	Instruction string     `json:"instruction"`
+	Area        string     `json:"area"`
+	Sent        time.Time  `json:"sent"`
+	Onset       *time.Time `json:"onset,omitempty"`
+	Expires     time.Time  `json:"expires"`
+	Ends        *time.Time `json:"ends,omitempty"`
+}
+
+// alertNotifier tracks the active alerts of every station to notify
+// -alerts.webhook-url once of each alert appearing or going away, however many
+// stations it is in effect for.
+type alertNotifier struct {
+	mu sync.Mutex
+	// alerts are the active alerts by id, along with the stations they are
+	// active for.
+	alerts   map[string]Alert
+	stations map[string]map[string]bool
+	queue    chan AlertNotification
+}
+
+var alertNotifications = &alertNotifier{
+	alerts:   map[string]Alert{},
+	stations: map[string]map[string]bool{},
+	queue:    make(chan AlertNotification, 100),
+}
+
+// Update records the active alerts of the station, queueing notifications of
+// alerts that were not active for any station before and of alerts that are
+// no longer active for any station.
+func (n *alertNotifier) Update(station string, alerts []Alert, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	active := map[string]bool{}
+	var added []string
+	for _, alert := range alerts {
+		active[alert.ID] = true
+		if _, ok := n.alerts[alert.ID]; !ok {
+			n.stations[alert.ID] = map[string]bool{}
+			n.alerts[alert.ID] = alert
+			added = append(added, alert.ID)
+		}
+		n.stations[alert.ID][station] = true
+	}
+	for _, id := range added {
+		n.notify("new", id)
+	}
+	for id, stations := range n.stations {
+		if !stations[station] || active[id] {
+			continue
+		}
+		if len(stations) == 1 {
+			state := "cancelled"
+			if !now.Before(n.alerts[id].Expires) {
+				state = "expired"
+			}
+			n.notify(state, id)
+			delete(n.alerts, id)
+			delete(n.stations, id)
+		} else {
+			delete(stations, station)
+		}
+	}
+}
+
+// Forget drops the alerts of a station that is no longer scraped, without
+// notifying that they went away.
+func (n *alertNotifier) Forget(station string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for id, stations := range n.stations {
+		delete(stations, station)
+		if len(stations) == 0 {
+			delete(n.alerts, id)
+			delete(n.stations, id)
+		}
+	}
+}
+
+// notify queues a notification of the alert with the given id. Notifications
+// are dropped when -alerts.webhook-url is not set, or when the webhook falls
+// too far behind. n.mu must be held.
+func (n *alertNotifier) notify(state string, id string) {
+	if alertsWebhookURL == "" {
+		return
+	}
+	alert := n.alerts[id]
+	var stations []string
+	for station := range n.stations[id] {
+		stations = append(stations, station)
+	}
+	sort.Strings(stations)
+
+	notification := AlertNotification{
+		State:       state,
+		Stations:    stations,
+		ID:          alert.ID,
+		Event:       alert.Event,
+		Severity:    alert.Severity,
+		Urgency:     alert.Urgency,
+		Certainty:   alert.Certainty,
+		MessageType: alert.MessageType,
+		Headline:    alert.Headline,
+		Description: alert.Description,
+		Instruction: alert.Instruction,
+		Area:        alert.AreaDesc,
+		Sent:        alert.Sent,
+		Onset:       alert.Onset,
+		Expires:     alert.Expires,
+		Ends:        alert.Ends,
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		log.Printf("Problem notifying %s alert %s: too many notifications queued", state, id)
+	}
+}
+
+// Run posts the queued notifications to -alerts.webhook-url in order,
+// retrying each up to -alerts.webhook-retries times with a doubling delay.
+func (n *alertNotifier) Run() {
+	for notification := range n.queue {
+		delay := time.Second
+		for attempt := 0; ; attempt++ {
+			configMu.RLock()
+			webhookURL, t, retries, logRetry := alertsWebhookURL, timeout, alertsWebhookRetries, verbose
+			configMu.RUnlock()
+			err := postNotification(webhookURL, t, notification)
+			if err == nil {
+				break
+			}
+			if attempt >= retries {
+				log.Printf("Problem notifying %s alert %s, giving up: %s", notification.State, notification.ID, err)
+				break
+			}
+			if logRetry {
+				log.Printf("Problem notifying %s alert %s, retrying in %s: %s", notification.State, notification.ID, delay, err)
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+// postNotification posts the notification as json to webhookURL.
+func postNotification(webhookURL string, timeout int, notification AlertNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("err: %d, %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// queued returns the notifications queued by n as "state id stations".
+func queued(n *alertNotifier) []string {
+	var notifications []string
+	for {
+		select {
+		case notification := <-n.queue:
+			notifications = append(notifications, fmt.Sprintf("%s %s %v", notification.State, notification.ID, notification.Stations))
+		default:
+			return notifications
+		}
+	}
+}
+
+func TestAlertNotifierUpdate(t *testing.T) {
+	defer func(url string) { alertsWebhookURL = url }(alertsWebhookURL)
+	alertsWebhookURL = "http://localhost/hook"
+	n := &alertNotifier{alerts: map[string]Alert{}, stations: map[string]map[string]bool{}, queue: make(chan AlertNotification, 10)}
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	storm := Alert{ID: "storm", Expires: now.Add(time.Hour)}
+	heat := Alert{ID: "heat", Expires: now.Add(time.Minute)}
+
+	steps := []struct {
+		station string
+		alerts  []Alert
+		now     time.Time
+		want    []string
+	}{
+		{"KPHL", []Alert{storm}, now, []string{"new storm [KPHL]"}},
+		// an alert is notified once however many stations it is active for
+		{"KBOS", []Alert{storm}, now, nil},
+		{"KPHL", []Alert{storm}, now, nil},
+		{"KPHL", nil, now, nil},
+		{"KBOS", nil, now, []string{"cancelled storm [KBOS]"}},
+		{"KPHL", []Alert{heat}, now, []string{"new heat [KPHL]"}},
+		{"KPHL", nil, now.Add(time.Minute), []string{"expired heat [KPHL]"}},
+	}
+	for i, step := range steps {
+		n.Update(step.station, step.alerts, step.now)
+		if got := queued(n); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: notified %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestAlertNotifierForget(t *testing.T) {
+	defer func(url string) { alertsWebhookURL = url }(alertsWebhookURL)
+	alertsWebhookURL = "http://localhost/hook"
+	n := &alertNotifier{alerts: map[string]Alert{}, stations: map[string]map[string]bool{}, queue: make(chan AlertNotification, 10)}
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	storm := Alert{ID: "storm", Expires: now.Add(time.Hour)}
+
+	n.Update("KPHL", []Alert{storm}, now)
+	n.Update("KBOS", []Alert{storm}, now)
+	queued(n)
+
+	// forgetting a station notifies nothing, and the alert stays active for
+	// the other station
+	n.Forget("KPHL")
+	n.Update("KBOS", []Alert{storm}, now)
+	if got := queued(n); got != nil {
+		t.Errorf("after forgetting KPHL, notified %v", got)
+	}
+	n.Forget("KBOS")
+	if len(n.alerts) != 0 || len(n.stations) != 0 {
+		t.Errorf("after forgetting every station, %d alerts are still tracked", len(n.alerts))
+	}
+	n.Update("KBOS", []Alert{storm}, now)
+	if got, want := queued(n), []string{"new storm [KBOS]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after forgetting every station, notified %v, want %v", got, want)
+	}
+}
+
+func TestRestartKeepsNotifiedAlerts(t *testing.T) {
+	m := quietManager(t)
+	now := time.Now()
+	alertNotifications.Update("KTST", []Alert{{ID: "storm", Expires: now.Add(time.Hour)}}, now)
+	defer alertNotifications.Forget("KTST")
+
+	m.Apply([]StationConfig{{ID: "KTST", Interval: time.Hour}})
+	m.Apply([]StationConfig{{ID: "KTST", Interval: 2 * time.Hour}})
+	alertNotifications.mu.Lock()
+	restarted := alertNotifications.stations["storm"]["KTST"]
+	alertNotifications.mu.Unlock()
+	if !restarted {
+		t.Error("restarting the station forgot its alerts, which would be notified again as new")
+	}
+
+	m.Apply(nil)
+	alertNotifications.mu.Lock()
+	removed := alertNotifications.stations["storm"]["KTST"]
+	alertNotifications.mu.Unlock()
+	if removed {
+		t.Error("removing the station kept its alerts")
+	}
+}
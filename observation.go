@@ -1,14 +1,250 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"log"
+	"math"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	humidity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "humidity_percent",
+			Help: "humidity gauge percentage",
+		},
+		[]string{"station"},
+	)
+	temperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "temperature_celsius",
+			Help: "temperature in celsius",
+		},
+		[]string{"station"},
+	)
+	dewpoint = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dewpoint_celsius",
+			Help: "dewpoint in celsius",
+		},
+		[]string{"station"},
+	)
+	winddirection = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_direction_degrees",
+			Help: "wind direction in degrees, absent in calm or variable winds",
+		},
+		[]string{"station"},
+	)
+	windDirectionSine = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_direction_sine",
+			Help: "sine of the wind direction, the east component of the direction the wind blows from",
+		},
+		[]string{"station"},
+	)
+	windDirectionCardinal = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_direction_cardinal_info",
+			Help: "compass direction the wind blows from, at the resolution of -wind.cardinal-points, always 1",
+		},
+		[]string{"station", "direction"},
+	)
+	windDirectionCosine = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_direction_cosine",
+			Help: "cosine of the wind direction, the north component of the direction the wind blows from",
+		},
+		[]string{"station"},
+	)
+	windspeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_speed_kilometers_per_hour",
+			Help: "wind speed in kilometers per hour",
+		},
+		[]string{"station"},
+	)
+	windgust = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_gust_kilometers_per_hour",
+			Help: "wind gust in kilometers per hour",
+		},
+		[]string{"station"},
+	)
+	barometricpressure = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barometric_pressure_pascals",
+			Help: "barometric pressure in pascals",
+		},
+		[]string{"station"},
+	)
+	sealevelpressure = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sealevel_pressure_pascals",
+			Help: "sealevel pressure in pascals",
+		},
+		[]string{"station"},
+	)
+	visibility = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "visibility_meters",
+			Help: "visibility in meters",
+		},
+		[]string{"station"},
+	)
+	heatindex = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "heat_index_celsius",
+			Help: "heat index in celsius, only reported in warm weather",
+		},
+		[]string{"station"},
+	)
+	windchill = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wind_chill_celsius",
+			Help: "wind chill in celsius, only reported in cold weather",
+		},
+		[]string{"station"},
+	)
+	maxTemperatureLast24Hours = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "temperature_max_last_24_hours_celsius",
+			Help: "maximum temperature over the last 24 hours in celsius, as of the last daily report",
+		},
+		[]string{"station"},
+	)
+	minTemperatureLast24Hours = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "temperature_min_last_24_hours_celsius",
+			Help: "minimum temperature over the last 24 hours in celsius, as of the last daily report",
+		},
+		[]string{"station"},
+	)
+	precipitationLastHour = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "precipitation_last_hour_millimeters",
+			Help: "precipitation over the last hour in millimeters",
+		},
+		[]string{"station"},
+	)
+	precipitationLast3Hours = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "precipitation_last_3_hours_millimeters",
+			Help: "precipitation over the last 3 hours in millimeters",
+		},
+		[]string{"station"},
+	)
+	precipitationLast6Hours = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "precipitation_last_6_hours_millimeters",
+			Help: "precipitation over the last 6 hours in millimeters",
+		},
+		[]string{"station"},
+	)
+	cloudLayerBase = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cloud_layer_base_meters",
+			Help: "base of each reported cloud layer in meters, labelled by its index from the lowest layer and its coverage",
+		},
+		[]string{"station", "layer", "amount"},
+	)
+	cloudCeiling = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cloud_ceiling_meters",
+			Help: "base of the lowest broken or overcast cloud layer in meters, absent when there is no ceiling",
+		},
+		[]string{"station"},
+	)
+	conditionsInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "conditions_info",
+			Help: "current conditions, with their text description and present weather codes, always 1",
+		},
+		[]string{"station", "description", "weather"},
+	)
+	observationTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "observation_timestamp_seconds",
+			Help: "time of the latest observation as a unix timestamp",
+		},
+		[]string{"station"},
+	)
+	timeSinceUpdate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "time_since_update_seconds",
+			Help: "seconds since last nws update",
+		},
+		[]string{"station"},
+	)
 )
 
+func init() {
+	metrics := []prometheus.Collector{
+		humidity, temperature, dewpoint, winddirection, windDirectionSine,
+		windDirectionCosine, windDirectionCardinal, windspeed, windgust,
+		barometricpressure, sealevelpressure, visibility, heatindex, windchill,
+		precipitationLastHour, precipitationLast3Hours, precipitationLast6Hours,
+		maxTemperatureLast24Hours, minTemperatureLast24Hours, cloudLayerBase,
+		cloudCeiling, conditionsInfo, observationTimestamp, timeSinceUpdate,
+		metarFallbacks, qualityControlInfo, qualityControlRejections,
+		temperatureFahrenheit, dewpointFahrenheit, heatIndexFahrenheit,
+		windChillFahrenheit, maxTemperatureLast24HoursFahrenheit,
+		minTemperatureLast24HoursFahrenheit, windSpeedMilesPerHour,
+		windGustMilesPerHour, barometricPressureInchesOfMercury,
+		sealevelPressureInchesOfMercury, visibilityMiles,
+		precipitationLastHourInches, precipitationLast3HoursInches,
+		precipitationLast6HoursInches,
+	}
+	metrics = append(metrics, derivedMetrics...)
+	registerCollector("observations", true, observationCollector{}, metrics...)
+}
+
+// observationCollector exports the latest observation of a station.
+type observationCollector struct{}
+
+func (observationCollector) observes() {}
+
+func (observationCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	addr, t := address, timeout
+	configMu.RUnlock()
+	response, rawJSON, err := RetrieveCurrentObservation(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if verbose {
+		log.Printf("raw json response for %s: %s", config.ID, rawJSON)
+	}
+
+	updateMetrics(config.ID, response)
+	if age := time.Since(response.Properties.Timestamp); staleAfter > 0 && age > staleAfter {
+		return &StaleError{Station: config.ID, Age: age}
+	}
+	return nil
+}
+
+// Forget drops the latest observation kept for the station.
+func (observationCollector) Forget(station string) {
+	forgetObservation(station)
+}
+
+// Measurement is a single value of an observation along with its unit and
+// quality control flag. Value is nil when the station did not report it.
+type Measurement struct {
+	Value          *float64 `json:"value"`
+	UnitCode       string   `json:"unitCode"`
+	QualityControl string   `json:"qualityControl"`
+}
+
 // ObservationResponse is the json structure returned by the national weather
 // service observations api.
 type ObservationResponse struct {
@@ -19,166 +255,278 @@ type ObservationResponse struct {
 		Coordinates []float64 `json:"coordinates"`
 	} `json:"geometry"`
 	Properties struct {
-		ID        string `json:"@id"`
-		Type      string `json:"@type"`
-		Elevation *struct {
-			Value    *float64 `json:"value"`
-			UnitCode string   `json:"unitCode"`
-		} `json:"elevation"`
-		Station         string    `json:"station"`
-		Timestamp       time.Time `json:"timestamp"`
-		RawMessage      string    `json:"rawMessage"`
-		TextDescription string    `json:"textDescription"`
-		Icon            *string   `json:"icon"`
-		PresentWeather  []any     `json:"presentWeather"`
-		Temperature     *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"temperature"`
-		Dewpoint *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"dewpoint"`
-		WindDirection *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"windDirection"`
-		WindSpeed *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"windSpeed"`
-		WindGust *struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl string `json:"qualityControl"`
-		} `json:"windGust"`
-		BarometricPressure *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"barometricPressure"`
-		SeaLevelPressure *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"seaLevelPressure"`
-		Visibility *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"visibility"`
-		MaxTemperatureLast24Hours *struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl any    `json:"qualityControl"`
-		} `json:"maxTemperatureLast24Hours"`
-		MinTemperatureLast24Hours *struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl any    `json:"qualityControl"`
-		} `json:"minTemperatureLast24Hours"`
-		PrecipitationLastHour *struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl string `json:"qualityControl"`
-		} `json:"precipitationLastHour"`
-		PrecipitationLast3Hours struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl string `json:"qualityControl"`
-		} `json:"precipitationLast3Hours"`
-		PrecipitationLast6Hours *struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl string `json:"qualityControl"`
-		} `json:"precipitationLast6Hours"`
-		RelativeHumidity *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"relativeHumidity"`
-		WindChill *struct {
-			Value          *any   `json:"value"`
-			UnitCode       string `json:"unitCode"`
-			QualityControl string `json:"qualityControl"`
-		} `json:"windChill"`
-		HeatIndex *struct {
-			Value          *float64 `json:"value"`
-			UnitCode       string   `json:"unitCode"`
-			QualityControl string   `json:"qualityControl"`
-		} `json:"heatIndex"`
-		CloudLayers *[]struct {
-			Base struct {
-				Value    *float64 `json:"value"`
-				UnitCode string   `json:"unitCode"`
-			} `json:"base"`
-			Amount string `json:"amount"`
+		ID              string       `json:"@id"`
+		Type            string       `json:"@type"`
+		Elevation       *Measurement `json:"elevation"`
+		Station         string       `json:"station"`
+		Timestamp       time.Time    `json:"timestamp"`
+		RawMessage      string       `json:"rawMessage"`
+		TextDescription string       `json:"textDescription"`
+		Icon            *string      `json:"icon"`
+		PresentWeather  []struct {
+			Intensity  *string `json:"intensity"`
+			Modifier   *string `json:"modifier"`
+			Weather    string  `json:"weather"`
+			RawString  string  `json:"rawString"`
+			InVicinity bool    `json:"inVicinity"`
+		} `json:"presentWeather"`
+		Temperature               *Measurement `json:"temperature"`
+		Dewpoint                  *Measurement `json:"dewpoint"`
+		WindDirection             *Measurement `json:"windDirection"`
+		WindSpeed                 *Measurement `json:"windSpeed"`
+		WindGust                  *Measurement `json:"windGust"`
+		BarometricPressure        *Measurement `json:"barometricPressure"`
+		SeaLevelPressure          *Measurement `json:"seaLevelPressure"`
+		Visibility                *Measurement `json:"visibility"`
+		MaxTemperatureLast24Hours *Measurement `json:"maxTemperatureLast24Hours"`
+		MinTemperatureLast24Hours *Measurement `json:"minTemperatureLast24Hours"`
+		PrecipitationLastHour     *Measurement `json:"precipitationLastHour"`
+		PrecipitationLast3Hours   *Measurement `json:"precipitationLast3Hours"`
+		PrecipitationLast6Hours   *Measurement `json:"precipitationLast6Hours"`
+		RelativeHumidity          *Measurement `json:"relativeHumidity"`
+		WindChill                 *Measurement `json:"windChill"`
+		HeatIndex                 *Measurement `json:"heatIndex"`
+		CloudLayers               *[]struct {
+			Base   Measurement `json:"base"`
+			Amount string      `json:"amount"`
 		} `json:"cloudLayers"`
 	} `json:"properties"`
 }
 
+// namedMeasurement is a measurement of an observation along with the name of
+// its property and the quantity it measures.
+type namedMeasurement struct {
+	property    string
+	quantity    Quantity
+	measurement **Measurement
+}
+
+// measurements returns every measurement of the response, pointing at the
+// response's own fields so they can be replaced.
+func (r *ObservationResponse) measurements() []namedMeasurement {
+	p := &r.Properties
+	return []namedMeasurement{
+		{"Temperature", Temperature, &p.Temperature},
+		{"Dewpoint", Temperature, &p.Dewpoint},
+		{"WindDirection", Angle, &p.WindDirection},
+		{"WindSpeed", Speed, &p.WindSpeed},
+		{"WindGust", Speed, &p.WindGust},
+		{"BarometricPressure", Pressure, &p.BarometricPressure},
+		{"SeaLevelPressure", Pressure, &p.SeaLevelPressure},
+		{"Visibility", Distance, &p.Visibility},
+		{"MaxTemperatureLast24Hours", Temperature, &p.MaxTemperatureLast24Hours},
+		{"MinTemperatureLast24Hours", Temperature, &p.MinTemperatureLast24Hours},
+		{"PrecipitationLastHour", Depth, &p.PrecipitationLastHour},
+		{"PrecipitationLast3Hours", Depth, &p.PrecipitationLast3Hours},
+		{"PrecipitationLast6Hours", Depth, &p.PrecipitationLast6Hours},
+		{"RelativeHumidity", Percent, &p.RelativeHumidity},
+		{"WindChill", Temperature, &p.WindChill},
+		{"HeatIndex", Temperature, &p.HeatIndex},
+		{"Elevation", Distance, &p.Elevation},
+	}
+}
+
 // RetrieveCurrentObservation performs a GET request agains a given national
 // weather service endpoint and returns the ObservationResponse object if the
 // request was successful, and return an error otherwise.
-func RetrieveCurrentObservation(station string, address string, timeout int) (ObservationResponse, []byte, error) {
+func RetrieveCurrentObservation(ctx context.Context, station string, address string, timeout int) (ObservationResponse, []byte, error) {
 	requestURL := url.URL{
 		Scheme: "https",
 		Host:   address,
 		Path:   fmt.Sprintf("/stations/%s/observations/latest", station),
 	}
 
-	client := http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
-	}
-
 	response := ObservationResponse{}
-
-	req, err := http.NewRequest("GET", requestURL.String(), nil)
+	body, err := retrieve(ctx, requestURL, timeout, &response)
 	if err != nil {
-		return response, nil, err
+		return ObservationResponse{}, nil, err
 	}
 
-	req.Header.Add("Accept", "application/geo+json")
+	return response, body, nil
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return response, nil, err
+// compassPoints are the points of a 16 point compass, clockwise from north.
+var compassPoints = []string{
+	"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE",
+	"S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW",
+}
+
+// CardinalDirection takes a given degree on a 360 degree axis and returns the
+// nearest direction of a compass with the given number of points, which must
+// be 4, 8 or 16. For example 30 degrees is "N" on a 4 point compass, "NE" on
+// an 8 point compass and "NNE" on a 16 point compass.
+func CardinalDirection(degree float64, points int) string {
+	sector := 360 / float64(points)
+	i := int(math.Mod(degree+sector/2, 360) / sector)
+	if i < 0 {
+		i += points
 	}
+	return compassPoints[i*len(compassPoints)/points]
+}
 
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return response, nil, err
+// updateMetrics sets the gauges for station from a successful observation
+// response, logging any properties the response did not include. Properties
+// missing from the response are first filled in from its raw METAR where
+// possible, then values failing quality control are dropped and the rest are
+// converted to the units the gauges are exported in.
+func updateMetrics(station string, response ObservationResponse) {
+	fillFromMETAR(station, &response)
+	applyQualityControl(station, &response)
+	normalizeUnits(station, &response)
+	storeObservation(station, response)
+	timeSinceUpdate.WithLabelValues(station).Set(time.Since(response.Properties.Timestamp).Seconds())
+	observationTimestamp.WithLabelValues(station).Set(float64(response.Properties.Timestamp.UnixNano()) / 1e9)
+
+	var missingProperties []string
+	if response.Properties.RelativeHumidity != nil && response.Properties.RelativeHumidity.Value != nil {
+		humidity.WithLabelValues(station).Set(*response.Properties.RelativeHumidity.Value)
+	} else {
+		missingProperties = append(missingProperties, "RelativeHumidity")
+	}
+	if response.Properties.Temperature != nil && response.Properties.Temperature.Value != nil {
+		setGauge(temperature, station, *response.Properties.Temperature.Value)
+	} else {
+		missingProperties = append(missingProperties, "Temperature")
+	}
+	if response.Properties.Dewpoint != nil && response.Properties.Dewpoint.Value != nil {
+		setGauge(dewpoint, station, *response.Properties.Dewpoint.Value)
+	} else {
+		missingProperties = append(missingProperties, "Dewpoint")
+	}
+	// the direction is null in calm or variable winds, so the series are
+	// removed rather than left at the last direction
+	if response.Properties.WindDirection != nil && response.Properties.WindDirection.Value != nil {
+		direction := *response.Properties.WindDirection.Value
+		winddirection.WithLabelValues(station).Set(direction)
+		if windDirectionComponents {
+			radians := direction * math.Pi / 180
+			windDirectionSine.WithLabelValues(station).Set(math.Sin(radians))
+			windDirectionCosine.WithLabelValues(station).Set(math.Cos(radians))
+		}
+		windDirectionCardinal.DeletePartialMatch(prometheus.Labels{"station": station})
+		if windCardinalPoints != 0 {
+			windDirectionCardinal.WithLabelValues(station, CardinalDirection(direction, windCardinalPoints)).Set(1)
+		}
+	} else {
+		winddirection.DeleteLabelValues(station)
+		windDirectionCardinal.DeletePartialMatch(prometheus.Labels{"station": station})
+		windDirectionSine.DeleteLabelValues(station)
+		windDirectionCosine.DeleteLabelValues(station)
+		missingProperties = append(missingProperties, "WindDirection")
+	}
+	if response.Properties.WindSpeed != nil && response.Properties.WindSpeed.Value != nil {
+		setGauge(windspeed, station, *response.Properties.WindSpeed.Value)
+	} else {
+		missingProperties = append(missingProperties, "WindSpeed")
+	}
+	// gusts are only reported while it is gusting, so a missing gust is not
+	// logged and removes the series rather than leaving a stale value behind
+	if response.Properties.WindGust != nil && response.Properties.WindGust.Value != nil {
+		setGauge(windgust, station, *response.Properties.WindGust.Value)
+	} else {
+		deleteGauge(windgust, station)
+	}
+	if response.Properties.BarometricPressure != nil && response.Properties.BarometricPressure.Value != nil {
+		setGauge(barometricpressure, station, *response.Properties.BarometricPressure.Value)
+	} else {
+		missingProperties = append(missingProperties, "BarometricPressure")
+	}
+	if response.Properties.SeaLevelPressure != nil && response.Properties.SeaLevelPressure.Value != nil {
+		setGauge(sealevelpressure, station, *response.Properties.SeaLevelPressure.Value)
+	} else {
+		missingProperties = append(missingProperties, "SeaLevelPressure")
 	}
+	if response.Properties.Visibility != nil && response.Properties.Visibility.Value != nil {
+		setGauge(visibility, station, *response.Properties.Visibility.Value)
+	} else {
+		missingProperties = append(missingProperties, "Visibility")
+	}
+	// like gusts, heat index and wind chill are only reported when they apply
+	if response.Properties.HeatIndex != nil && response.Properties.HeatIndex.Value != nil {
+		setGauge(heatindex, station, *response.Properties.HeatIndex.Value)
+	} else {
+		deleteGauge(heatindex, station)
+	}
+	if response.Properties.WindChill != nil && response.Properties.WindChill.Value != nil {
+		setGauge(windchill, station, *response.Properties.WindChill.Value)
+	} else {
+		deleteGauge(windchill, station)
+	}
+	// precipitation totals are only part of some reports, the 3 and 6 hour
+	// totals for example are only reported every 3 hours
+	if response.Properties.PrecipitationLastHour != nil && response.Properties.PrecipitationLastHour.Value != nil {
+		setGauge(precipitationLastHour, station, *response.Properties.PrecipitationLastHour.Value)
+	} else {
+		deleteGauge(precipitationLastHour, station)
+	}
+	if response.Properties.PrecipitationLast3Hours != nil && response.Properties.PrecipitationLast3Hours.Value != nil {
+		setGauge(precipitationLast3Hours, station, *response.Properties.PrecipitationLast3Hours.Value)
+	} else {
+		deleteGauge(precipitationLast3Hours, station)
+	}
+	if response.Properties.PrecipitationLast6Hours != nil && response.Properties.PrecipitationLast6Hours.Value != nil {
+		setGauge(precipitationLast6Hours, station, *response.Properties.PrecipitationLast6Hours.Value)
+	} else {
+		deleteGauge(precipitationLast6Hours, station)
+	}
+	// the 24 hour extremes are only part of the daily summary report, so the
+	// last reported values are kept until the next one
+	if response.Properties.MaxTemperatureLast24Hours != nil && response.Properties.MaxTemperatureLast24Hours.Value != nil {
+		setGauge(maxTemperatureLast24Hours, station, *response.Properties.MaxTemperatureLast24Hours.Value)
+	}
+	if response.Properties.MinTemperatureLast24Hours != nil && response.Properties.MinTemperatureLast24Hours.Value != nil {
+		setGauge(minTemperatureLast24Hours, station, *response.Properties.MinTemperatureLast24Hours.Value)
+	}
+	updateCloudLayers(station, response)
+	updateConditions(station, response)
+	updateDerived(station, response)
+	if len(missingProperties) != 0 {
+		log.Printf("some properties are missing in the response for %s: %v", station, missingProperties)
+	}
+}
 
-	if resp.StatusCode != 200 {
-		return ObservationResponse{}, nil, fmt.Errorf("err: %d, %s", resp.StatusCode, string(body))
+// updateCloudLayers replaces the station's cloud layer series with the layers
+// of the response and sets its ceiling, the lowest layer covering at least
+// five eighths of the sky.
+func updateCloudLayers(station string, response ObservationResponse) {
+	cloudLayerBase.DeletePartialMatch(prometheus.Labels{"station": station})
+	if response.Properties.CloudLayers == nil {
+		cloudCeiling.DeleteLabelValues(station)
+		return
 	}
 
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return response, nil, err
+	var ceiling *float64
+	for i, layer := range *response.Properties.CloudLayers {
+		if layer.Base.Value == nil {
+			continue
+		}
+		cloudLayerBase.WithLabelValues(station, strconv.Itoa(i), layer.Amount).Set(*layer.Base.Value)
+		switch layer.Amount {
+		case "BKN", "OVC", "VV":
+			if ceiling == nil || *layer.Base.Value < *ceiling {
+				ceiling = layer.Base.Value
+			}
+		}
 	}
 
-	return response, body, err
+	if ceiling != nil {
+		cloudCeiling.WithLabelValues(station).Set(*ceiling)
+	} else {
+		cloudCeiling.DeleteLabelValues(station)
+	}
 }
 
-// CardinalDirection takes a given degree on a 360 degree axis and returns the
-// cardinal direction of the given degree. This being either North, South, East
-// or West.
-func CardinalDirection(degree float64) string {
-	switch {
-	case degree >= 0 && degree < 45 || degree > 315 && degree <= 360:
-		return "North"
-	case degree >= 45 && degree <= 135:
-		return "East"
-	case degree > 135 && degree < 225:
-		return "South"
-	default:
-		return "West"
+// updateConditions replaces the station's conditions info series with the
+// text description and present weather of the response. The weather label
+// holds the METAR codes of the present weather, such as "-RA BR".
+func updateConditions(station string, response ObservationResponse) {
+	var codes []string
+	for _, weather := range response.Properties.PresentWeather {
+		if weather.RawString != "" {
+			codes = append(codes, weather.RawString)
+		}
 	}
+
+	conditionsInfo.DeletePartialMatch(prometheus.Labels{"station": station})
+	conditionsInfo.WithLabelValues(station, response.Properties.TextDescription, strings.Join(codes, " ")).Set(1)
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PointResponse is the json structure returned by the national weather
+// service points api, describing the forecast grid covering a location.
+type PointResponse struct {
+	ID       string `json:"id"`
+	Geometry struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		ID                  string `json:"@id"`
+		GridID              string `json:"gridId"`
+		GridX               int    `json:"gridX"`
+		GridY               int    `json:"gridY"`
+		Forecast            string `json:"forecast"`
+		ForecastHourly      string `json:"forecastHourly"`
+		ForecastGridData    string `json:"forecastGridData"`
+		ObservationStations string `json:"observationStations"`
+		ForecastZone        string `json:"forecastZone"`
+		County              string `json:"county"`
+		FireWeatherZone     string `json:"fireWeatherZone"`
+		TimeZone            string `json:"timeZone"`
+	} `json:"properties"`
+}
+
+// StationsResponse is the json structure returned by the national weather
+// service when listing observation stations.
+type StationsResponse struct {
+	Features []struct {
+		ID       string `json:"id"`
+		Geometry struct {
+			Type        string    `json:"type"`
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			StationIdentifier string `json:"stationIdentifier"`
+			Name              string `json:"name"`
+			TimeZone          string `json:"timeZone"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// StationResponse is the json structure returned by the national weather
+// service for a single observation station.
+type StationResponse struct {
+	ID       string `json:"id"`
+	Geometry struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		StationIdentifier string `json:"stationIdentifier"`
+		Name              string `json:"name"`
+		TimeZone          string `json:"timeZone"`
+		Elevation         struct {
+			Value    *float64 `json:"value"`
+			UnitCode string   `json:"unitCode"`
+		} `json:"elevation"`
+		Forecast        string `json:"forecast"`
+		County          string `json:"county"`
+		FireWeatherZone string `json:"fireWeatherZone"`
+	} `json:"properties"`
+}
+
+// RetrieveStation looks up the metadata of a single observation station.
+func RetrieveStation(ctx context.Context, station string, address string, timeout int) (StationResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   fmt.Sprintf("/stations/%s", station),
+	}
+
+	response := StationResponse{}
+	_, err := retrieve(ctx, requestURL, timeout, &response)
+	return response, err
+}
+
+// ParseLatLon parses a location given as "latitude,longitude".
+func ParseLatLon(latlon string) (float64, float64, error) {
+	rawLat, rawLon, ok := strings.Cut(latlon, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid location %q, expected latitude,longitude", latlon)
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(rawLat), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("invalid latitude in %q", latlon)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(rawLon), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("invalid longitude in %q", latlon)
+	}
+
+	return lat, lon, nil
+}
+
+// RetrievePoint looks up the forecast grid and related resources covering the
+// given latitude and longitude.
+func RetrievePoint(ctx context.Context, lat, lon float64, address string, timeout int) (PointResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		// the api only accepts up to four decimal places
+		Path: fmt.Sprintf("/points/%.4f,%.4f", lat, lon),
+	}
+
+	response := PointResponse{}
+	_, err := retrieve(ctx, requestURL, timeout, &response)
+	return response, err
+}
+
+// RetrieveGridpointStations returns the observation stations near the given
+// point, ordered from nearest to farthest.
+func RetrieveGridpointStations(ctx context.Context, point PointResponse, address string, timeout int) (StationsResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path: fmt.Sprintf("/gridpoints/%s/%d,%d/stations",
+			point.Properties.GridID, point.Properties.GridX, point.Properties.GridY),
+	}
+
+	response := StationsResponse{}
+	_, err := retrieve(ctx, requestURL, timeout, &response)
+	return response, err
+}
+
+// NearestStations resolves up to n observation stations nearest to the
+// location given as "latitude,longitude", ordered from nearest to farthest.
+func NearestStations(ctx context.Context, latlon string, n int, address string, timeout int) ([]string, error) {
+	lat, lon, err := ParseLatLon(latlon)
+	if err != nil {
+		return nil, err
+	}
+
+	point, err := RetrievePoint(ctx, lat, lon, address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("looking up point %s: %w", latlon, err)
+	}
+
+	stations, err := RetrieveGridpointStations(ctx, point, address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("looking up stations near %s: %w", latlon, err)
+	}
+	if len(stations.Features) == 0 {
+		return nil, fmt.Errorf("no observation stations found near %s", latlon)
+	}
+
+	var ids []string
+	for _, feature := range stations.Features {
+		if len(ids) == n {
+			break
+		}
+		ids = append(ids, feature.Properties.StationIdentifier)
+	}
+	return ids, nil
+}
+
+// stationPoints caches the point of every station looked up by StationPoint,
+// since the forecast grid covering a station never changes.
+var stationPoints = struct {
+	sync.Mutex
+	points map[string]PointResponse
+}{points: map[string]PointResponse{}}
+
+// StationPoint looks up the forecast grid and related resources covering the
+// location of an observation station.
+func StationPoint(ctx context.Context, station string, address string, timeout int) (PointResponse, error) {
+	stationPoints.Lock()
+	point, ok := stationPoints.points[station]
+	stationPoints.Unlock()
+	if ok {
+		return point, nil
+	}
+
+	metadata, err := RetrieveStation(ctx, station, address, timeout)
+	if err != nil {
+		return PointResponse{}, fmt.Errorf("looking up station %s: %w", station, err)
+	}
+	if len(metadata.Geometry.Coordinates) < 2 {
+		return PointResponse{}, fmt.Errorf("station %s has no location", station)
+	}
+	lon, lat := metadata.Geometry.Coordinates[0], metadata.Geometry.Coordinates[1]
+	point, err = RetrievePoint(ctx, lat, lon, address, timeout)
+	if err != nil {
+		return PointResponse{}, fmt.Errorf("looking up point of station %s: %w", station, err)
+	}
+
+	stationPoints.Lock()
+	stationPoints.points[station] = point
+	stationPoints.Unlock()
+	return point, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// minPrecipitationReportGap is the shortest time between two hourly
+// precipitation reports that are both counted. Special reports issued between
+// the hourly ones repeat the precipitation since the last hourly report, so
+// counting them as well would count the same precipitation twice.
+const minPrecipitationReportGap = 45 * time.Minute
+
+func init() {
+	addAccumulation(&Accumulation{
+		Name:      "precipitation_total_meters",
+		Help:      "precipitation in meters, summed over the hourly precipitation reports",
+		TodayName: "precipitation_today_meters",
+		TodayHelp: "precipitation in meters since local midnight",
+		Discrete:  true,
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			millimeters, ok := value(response.Properties.PrecipitationLastHour)
+			if !ok || millimeters < 0 {
+				return 0, false
+			}
+			if elapsed != 0 && elapsed < minPrecipitationReportGap {
+				return 0, false
+			}
+			return millimeters / 1000, true
+		},
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ProbeHandler serves the series of a single station at
+// /probe?station=KPHL, following the multi-target exporter pattern where
+// prometheus holds the list of stations and drives when each is scraped.
+// The optional type, tide_station and normals_station parameters configure
+// the station as in the -config file.
+//
+// Stations not scraped by the exporter itself are retrieved live for every
+// probe, without the side effects of a scrape, and their series dropped
+// afterwards. Stations it already scrapes are
+// answered with the series of their latest scrape, rather than retrieving
+// them twice.
+type ProbeHandler struct {
+	Manager  *StationManager
+	Gatherer prometheus.Gatherer
+
+	mu      sync.Mutex
+	probing map[string]*probeLock
+}
+
+// probeLock is held while probing a station, and counts the probes of the
+// station running or waiting for it.
+type probeLock struct {
+	sync.Mutex
+	probes int
+}
+
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("station") == "" {
+		http.Error(w, "station parameter is missing", http.StatusBadRequest)
+		return
+	}
+	config, err := stationJSON{
+		ID:             query.Get("station"),
+		Type:           query.Get("type"),
+		TideStation:    query.Get("tide_station"),
+		NormalsStation: query.Get("normals_station"),
+	}.config()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "1 when retrieving the station succeeded, 0 when it failed",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "time taken to retrieve the station in seconds",
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccess, probeDuration)
+
+	gatherer := StationGatherer{Gatherer: h.Gatherer, Station: config.ID}
+	if h.Manager.Running(config.ID) {
+		probeSuccess.Set(1)
+		promhttp.HandlerFor(prometheus.Gatherers{gatherer, registry}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		return
+	}
+
+	// probes of the same station wait for each other, so that one does not
+	// drop the series of another before it is served
+	h.acquire(config.ID)
+	defer h.release(config.ID)
+	setProbing(config.ID, true)
+	defer setProbing(config.ID, false)
+	defer deleteMetrics(config.ID)
+
+	start := time.Now()
+	if err := collect(r.Context(), config); err != nil {
+		log.Printf("Problem probing station %s: %s", config.ID, err)
+	} else {
+		probeSuccess.Set(1)
+	}
+	probeDuration.Set(time.Since(start).Seconds())
+	promhttp.HandlerFor(prometheus.Gatherers{gatherer, registry}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// probedStations are the stations being probed live. Retrieving them leaves no
+// trace beyond their series: their alerts are neither notified nor pushed,
+// their totals are not accumulated, and neither their circuit breaker nor
+// nws_scrape_errors_total is updated.
+var probedStations = struct {
+	sync.Mutex
+	stations map[string]bool
+}{stations: map[string]bool{}}
+
+// probing reports whether the station is being probed live.
+func probing(station string) bool {
+	probedStations.Lock()
+	defer probedStations.Unlock()
+	return probedStations.stations[station]
+}
+
+// setProbing marks the station as being probed live or not.
+func setProbing(station string, on bool) {
+	probedStations.Lock()
+	defer probedStations.Unlock()
+	if on {
+		probedStations.stations[station] = true
+	} else {
+		delete(probedStations.stations, station)
+	}
+}
+
+// acquire waits for other probes of the station to finish.
+func (h *ProbeHandler) acquire(station string) {
+	h.mu.Lock()
+	if h.probing == nil {
+		h.probing = map[string]*probeLock{}
+	}
+	lock, ok := h.probing[station]
+	if !ok {
+		lock = &probeLock{}
+		h.probing[station] = lock
+	}
+	lock.probes++
+	h.mu.Unlock()
+	lock.Lock()
+}
+
+// release lets the next probe of the station run, forgetting the station once
+// no more are waiting.
+func (h *ProbeHandler) release(station string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lock := h.probing[station]
+	lock.Unlock()
+	if lock.probes--; lock.probes == 0 {
+		delete(h.probing, station)
+	}
+}
+
+// StationGatherer keeps only the series of Gatherer labelled with Station,
+// dropping metric families left without any.
+type StationGatherer struct {
+	Gatherer prometheus.Gatherer
+	Station  string
+}
+
+func (g StationGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	filtered := families[:0]
+	for _, family := range families {
+		var metrics []*dto.Metric
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "station" && label.GetValue() == g.Station {
+					metrics = append(metrics, metric)
+					break
+				}
+			}
+		}
+		if len(metrics) != 0 {
+			family.Metric = metrics
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered, err
+}
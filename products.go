@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// productIssuances exports when the latest product of each type was issued
+// by each forecast office.
+var productIssuances = &productTimer{
+	issued: map[productKey]time.Time{},
+	timestamp: prometheus.NewDesc("product_issue_timestamp_seconds",
+		"time the latest text product of each type was issued by the forecast office as a unix timestamp",
+		[]string{"office", "type"}, nil),
+	age: prometheus.NewDesc("product_age_seconds",
+		"seconds since the latest text product of each type was issued by the forecast office",
+		[]string{"office", "type"}, nil),
+}
+
+func init() {
+	registerCollector("products", false, &productsCollector{}, productIssuances)
+}
+
+// productsCollector exports the freshness of the text products listed in
+// -products.types issued by -products.office, or by the forecast office
+// covering each station. Offices are refreshed every -products.interval
+// however many of the stations they cover.
+type productsCollector struct {
+	refreshTracker
+}
+
+func (c *productsCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	office, types, interval, addr, t := strings.ToUpper(productsOffice), productTypes, productsInterval, address, timeout
+	configMu.RUnlock()
+	if office == "" {
+		point, err := StationPoint(ctx, config.ID, addr, t)
+		if err != nil {
+			return err
+		}
+		office = point.Properties.GridID
+	}
+	// stations covered by the same office share its products, which are
+	// claimed by the first of them to find them due
+	if !c.Claim(office, interval) {
+		return nil
+	}
+
+	var failed CollectError
+	for _, productType := range ParseProductTypes(types) {
+		issued, err := RetrieveLatestProduct(ctx, productType, office, addr, t)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("retrieving %s products of %s: %w", productType, office, err))
+			continue
+		}
+		productIssuances.Set(office, productType, issued)
+	}
+	if len(failed) != 0 {
+		c.Forget(office)
+		return failed
+	}
+	return nil
+}
+
+// ParseProductTypes parses a comma separated list of product type codes, such
+// as "AFD,HWO".
+func ParseProductTypes(types string) []string {
+	var codes []string
+	for _, code := range strings.Split(types, ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// ProductsResponse is the json structure returned by the national weather
+// service when listing text products.
+type ProductsResponse struct {
+	Graph []struct {
+		ID            string    `json:"id"`
+		IssuingOffice string    `json:"issuingOffice"`
+		IssuanceTime  time.Time `json:"issuanceTime"`
+		ProductCode   string    `json:"productCode"`
+		ProductName   string    `json:"productName"`
+	} `json:"@graph"`
+}
+
+// RetrieveLatestProduct returns when the latest product of the type was
+// issued by the office, or the zero time when the office has not issued any.
+func RetrieveLatestProduct(ctx context.Context, productType, office string, address string, timeout int) (time.Time, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   fmt.Sprintf("/products/types/%s/locations/%s", productType, office),
+	}
+
+	response := ProductsResponse{}
+	if _, err := retrieve(ctx, requestURL, timeout, &response); err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, product := range response.Graph {
+		if product.IssuanceTime.After(latest) {
+			latest = product.IssuanceTime
+		}
+	}
+	return latest, nil
+}
+
+// productKey identifies the products of a type issued by an office.
+type productKey struct {
+	office, productType string
+}
+
+// productTimer exports the issue times of the latest products. The age is
+// worked out when the metrics are collected, so it keeps growing between
+// retrievals of the products.
+type productTimer struct {
+	mu     sync.Mutex
+	issued map[productKey]time.Time
+
+	timestamp, age *prometheus.Desc
+}
+
+// Set records when the latest product of the type was issued by the office,
+// the zero time forgetting it.
+func (p *productTimer) Set(office, productType string, issued time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := productKey{office, productType}
+	if issued.IsZero() {
+		delete(p.issued, key)
+		return
+	}
+	p.issued[key] = issued
+}
+
+func (p *productTimer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.timestamp
+	ch <- p.age
+}
+
+func (p *productTimer) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for key, issued := range p.issued {
+		ch <- prometheus.MustNewConstMetric(p.timestamp, prometheus.GaugeValue, float64(issued.Unix()), key.office, key.productType)
+		ch <- prometheus.MustNewConstMetric(p.age, prometheus.GaugeValue, now.Sub(issued).Seconds(), key.office, key.productType)
+	}
+}
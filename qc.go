@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	qualityControlInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quality_control_info",
+			Help: "quality control code of each property of the latest observation, always 1",
+		},
+		[]string{"station", "property", "code"},
+	)
+	qualityControlRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quality_control_rejections_total",
+			Help: "number of observation values dropped because of their quality control code",
+		},
+		[]string{"station", "property", "code"},
+	)
+)
+
+// qualityControlCodes describes the quality control codes the api attaches
+// to observation values.
+//
+//	Z  preliminary, no quality control applied
+//	C  coarse pass, passed level 1
+//	S  screened, passed levels 1 and 2
+//	V  verified, passed levels 1, 2 and 3
+//	X  rejected, failed level 1
+//	Q  questioned, passed level 1 but failed level 2 or 3
+//	G  subjective good
+//	B  subjective bad
+//
+// Codes listed in -qc.reject, X and B by default, cause the value to be
+// treated as missing.
+func rejectedQualityControlCodes() map[string]bool {
+	rejected := map[string]bool{}
+	for _, code := range strings.Split(qcReject, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			rejected[code] = true
+		}
+	}
+	return rejected
+}
+
+// applyQualityControl exports the quality control code of every value of the
+// response and drops the values whose code is rejected, counting each one.
+func applyQualityControl(station string, response *ObservationResponse) {
+	rejected := rejectedQualityControlCodes()
+	qualityControlInfo.DeletePartialMatch(prometheus.Labels{"station": station})
+	for _, m := range response.measurements() {
+		measurement := *m.measurement
+		if measurement == nil || measurement.Value == nil || measurement.QualityControl == "" {
+			continue
+		}
+
+		code := measurement.QualityControl
+		qualityControlInfo.WithLabelValues(station, m.property, code).Set(1)
+		if rejected[code] {
+			qualityControlRejections.WithLabelValues(station, m.property, code).Inc()
+			measurement.Value = nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RefreshHandler makes the stations scrape straight away on POST /-/refresh,
+// or only the stations given with ?station=KPHL,KJFK. Stations that are not
+// being scraped are not found, while the others given are still refreshed.
+type RefreshHandler struct {
+	Manager *StationManager
+}
+
+func (h RefreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed, use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var ids []string
+	if param := r.URL.Query().Get("station"); param != "" {
+		for _, id := range strings.Split(param, ",") {
+			ids = append(ids, strings.TrimSpace(id))
+		}
+	}
+	refreshed := h.Manager.Refresh(ids...)
+	if len(ids) != 0 && len(refreshed) != len(ids) {
+		found := map[string]bool{}
+		for _, id := range refreshed {
+			found[id] = true
+		}
+		var missing []string
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		http.Error(w, fmt.Sprintf("not scraping station %s", strings.Join(missing, ", ")), http.StatusNotFound)
+		return
+	}
+	fmt.Fprintf(w, "refreshing %s\n", strings.Join(refreshed, ", "))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configReloadSuccessful = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "exporter_config_last_reload_successful",
+			Help: "1 when the latest load of the configuration succeeded, 0 when it failed",
+		},
+	)
+	configReloadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "exporter_config_last_reload_success_timestamp_seconds",
+			Help: "time of the latest successful load of the configuration as a unix timestamp",
+		},
+	)
+)
+
+// recordReload sets the reload metrics from the result of loading the
+// configuration, at startup or on a reload.
+func recordReload(err error) {
+	if err != nil {
+		configReloadSuccessful.Set(0)
+		return
+	}
+	configReloadSuccessful.Set(1)
+	configReloadTimestamp.SetToCurrentTime()
+}
+
+// Reloader re-reads the -config file while the exporter is running. Station
+// and interval changes are applied to the running scrape loops and logging
+// options take effect immediately, while options only used at startup, such
+// as the listen address, need a restart.
+type Reloader struct {
+	Manager *StationManager
+
+	mu sync.Mutex
+}
+
+// Reload re-reads the config file and applies it.
+func (r *Reloader) Reload() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() { recordReload(err) }()
+
+	if configFile == "" {
+		return errors.New("no -config file to reload")
+	}
+	if err := LoadConfig(configFile); err != nil {
+		return err
+	}
+
+	// stations found through -latlon or listed in -stations-file are managed
+	// on their own
+	configMu.RLock()
+	manageStations := latlon == "" && stationsFile == ""
+	configs, err := stationList()
+	configMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	// configMu is released first, as stopping a scrape loop waits for its
+	// scrape, which holds it
+	if manageStations {
+		r.Manager.Apply(configs)
+	}
+
+	log.Printf("Reloaded configuration from %s", configFile)
+	return nil
+}
+
+// WatchSignals reloads the configuration whenever the process receives
+// SIGHUP.
+func (r *Reloader) WatchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := r.Reload(); err != nil {
+			log.Printf("Problem reloading configuration: %s", err)
+		}
+	}
+}
+
+// ServeHTTP reloads the configuration on POST /-/reload.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed, use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.Reload(); err != nil {
+		log.Printf("Problem reloading configuration: %s", err)
+		http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "config reloaded")
+}
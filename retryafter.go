@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var retryAfterDelay = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "upstream_retry_after_seconds",
+		Help: "delay requested by the latest 429 or 503 response of the host with a Retry-After header in seconds, 0 once the host answers otherwise",
+	},
+	[]string{"host"},
+)
+
+// RetryAfterError is returned instead of making a request to a host that asked
+// to be left alone until Until with a Retry-After header.
+type RetryAfterError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s asked not to be retried for another %v", e.Host, time.Until(e.Until).Round(time.Second))
+}
+
+// heldHosts holds the time until which each host asked not to be retried.
+var heldHosts = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: map[string]time.Time{}}
+
+// checkHeld returns a RetryAfterError while the host asked not to be retried.
+func checkHeld(host string) error {
+	heldHosts.Lock()
+	defer heldHosts.Unlock()
+	if until, ok := heldHosts.until[host]; ok && time.Now().Before(until) {
+		return &RetryAfterError{Host: host, Until: until}
+	}
+	return nil
+}
+
+// recordRetryAfter holds the host for the delay of the response's Retry-After
+// header when it is a 429 or 503, returning the delay, and releases it on any
+// other response.
+func recordRetryAfter(host string, resp *http.Response) time.Duration {
+	var delay time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		delay = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+
+	heldHosts.Lock()
+	defer heldHosts.Unlock()
+	if delay > 0 {
+		heldHosts.until[host] = time.Now().Add(delay)
+	} else {
+		delete(heldHosts.until, host)
+	}
+	retryAfterDelay.WithLabelValues(host).Set(delay.Seconds())
+	return delay
+}
+
+// requestedDelay returns how long the hosts whose requests failed with err
+// asked not to be retried for, the longest of them when err is a CollectError,
+// or 0 when none did.
+func requestedDelay(err error) time.Duration {
+	var failed CollectError
+	if errors.As(err, &failed) {
+		var longest time.Duration
+		for _, err := range failed {
+			if d := requestedDelay(err); d > longest {
+				longest = d
+			}
+		}
+		return longest
+	}
+	var statusErr *StatusError
+	var retryAfterErr *RetryAfterError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.RetryAfter
+	case errors.As(err, &retryAfterErr):
+		return time.Until(retryAfterErr.Until)
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header, given either as a number of
+// seconds or as an http date, into the delay from now it asks for. Missing or
+// invalid headers, and dates in the past, give 0.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	delays := map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		" 5 ":                           5 * time.Second,
+		"Sat, 15 Jun 2024 12:01:30 GMT": 90 * time.Second,
+	}
+	for header, want := range delays {
+		if got := parseRetryAfter(header, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+
+	// missing, invalid and past delays are not held
+	for _, header := range []string{"", "0", "-5", "soon", "Sat, 15 Jun 2024 11:59:00 GMT"} {
+		if got := parseRetryAfter(header, now); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %v, want 0", header, got)
+		}
+	}
+}
+
+func TestRecordRetryAfter(t *testing.T) {
+	const host = "retry-after.test"
+	defer retryAfterDelay.DeleteLabelValues(host)
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	if delay := recordRetryAfter(host, response(http.StatusTooManyRequests, "60")); delay != time.Minute {
+		t.Fatalf("recordRetryAfter of a 429 = %v, want 1m", delay)
+	}
+	var held *RetryAfterError
+	if err := checkHeld(host); !errors.As(err, &held) || held.Host != host {
+		t.Fatalf("checkHeld after a 429 = %v, want a RetryAfterError for %s", err, host)
+	}
+
+	// a Retry-After on a response other than a 429 or 503 is ignored, and
+	// releases the host
+	if delay := recordRetryAfter(host, response(http.StatusOK, "60")); delay != 0 {
+		t.Errorf("recordRetryAfter of a 200 = %v, want 0", delay)
+	}
+	if err := checkHeld(host); err != nil {
+		t.Errorf("checkHeld after a 200 = %v, want nil", err)
+	}
+}
+
+func TestRequestedDelay(t *testing.T) {
+	held := &RetryAfterError{Host: "api.weather.gov", Until: time.Now().Add(time.Hour)}
+	limited := &StatusError{StatusCode: 429, RetryAfter: 30 * time.Second}
+
+	if got := requestedDelay(limited); got != 30*time.Second {
+		t.Errorf("requestedDelay(%v) = %v, want 30s", limited, got)
+	}
+	// the delay until a held host is released shrinks as the test runs
+	if got := requestedDelay(held); got > time.Hour || got < 59*time.Minute {
+		t.Errorf("requestedDelay(%v) = %v, want 1h", held, got)
+	}
+	if got := requestedDelay(CollectError{errors.New("failed"), limited, held}); got < 59*time.Minute {
+		t.Errorf("requestedDelay of a CollectError = %v, want the longest delay of its errors", got)
+	}
+	for _, err := range []error{&StatusError{StatusCode: 503}, CollectError{errors.New("failed")}, errors.New("failed")} {
+		if got := requestedDelay(err); got != 0 {
+			t.Errorf("requestedDelay(%v) = %v, want 0", err, got)
+		}
+	}
+}
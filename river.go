@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	riverStage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "river_stage_meters",
+			Help: "latest observed stage of the river gauge in meters",
+		},
+		[]string{"gauge"},
+	)
+	riverFlow = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "river_flow_cubic_meters_per_second",
+			Help: "latest observed flow of the river gauge in cubic meters per second",
+		},
+		[]string{"gauge"},
+	)
+	riverFloodStage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "river_flood_stage_meters",
+			Help: "stage of the river gauge in meters at which each flood category begins",
+		},
+		[]string{"gauge", "category"},
+	)
+	riverFloodFlow = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "river_flood_flow_cubic_meters_per_second",
+			Help: "flow of the river gauge in cubic meters per second at which each flood category begins",
+		},
+		[]string{"gauge", "category"},
+	)
+)
+
+// floodCategories are the flood categories of river gauges, least severe
+// first.
+var floodCategories = []string{"action", "minor", "moderate", "major"}
+
+func init() {
+	registerGlobalCollector("river", false, &riverCollector{}, riverStage, riverFlow, riverFloodStage, riverFloodFlow)
+}
+
+// riverCollector exports the observed stage and flow of the river gauges listed
+// in -river.gauges along with their flood categories, retrieved from the
+// national water prediction service at -river.address. The gauges do not
+// belong to a station, so they are retrieved every -river.interval on a loop
+// of their own.
+type riverCollector struct {
+	refreshTracker
+}
+
+// Interval returns -river.interval, read holding configMu.
+func (c *riverCollector) Interval() time.Duration {
+	return riverInterval
+}
+
+// UpdateGlobal retrieves every gauge that is due, carrying on past the gauges
+// that fail, which are retried on the next run.
+func (c *riverCollector) UpdateGlobal(ctx context.Context) error {
+	configMu.RLock()
+	gaugeList, interval, addr, t := riverGauges, riverInterval, riverAddress, timeout
+	configMu.RUnlock()
+	gauges, err := ParseRiverGauges(gaugeList)
+	if err != nil {
+		return err
+	}
+	var failed CollectError
+	for _, gauge := range gauges {
+		if !c.Due(gauge, interval) {
+			continue
+		}
+		response, err := RetrieveRiverGauge(ctx, gauge, addr, t)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("retrieving river gauge %s: %w", gauge, err))
+			continue
+		}
+		updateRiverMetrics(gauge, response)
+		c.Done(gauge)
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+var riverGaugeRE = regexp.MustCompile(`^[A-Z]{4}[0-9A-Z]$`)
+
+// ParseRiverGauges parses a comma separated list of the five character
+// location ids of river gauges, such as "PHBP1,TRTN4".
+func ParseRiverGauges(gauges string) ([]string, error) {
+	var ids []string
+	for _, id := range strings.Split(gauges, ",") {
+		id = strings.ToUpper(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		if !riverGaugeRE.MatchString(id) {
+			return nil, fmt.Errorf("invalid river gauge id %q", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// floodThreshold is the stage and flow at which a flood category begins.
+type floodThreshold struct {
+	Stage float64 `json:"stage"`
+	Flow  float64 `json:"flow"`
+}
+
+// RiverGaugeResponse is the json structure returned by the national water
+// prediction service for a river gauge. Values the gauge does not have are
+// given as large negative numbers.
+type RiverGaugeResponse struct {
+	Flood struct {
+		Categories map[string]floodThreshold `json:"categories"`
+		StageUnits string                    `json:"stageUnits"`
+		FlowUnits  string                    `json:"flowUnits"`
+	} `json:"flood"`
+	Status struct {
+		Observed struct {
+			Primary       float64 `json:"primary"`
+			PrimaryUnit   string  `json:"primaryUnit"`
+			Secondary     float64 `json:"secondary"`
+			SecondaryUnit string  `json:"secondaryUnit"`
+		} `json:"observed"`
+	} `json:"status"`
+}
+
+// RetrieveRiverGauge retrieves a river gauge from the national water
+// prediction service at address.
+func RetrieveRiverGauge(ctx context.Context, gauge string, address string, timeout int) (RiverGaugeResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   fmt.Sprintf("/nwps/v1/gauges/%s", gauge),
+	}
+
+	response := RiverGaugeResponse{}
+	_, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &response)
+	return response, err
+}
+
+// riverValue converts a value of a river gauge to the canonical unit of q,
+// reporting false when the gauge does not have it or its unit is not one of
+// q.
+func riverValue(v float64, unitCode string, q Quantity) (float64, bool) {
+	if v <= -999 || unitCode == "" {
+		return 0, false
+	}
+	m := Measurement{Value: &v, UnitCode: unitCode}
+	if err := Normalize(&m, q); err != nil {
+		return 0, false
+	}
+	return *m.Value, true
+}
+
+// updateRiverMetrics replaces the gauge's series with its latest observation
+// and flood categories. The observation holds the stage and the flow in either
+// order, told apart by their units.
+func updateRiverMetrics(gauge string, response RiverGaugeResponse) {
+	labels := prometheus.Labels{"gauge": gauge}
+	for _, vec := range []*prometheus.GaugeVec{riverStage, riverFlow, riverFloodStage, riverFloodFlow} {
+		vec.DeletePartialMatch(labels)
+	}
+
+	observed := response.Status.Observed
+	for _, value := range []struct {
+		v    float64
+		unit string
+	}{{observed.Primary, observed.PrimaryUnit}, {observed.Secondary, observed.SecondaryUnit}} {
+		if stage, ok := riverValue(value.v, value.unit, Distance); ok {
+			riverStage.WithLabelValues(gauge).Set(stage)
+		} else if flow, ok := riverValue(value.v, value.unit, Flow); ok {
+			riverFlow.WithLabelValues(gauge).Set(flow)
+		}
+	}
+
+	flood := response.Flood
+	for _, category := range floodCategories {
+		threshold, ok := flood.Categories[category]
+		if !ok {
+			continue
+		}
+		if stage, ok := riverValue(threshold.Stage, flood.StageUnits, Distance); ok {
+			riverFloodStage.WithLabelValues(gauge, category).Set(stage)
+		}
+		if flow, ok := riverValue(threshold.Flow, flood.FlowUnits, Flow); ok {
+			riverFloodFlow.WithLabelValues(gauge, category).Set(flow)
+		}
+	}
+}
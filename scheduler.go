@@ -0,0 +1,37 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// Schedule spreads the scrapes of many stations across their interval. Every
+// station gets a fixed offset within the interval derived from its id, so
+// stations sharing an interval fire at different points of it rather than all
+// at once, and each scrape is further delayed by a random jitter which does not
+// accumulate from one scrape to the next.
+type Schedule struct {
+	Interval time.Duration
+	Offset   time.Duration
+	// Jitter is the largest random delay added to a scrape, as a fraction of
+	// the interval.
+	Jitter float64
+}
+
+// NewSchedule returns the schedule for the station with the given interval.
+func NewSchedule(station string, interval time.Duration, jitter float64) Schedule {
+	h := fnv.New64a()
+	h.Write([]byte(station))
+	offset := time.Duration(float64(h.Sum64()) / (1 << 64) * float64(interval))
+	return Schedule{Interval: interval, Offset: offset, Jitter: jitter}
+}
+
+// Next returns the time of the first scrape slot after now.
+func (s Schedule) Next(now time.Time) time.Time {
+	next := now.Add(-s.Offset).Truncate(s.Interval).Add(s.Offset + s.Interval)
+	if s.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Float64() * s.Jitter * float64(s.Interval)))
+	}
+	return next
+}
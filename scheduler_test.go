@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		schedule Schedule
+		now      time.Time
+		want     time.Time
+	}{
+		{Schedule{Interval: time.Minute}, base, base.Add(time.Minute)},
+		{Schedule{Interval: time.Minute}, base.Add(59 * time.Second), base.Add(time.Minute)},
+		{Schedule{Interval: time.Minute, Offset: 10 * time.Second}, base, base.Add(10 * time.Second)},
+		{Schedule{Interval: time.Minute, Offset: 10 * time.Second}, base.Add(10 * time.Second), base.Add(70 * time.Second)},
+		{Schedule{Interval: time.Minute, Offset: 10 * time.Second}, base.Add(-time.Second), base.Add(10 * time.Second)},
+	}
+
+	for _, test := range tests {
+		if got := test.schedule.Next(test.now); !got.Equal(test.want) {
+			t.Errorf("%+v.Next(%v) = %v, want %v", test.schedule, test.now, got, test.want)
+		}
+	}
+}
+
+func TestScheduleNextJitter(t *testing.T) {
+	base := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	s := Schedule{Interval: time.Minute, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		got := s.Next(base)
+		if got.Before(base.Add(time.Minute)) || got.After(base.Add(90*time.Second)) {
+			t.Fatalf("Next with jitter = %v, want within [%v, %v]", got, base.Add(time.Minute), base.Add(90*time.Second))
+		}
+	}
+}
+
+func TestNewSchedule(t *testing.T) {
+	a := NewSchedule("KPHL", time.Minute, 0)
+	if a != NewSchedule("KPHL", time.Minute, 0) {
+		t.Errorf("NewSchedule is not stable for a station")
+	}
+	if a.Offset < 0 || a.Offset >= time.Minute {
+		t.Errorf("NewSchedule offset %v is outside the interval", a.Offset)
+	}
+	if a.Offset == NewSchedule("KBOS", time.Minute, 0).Offset {
+		t.Errorf("NewSchedule gave KPHL and KBOS the same offset")
+	}
+}
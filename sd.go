@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+)
+
+// targetGroup is a single entry of the prometheus http service discovery
+// format.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// SDHandler serves the stations scraped by the exporter in the prometheus
+// http service discovery format. Each station is a target group pointing back
+// at this exporter, labelled with __meta_nws_station and friends so that
+// stations can be selected and relabelled in the scrape config.
+type SDHandler struct {
+	Manager *StationManager
+}
+
+func (h SDHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	groups := []targetGroup{}
+	for _, config := range h.Manager.Stations() {
+		labels := map[string]string{
+			"__meta_nws_station": config.ID,
+		}
+		if config.Name != "" {
+			labels["__meta_nws_station_name"] = config.Name
+		}
+		labels["__meta_nws_station_interval"] = config.interval().String()
+		if config.Type != "" {
+			labels["__meta_nws_station_type"] = config.Type
+		}
+		groups = append(groups, targetGroup{Targets: []string{r.Host}, Labels: labels})
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	kitlog "github.com/go-kit/log"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// listenAndServe serves server at its address, or on the sockets passed by
+// systemd with -web.systemd-socket. Every listener of the exporter is served
+// alike: over HTTPS with -tls.cert-file and -tls.key-file, or through the
+// exporter toolkit otherwise, with the TLS and basic auth of
+// -web.config.file. name picks the listener's systemd sockets, see
+// systemdListeners.
+func listenAndServe(server *http.Server, name string) error {
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		return server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	}
+	// without -web.config.file the toolkit serves plain HTTP
+	noSystemdSocket := false
+	webFlags := &web.FlagConfig{
+		WebListenAddresses: &[]string{server.Addr},
+		WebSystemdSocket:   &noSystemdSocket,
+		WebConfigFile:      &webConfigFile,
+	}
+	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stderr))
+	if !systemdSocket {
+		return web.ListenAndServe(server, webFlags, logger)
+	}
+	listeners, err := systemdListeners(name)
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 && name != "" {
+		// a listener without a socket of its own listens at its address
+		return web.ListenAndServe(server, webFlags, logger)
+	}
+	return web.ServeMultiple(listeners, server, webFlags, logger)
+}
+
+// activatedListeners are the sockets passed by systemd, by the
+// FileDescriptorName of their socket unit. systemd only passes them once, so
+// they are looked up the first time a listener needs them.
+var activatedListeners struct {
+	once      sync.Once
+	listeners map[string][]net.Listener
+	err       error
+}
+
+// systemdListeners returns the sockets passed by systemd named name, the
+// admin listener serving those named admin and the debug listener those named
+// debug. The metrics listener, with an empty name, serves the others.
+func systemdListeners(name string) ([]net.Listener, error) {
+	activatedListeners.once.Do(func() {
+		activatedListeners.listeners, activatedListeners.err = activation.ListenersWithNames()
+	})
+	if activatedListeners.err != nil {
+		return nil, activatedListeners.err
+	}
+	if name != "" {
+		return activatedListeners.listeners[name], nil
+	}
+	var listeners []net.Listener
+	for socketName, named := range activatedListeners.listeners {
+		if socketName != "admin" && socketName != "debug" {
+			listeners = append(listeners, named...)
+		}
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no sockets passed by systemd other than those named admin or debug")
+	}
+	return listeners, nil
+}
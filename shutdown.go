@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// upstreamCtx is cancelled on shutdown, aborting every request upstream in
+// flight whatever context it was made with.
+var upstreamCtx, cancelUpstream = context.WithCancel(context.Background())
+
+// withUpstream returns a context derived from ctx that is also cancelled once
+// upstreamCtx is, for requests made on behalf of a station or another caller
+// that may be cancelled on its own.
+func withUpstream(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-upstreamCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// shutdownOnSignal shuts the exporter down gracefully when the process
+// receives SIGTERM or SIGINT, closing done once it has. Readiness is dropped
+// and requests upstream, including those waiting for their turn, are aborted
+// straight away, while the responses being served by every listener and the
+// stations being stopped are given up to -web.shutdown-timeout together. A
+// second signal exits immediately.
+func shutdownOnSignal(servers []*http.Server, manager *StationManager, done chan<- struct{}) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Printf("Received %s, shutting down within %v", sig, shutdownTimeout)
+	go func() {
+		sig := <-signals
+		log.Fatalf("error: received %s while shutting down", sig)
+	}()
+
+	atomic.StoreInt32(&started, 0)
+	daemon.SdNotify(false, daemon.SdNotifyStopping)
+	cancelUpstream()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Problem draining responses on %s: %s", server.Addr, err)
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		manager.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Printf("Problem stopping the stations: %s", ctx.Err())
+	}
+	close(done)
+}
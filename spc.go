@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	spcCategory = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spc_outlook_category",
+			Help: "categorical risk of the storm prediction center convective outlook at the station for each day, 0 none, 1 TSTM, 2 MRGL, 3 SLGT, 4 ENH, 5 MDT and 6 HIGH",
+		},
+		[]string{"station", "day"},
+	)
+	spcProbability = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spc_outlook_probability_ratio",
+			Help: "probability of severe weather within 25 miles of the station of the storm prediction center convective outlook for each day by hazard, from 0 to 1",
+		},
+		[]string{"station", "day", "hazard"},
+	)
+)
+
+// spcCategories are the values of the labels of the categorical outlook.
+var spcCategories = map[string]float64{
+	"TSTM": 1,
+	"MRGL": 2,
+	"SLGT": 3,
+	"ENH":  4,
+	"MDT":  5,
+	"HIGH": 6,
+}
+
+// spcOutlooks are the outlooks exported, the hazard of the categorical
+// outlooks is empty. Day 3 only has a probabilistic outlook of any severe
+// weather.
+var spcOutlooks = []struct {
+	name   string
+	day    string
+	hazard string
+}{
+	{"day1otlk_cat", "1", ""},
+	{"day1otlk_torn", "1", "tornado"},
+	{"day1otlk_wind", "1", "wind"},
+	{"day1otlk_hail", "1", "hail"},
+	{"day2otlk_cat", "2", ""},
+	{"day2otlk_torn", "2", "tornado"},
+	{"day2otlk_wind", "2", "wind"},
+	{"day2otlk_hail", "2", "hail"},
+	{"day3otlk_cat", "3", ""},
+	{"day3otlk_prob", "3", "any"},
+}
+
+func init() {
+	registerCollector("spc", false, &spcCollector{outlooks: map[string]OutlookResponse{}}, spcCategory, spcProbability)
+}
+
+// spcCollector exports the storm prediction center convective outlooks of the
+// next three days at each station, retrieved from -spc.address every
+// -spc.interval. The outlooks cover the whole country, so they are retrieved
+// once however many stations are scraped.
+type spcCollector struct {
+	refreshTracker
+
+	mu       sync.Mutex
+	outlooks map[string]OutlookResponse
+	fetched  refreshTracker
+}
+
+func (c *spcCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, spcAddr, addr, t := spcInterval, spcAddress, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	point, err := StationPoint(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	if len(point.Geometry.Coordinates) < 2 {
+		return fmt.Errorf("point of station %s has no location", config.ID)
+	}
+	lon, lat := point.Geometry.Coordinates[0], point.Geometry.Coordinates[1]
+
+	for _, o := range spcOutlooks {
+		outlook, ok, err := c.outlook(ctx, o.name, interval, spcAddr, t)
+		if err != nil {
+			return fmt.Errorf("retrieving outlook %s: %w", o.name, err)
+		}
+		if !ok {
+			// the outlook is being retrieved for another station, and the
+			// station is updated on its next scrape
+			return nil
+		}
+		if o.hazard == "" {
+			spcCategory.WithLabelValues(config.ID, o.day).Set(outlook.Highest(lat, lon, spcCategories))
+		} else {
+			spcProbability.WithLabelValues(config.ID, o.day, o.hazard).Set(outlook.Highest(lat, lon, nil) / 100)
+		}
+	}
+	c.Done(config.ID)
+	return nil
+}
+
+// outlook returns the named outlook, retrieving it again when it was retrieved
+// at least -spc.interval ago. Stations share the outlooks, which are claimed
+// by the first of them to find them due, and it reports false when the outlook
+// was claimed by another station that has yet to retrieve it.
+func (c *spcCollector) outlook(ctx context.Context, name string, interval time.Duration, address string, timeout int) (OutlookResponse, bool, error) {
+	if !c.fetched.Claim(name, interval) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		outlook, ok := c.outlooks[name]
+		return outlook, ok, nil
+	}
+	outlook, err := RetrieveOutlook(ctx, name, address, timeout)
+	if err != nil {
+		c.fetched.Forget(name)
+		return OutlookResponse{}, false, err
+	}
+	c.mu.Lock()
+	c.outlooks[name] = outlook
+	c.mu.Unlock()
+	return outlook, true, nil
+}
+
+// OutlookResponse is the geojson layer of a convective outlook published by
+// the storm prediction center. Each feature is an area labelled with its risk,
+// a category such as SLGT or a probability in percent such as 0.15.
+type OutlookResponse struct {
+	Features []struct {
+		Properties struct {
+			Label string `json:"LABEL"`
+		} `json:"properties"`
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+// RetrieveOutlook retrieves the named convective outlook, such as
+// day1otlk_cat.
+func RetrieveOutlook(ctx context.Context, name string, address string, timeout int) (OutlookResponse, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   fmt.Sprintf("/products/outlook/%s.lyr.geojson", name),
+	}
+
+	response := OutlookResponse{}
+	_, err := retrieveJSON(ctx, requestURL, timeout, "application/geo+json", &response)
+	return response, err
+}
+
+// Highest returns the highest risk of the areas containing the location, or 0
+// when none do. Labels are looked up in categories, or parsed as
+// probabilities in percent when categories is nil. Areas with other labels,
+// such as those of significant severe weather, are ignored.
+func (o OutlookResponse) Highest(lat, lon float64, categories map[string]float64) float64 {
+	highest := 0.0
+	for _, feature := range o.Features {
+		label := strings.TrimSpace(feature.Properties.Label)
+		var risk float64
+		if categories != nil {
+			var ok bool
+			if risk, ok = categories[label]; !ok {
+				continue
+			}
+		} else {
+			p, err := strconv.ParseFloat(label, 64)
+			if err != nil {
+				continue
+			}
+			// probabilities are labelled both as 0.15 and 15
+			if p < 1 {
+				p *= 100
+			}
+			risk = p
+		}
+		if risk <= highest {
+			continue
+		}
+
+		var polygons [][][][2]float64
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var polygon [][][2]float64
+			if json.Unmarshal(feature.Geometry.Coordinates, &polygon) == nil {
+				polygons = append(polygons, polygon)
+			}
+		case "MultiPolygon":
+			json.Unmarshal(feature.Geometry.Coordinates, &polygons)
+		}
+		for _, polygon := range polygons {
+			if polygonContains(polygon, lat, lon) {
+				highest = risk
+				break
+			}
+		}
+	}
+	return highest
+}
+
+// polygonContains reports whether the geojson polygon, an outer ring followed
+// by the rings of its holes, contains the location.
+func polygonContains(polygon [][][2]float64, lat, lon float64) bool {
+	if len(polygon) == 0 || !ringContains(polygon[0], lat, lon) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if ringContains(hole, lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains reports whether the ring of longitude, latitude positions
+// contains the location, by counting the edges a ray from it crosses.
+func ringContains(ring [][2]float64, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > lat) != (b[1] > lat) && lon < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
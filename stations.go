@@ -0,0 +1,682 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StationConfig describes a single station to scrape and how often to scrape
+// it.
+type StationConfig struct {
+	ID string
+	// Name is an optional human readable name exported by nws_station_info.
+	Name string
+	// Interval is the time between successful scrapes, when zero
+	// -scrape-interval is used.
+	Interval time.Duration
+	// Type is the kind of station, empty for a national weather service
+	// station or buoy for a national data buoy center buoy.
+	Type string
+	// TideStation is the id of the tide station whose tides are exported for
+	// the station, such as 8545240, or empty for none.
+	TideStation string
+	// NormalsStation is the id of the climate station whose normals are
+	// exported for the station, such as USW00013739, or empty for none.
+	NormalsStation string
+}
+
+// stationTypeBuoy is the Type of national data buoy center buoys.
+const stationTypeBuoy = "buoy"
+
+// ParseStationType parses the type of a station, station or an empty string
+// for a national weather service station.
+func ParseStationType(t string) (string, error) {
+	switch t = strings.ToLower(strings.TrimSpace(t)); t {
+	case "", "station":
+		return "", nil
+	case stationTypeBuoy:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid station type %q, expected station or buoy", t)
+}
+
+// ParseStationConfig parses a station given as ID[:interval][=name], for
+// example "KPHL", "KPHL:5m" or "KPHL:5m=Philadelphia Intl".
+func ParseStationConfig(spec string) (StationConfig, error) {
+	spec = strings.TrimSpace(spec)
+	spec, name, _ := strings.Cut(spec, "=")
+	id, interval, hasInterval := strings.Cut(spec, ":")
+	config := StationConfig{ID: strings.TrimSpace(id), Name: strings.TrimSpace(name)}
+	if config.ID == "" {
+		return config, fmt.Errorf("missing station id in %q", spec)
+	}
+
+	if hasInterval {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return config, fmt.Errorf("invalid interval for station %s: %w", config.ID, err)
+		}
+		if d <= 0 {
+			return config, fmt.Errorf("interval for station %s must be positive", config.ID)
+		}
+		config.Interval = d
+	}
+
+	return config, nil
+}
+
+// interval returns the time to wait between successful scrapes of the station.
+func (c StationConfig) interval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return defaultScrapeInterval()
+}
+
+// stationList returns the stations given by -stations, falling back to the
+// stations of the -config file and then the single -station flag when no list
+// was given.
+func stationList() ([]StationConfig, error) {
+	if stations == "" && len(configStations) != 0 {
+		return configStations, nil
+	}
+	if stations == "" {
+		return []StationConfig{{ID: station}}, nil
+	}
+
+	var configs []StationConfig
+	for _, spec := range strings.Split(stations, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		config, err := ParseStationConfig(spec)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// ValidateStation checks that the station exists and has reported an
+// observation within maxAge.
+func ValidateStation(ctx context.Context, station string, maxAge time.Duration) error {
+	if _, err := RetrieveStation(ctx, station, address, timeout); err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("station %s does not exist", station)
+		}
+		return fmt.Errorf("looking up station %s: %w", station, err)
+	}
+
+	response, _, err := RetrieveCurrentObservation(ctx, station, address, timeout)
+	if err != nil {
+		return fmt.Errorf("retrieving latest observation of station %s: %w", station, err)
+	}
+	if age := time.Since(response.Properties.Timestamp); age > maxAge {
+		return fmt.Errorf("station %s has not reported an observation in %v", station, age.Round(time.Minute))
+	}
+	return nil
+}
+
+// validateStations validates every station, exiting on the first invalid
+// station with -failfast and logging a warning for each otherwise.
+func validateStations(ctx context.Context, configs []StationConfig) {
+	for _, config := range configs {
+		var err error
+		if config.Type == stationTypeBuoy {
+			err = ValidateBuoy(ctx, config.ID, validateMaxAge)
+		} else {
+			err = ValidateStation(ctx, config.ID, validateMaxAge)
+		}
+		if err == nil {
+			continue
+		}
+		if failfast {
+			log.Fatalf("error: %v", err)
+		}
+		log.Printf("Warning: %v, its series may be missing or stale", err)
+	}
+}
+
+// ReadStationsFile reads station configurations from path, one
+// ID[:interval][=name] per line. Blank lines and lines starting with # are ignored.
+func ReadStationsFile(path string) ([]StationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseStationsFile(path, data)
+}
+
+func parseStationsFile(path string, data []byte) ([]StationConfig, error) {
+	var configs []StationConfig
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		spec := strings.TrimSpace(scanner.Text())
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		config, err := ParseStationConfig(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if seen[config.ID] {
+			return nil, fmt.Errorf("%s:%d: duplicate station %s", path, line, config.ID)
+		}
+		seen[config.ID] = true
+		configs = append(configs, config)
+	}
+	return configs, scanner.Err()
+}
+
+// watchStationsFile polls path every interval and applies the stations it
+// lists to manager whenever its contents change. Errors reading or parsing the
+// file are logged and leave the running stations untouched.
+func watchStationsFile(path string, interval time.Duration, manager *StationManager) {
+	var last []byte
+	for {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Problem reading stations file %s: %s", path, err)
+		} else if !bytes.Equal(data, last) {
+			configs, err := parseStationsFile(path, data)
+			if err != nil {
+				log.Printf("Problem parsing stations file %s: %s", path, err)
+			} else {
+				if last != nil {
+					log.Printf("Stations file %s changed, reloading", path)
+				}
+				manager.Apply(configs)
+			}
+			last = data
+		}
+		time.Sleep(interval)
+	}
+}
+
+// StationManager runs a scrape loop per station and starts or stops loops as
+// the set of configured stations changes.
+type StationManager struct {
+	mu      sync.Mutex
+	running map[string]*runningStation
+	// stopping are the stopped loops that may not have exited yet, which a
+	// loop started again for the same station waits for
+	stopping map[string]*runningStation
+	// added are the stations added through Add, which Apply keeps running
+	// unless the configurations it is given list them
+	added map[string]StationConfig
+}
+
+type runningStation struct {
+	config  StationConfig
+	cancel  context.CancelFunc
+	done    chan struct{}
+	refresh chan struct{}
+}
+
+// NewStationManager returns a StationManager with no running stations.
+func NewStationManager() *StationManager {
+	return &StationManager{
+		running:  map[string]*runningStation{},
+		stopping: map[string]*runningStation{},
+		added:    map[string]StationConfig{},
+	}
+}
+
+// Apply makes configs, along with the stations added through Add, the set of
+// scraped stations. Stations no longer present are stopped and their series
+// deleted, new stations are started, and stations whose configuration changed
+// are restarted. A station both added through Add and listed in configs is
+// configured as listed, and is no longer kept running by Add once configs stop
+// listing it.
+func (m *StationManager) Apply(configs []StationConfig) {
+	var stopped []*runningStation
+	defer func() { waitStopped(stopped) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[string]StationConfig{}
+	for _, config := range configs {
+		wanted[config.ID] = config
+	}
+	for id, config := range m.added {
+		if _, ok := wanted[id]; ok {
+			delete(m.added, id)
+			continue
+		}
+		wanted[id] = config
+		// the caller's slice is left untouched
+		configs = append(configs[:len(configs):len(configs)], config)
+	}
+
+	for id, running := range m.running {
+		if config, ok := wanted[id]; ok && config == running.config {
+			continue
+		}
+		stopped = append(stopped, m.stop(id))
+	}
+	for _, config := range configs {
+		if _, ok := m.running[config.ID]; !ok {
+			m.start(config)
+		}
+	}
+}
+
+// Add starts scraping the station, restarting it if it is already running
+// with a different configuration. The station keeps being scraped when Apply
+// changes the set of stations.
+func (m *StationManager) Add(config StationConfig) {
+	var stopped []*runningStation
+	defer func() { waitStopped(stopped) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.added[config.ID] = config
+
+	if running, ok := m.running[config.ID]; ok {
+		if running.config == config {
+			return
+		}
+		stopped = append(stopped, m.stop(config.ID))
+	}
+	m.start(config)
+}
+
+// Remove stops scraping the station and deletes its series, reporting whether
+// the station was running. A station listed in the configurations given to
+// Apply is started again by the next Apply.
+func (m *StationManager) Remove(id string) bool {
+	var stopped []*runningStation
+	defer func() { waitStopped(stopped) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.added, id)
+
+	if _, ok := m.running[id]; !ok {
+		return false
+	}
+	stopped = append(stopped, m.stop(id))
+	return true
+}
+
+// Stop stops scraping every station, including those added through Add.
+func (m *StationManager) Stop() {
+	var stopped []*runningStation
+	defer func() { waitStopped(stopped) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.added = map[string]StationConfig{}
+	for id := range m.running {
+		stopped = append(stopped, m.stop(id))
+	}
+}
+
+// Running reports whether the station is being scraped.
+func (m *StationManager) Running(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.running[id]
+	return ok
+}
+
+// Refresh makes the stations scrape straight away rather than waiting for
+// their next scheduled scrape, or for a failed scrape to back off. Every
+// running station is refreshed when no ids are given. It returns the ids of
+// the stations refreshed, leaving out those not running.
+func (m *StationManager) Refresh(ids ...string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(ids) == 0 {
+		for id := range m.running {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+	var refreshed []string
+	for _, id := range ids {
+		running, ok := m.running[id]
+		if !ok {
+			continue
+		}
+		// a refresh already pending covers this one
+		select {
+		case running.refresh <- struct{}{}:
+		default:
+		}
+		refreshed = append(refreshed, id)
+	}
+	return refreshed
+}
+
+// Stations returns the configurations of the running stations.
+func (m *StationManager) Stations() []StationConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	configs := make([]StationConfig, 0, len(m.running))
+	for _, running := range m.running {
+		configs = append(configs, running.config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ID < configs[j].ID })
+	return configs
+}
+
+func (m *StationManager) start(config StationConfig) {
+	log.Printf("Starting scrape loop for station %s", config.ID)
+	ctx, cancel := context.WithCancel(context.Background())
+	running := &runningStation{
+		config:  config,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		refresh: make(chan struct{}, 1),
+	}
+	m.running[config.ID] = running
+	previous := m.stopping[config.ID]
+	go func() {
+		defer close(running.done)
+		// the series of a stopped loop of the station are deleted once it
+		// exits, before this loop exports any
+		if previous != nil {
+			<-previous.done
+		}
+		scrapeStation(ctx, config, running.refresh)
+
+		// the loop only exits once stopped. A station with a loop started
+		// again was restarted rather than removed, so only its series are
+		// deleted
+		m.mu.Lock()
+		if m.stopping[config.ID] == running {
+			delete(m.stopping, config.ID)
+		}
+		_, restarted := m.running[config.ID]
+		m.mu.Unlock()
+		if restarted {
+			deleteMetrics(config.ID)
+		} else {
+			removeStation(config.ID)
+		}
+	}()
+}
+
+// stop cancels the scrape loop of the station and returns it. The loop deletes
+// the station's series once it exits, which the caller waits for with
+// waitStopped after releasing m.mu, as the loop may be in the middle of a
+// scrape.
+func (m *StationManager) stop(id string) *runningStation {
+	log.Printf("Stopping scrape loop for station %s", id)
+	running := m.running[id]
+	running.cancel()
+	delete(m.running, id)
+	m.stopping[id] = running
+	return running
+}
+
+// waitStopped waits for the stopped loops to exit.
+func waitStopped(stopped []*runningStation) {
+	for _, running := range stopped {
+		<-running.done
+	}
+}
+
+// stationState tracks the failures of a single station. It belongs to the
+// station's own scrape loop, so a failing station backs off on its own without
+// delaying the scrapes of any other station.
+type stationState struct {
+	station  string
+	failures int
+}
+
+// failed records a scrape that failed with err and returns how long to wait
+// before the next attempt, at least as long as the hosts that failed the
+// scrape asked not to be retried for.
+func (s *stationState) failed(err error) time.Duration {
+	s.failures++
+	backoff := backoffDuration(s.failures)
+	if delay := requestedDelay(err); delay > backoff {
+		backoff = delay
+	}
+	stationBackingOff.WithLabelValues(s.station).Set(1)
+	stationBackoff.WithLabelValues(s.station).Set(backoff.Seconds())
+	stationUp.WithLabelValues(s.station).Set(0)
+	consecutiveFailures.WithLabelValues(s.station).Set(float64(s.failures))
+	degraded := 0.0
+	if s.failures >= degradedAfter {
+		degraded = 1
+	}
+	stationDegraded.WithLabelValues(s.station).Set(degraded)
+	return backoff
+}
+
+// backoffDuration returns how long to wait after the given number of failed
+// scrapes in a row. The wait starts at -error-backoff and grows by
+// -error-backoff.multiplier with every failure up to -error-backoff.max, and
+// is then varied at random by up to -error-backoff.jitter so that stations
+// failing together do not retry together.
+func backoffDuration(failures int) time.Duration {
+	backoff := float64(errorBackoffDuration()) * math.Pow(errorBackoffMultiplier, float64(failures-1))
+	if backoff > float64(errorBackoffMax) {
+		backoff = float64(errorBackoffMax)
+	}
+	backoff *= 1 + errorBackoffJitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+// retrying reports whether the next scrape retries a failed one, counting it
+// as a retry when it does.
+func (s *stationState) retrying() bool {
+	if s.failures == 0 {
+		return false
+	}
+	scrapeRetries.WithLabelValues(s.station).Inc()
+	return true
+}
+
+// succeeded records a successful scrape, clearing any failures.
+func (s *stationState) succeeded() {
+	s.failures = 0
+	stationBackingOff.WithLabelValues(s.station).Set(0)
+	stationBackoff.WithLabelValues(s.station).Set(0)
+	consecutiveFailures.WithLabelValues(s.station).Set(0)
+	stationDegraded.WithLabelValues(s.station).Set(0)
+	stationUp.WithLabelValues(s.station).Set(1)
+	lastSuccessfulScrape.WithLabelValues(s.station).SetToCurrentTime()
+}
+
+// scrapeStation polls the latest observation for a single station until ctx
+// is cancelled, updating the station's series on every successful retrieval.
+// A value received from refresh cuts short the wait for the next scrape.
+func scrapeStation(ctx context.Context, config StationConfig, refresh <-chan struct{}) {
+	station := config.ID
+	if config.Name != "" {
+		stationInfo.WithLabelValues(station, config.Name).Set(1)
+	}
+
+	state := &stationState{station: station}
+	configMu.RLock()
+	schedule := NewSchedule(station, config.interval(), jitter)
+	staggered := stagger
+	var first time.Time
+	if staggered {
+		first = schedule.Next(time.Now())
+		if verbose {
+			log.Printf("Staggering first scrape of %s to %s", station, first)
+		}
+	}
+	configMu.RUnlock()
+	if staggered && !sleep(ctx, time.Until(first), refresh) {
+		return
+	}
+
+	for {
+		wait, ok := scrapeOnce(ctx, config, state, schedule)
+		if !ok || !sleep(ctx, wait, refresh) {
+			return
+		}
+	}
+}
+
+// scrapeOnce scrapes the station once for scrapeStation, returning how long
+// to wait before the next scrape, or false once ctx is cancelled. It reads the
+// flags holding configMu, which it releases while the collectors retrieve the
+// station, so a config reload does not wait for a slow scrape.
+func scrapeOnce(ctx context.Context, config StationConfig, state *stationState, schedule Schedule) (time.Duration, bool) {
+	station := config.ID
+	configMu.RLock()
+	err := allowScrape(station)
+	logVerbose := verbose
+	configMu.RUnlock()
+
+	// a short-circuited scrape is skipped rather than failed, leaving the
+	// failures and backoff of the station as they were
+	if err != nil {
+		wait := time.Until(schedule.Next(time.Now()))
+		var circuitErr *CircuitOpenError
+		if errors.As(err, &circuitErr) && !circuitErr.Until.IsZero() {
+			wait = time.Until(circuitErr.Until)
+		}
+		if logVerbose {
+			log.Printf("Skipping scrape of %s: %s", station, err)
+		}
+		return wait, true
+	}
+
+	if state.retrying() && logVerbose {
+		log.Printf("Retrying station %s after %d consecutive failures", station, state.failures)
+	}
+	start := time.Now()
+	err = collect(ctx, config)
+	if ctx.Err() != nil {
+		return 0, false
+	}
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+	recordScrape(station, err)
+	scrapeDuration.WithLabelValues(station).Observe(time.Since(start).Seconds())
+	if err != nil {
+		if failfast {
+			log.Fatalf("error: %v", err)
+		}
+
+		backoff := state.failed(err)
+		log.Printf("Problem retrieving from: %s at station %s (%d consecutive failures): %s", address, station, state.failures, err)
+		log.Printf("Waiting %v, next scrape of %s at %s", backoff.Round(time.Second), station, time.Now().Add(backoff))
+		return backoff, true
+	}
+	state.succeeded()
+
+	next := schedule.Next(time.Now())
+	if verbose {
+		log.Printf("Waiting %v, next scrape of %s at %s", time.Until(next).Round(time.Second), station, next.String())
+	}
+	return time.Until(next), true
+}
+
+// sleep waits for d to pass or for a value from wake, returning false early
+// if ctx is cancelled first.
+func sleep(ctx context.Context, d time.Duration, wake <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	case <-wake:
+		return true
+	}
+}
+
+// followNearest scrapes the nearest of the given stations, ordered from
+// nearest to farthest, that is still reporting, running it through the
+// manager like any other station. The manager is expected to be scraping the
+// nearest station already. Every interval it checks whether a nearer
+// station has started reporting again, or the scraped station has stopped,
+// and switches to the nearest station reporting, so that only a single
+// station's data is exported at a time. It returns once ctx is cancelled.
+func followNearest(ctx context.Context, ids []string, manager *StationManager) {
+	supplier := ids[0]
+	for {
+		configMu.RLock()
+		maxAge, addr, t := nearestMaxAge, address, timeout
+		configMu.RUnlock()
+		next, rank, ok := nearestReporting(ctx, ids, supplier, maxAge, addr, t)
+		if ctx.Err() != nil {
+			return
+		}
+
+		configMu.RLock()
+		interval, exit, logVerbose := defaultScrapeInterval(), failfast, verbose
+		configMu.RUnlock()
+		switch {
+		case !ok && exit:
+			log.Fatalf("error: none of the stations %v are reporting", ids)
+		case !ok:
+			log.Printf("None of the stations %v are reporting", ids)
+		}
+		if next != supplier {
+			log.Printf("Switching from station %s to %s", supplier, next)
+			manager.Apply([]StationConfig{{ID: next}})
+			supplier = next
+		}
+		nearestRank.WithLabelValues(supplier).Set(float64(rank + 1))
+
+		if logVerbose {
+			log.Printf("Waiting %v, next check of %v at %s", interval, ids, time.Now().Add(interval).String())
+		}
+		if !sleep(ctx, interval, nil) {
+			return
+		}
+	}
+}
+
+// nearestReporting returns the nearest of the stations that has reported
+// within maxAge, along with its rank, checking the latest
+// observation of the stations nearer than the supplier currently scraped,
+// and of the supplier itself when its own scrapes have not stored a recent
+// one. When none are reporting it returns the supplier and false.
+func nearestReporting(ctx context.Context, ids []string, supplier string, maxAge time.Duration, address string, timeout int) (string, int, bool) {
+	for rank, station := range ids {
+		if station == supplier {
+			latestObservations.Lock()
+			response, stored := latestObservations.responses[station]
+			latestObservations.Unlock()
+			if stored && time.Since(response.Properties.Timestamp) <= maxAge {
+				return station, rank, true
+			}
+		}
+		response, _, err := RetrieveCurrentObservation(ctx, station, address, timeout)
+		if err != nil {
+			log.Printf("Problem retrieving from: %s at station %s: %s", address, station, err)
+			continue
+		}
+		if age := time.Since(response.Properties.Timestamp); age > maxAge {
+			log.Printf("Station %s has not reported in %v, trying the next nearest", station, age.Round(time.Second))
+			continue
+		}
+		return station, rank, true
+	}
+	for rank, station := range ids {
+		if station == supplier {
+			return station, rank, false
+		}
+	}
+	return supplier, 0, false
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runningIDs returns the ids of the stations scraped by m.
+func runningIDs(m *StationManager) []string {
+	var ids []string
+	for _, config := range m.Stations() {
+		ids = append(ids, config.ID)
+	}
+	return ids
+}
+
+// quietManager returns a StationManager whose scrape loops wait for their
+// staggered first scrape, an hour away at most, so a test makes no requests.
+func quietManager(t *testing.T) *StationManager {
+	configMu.Lock()
+	staggered := stagger
+	stagger = true
+	configMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		stagger = staggered
+		configMu.Unlock()
+	})
+
+	m := NewStationManager()
+	t.Cleanup(m.Stop)
+	return m
+}
+
+func TestStationManagerApply(t *testing.T) {
+	m := quietManager(t)
+	kphl := StationConfig{ID: "KPHL", Interval: time.Hour}
+	kbos := StationConfig{ID: "KBOS", Interval: time.Hour}
+
+	m.Apply([]StationConfig{kphl, kbos})
+	if got, want := runningIDs(m), []string{"KBOS", "KPHL"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after the first Apply, running %v, want %v", got, want)
+	}
+
+	// a changed configuration restarts the station with it
+	renamed := kphl
+	renamed.Name = "Philadelphia"
+	m.Apply([]StationConfig{renamed})
+	if got, want := m.Stations(), []StationConfig{renamed}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after the second Apply, running %v, want %v", got, want)
+	}
+	if m.Running("KBOS") {
+		t.Error("KBOS is still running once no longer configured")
+	}
+
+	m.Apply(nil)
+	if got := runningIDs(m); len(got) != 0 {
+		t.Errorf("after applying no stations, running %v", got)
+	}
+}
+
+func TestStationManagerAdded(t *testing.T) {
+	m := quietManager(t)
+	kphl := StationConfig{ID: "KPHL", Interval: time.Hour}
+	kbos := StationConfig{ID: "KBOS", Interval: time.Hour}
+
+	m.Apply([]StationConfig{kphl})
+	m.Add(kbos)
+	m.Apply([]StationConfig{kphl})
+	if !m.Running("KBOS") {
+		t.Fatal("a station added through Add was stopped by Apply")
+	}
+	m.Apply(nil)
+	if got, want := runningIDs(m), []string{"KBOS"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after applying no stations, running %v, want %v", got, want)
+	}
+
+	// once configured, the station is configured as listed and no longer
+	// kept running by Add
+	listed := kbos
+	listed.Name = "Boston"
+	m.Apply([]StationConfig{listed})
+	if got, want := m.Stations(), []StationConfig{listed}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after listing the added station, running %v, want %v", got, want)
+	}
+	m.Apply(nil)
+	if m.Running("KBOS") {
+		t.Fatal("KBOS kept running by Add after being listed by Apply")
+	}
+
+	m.Add(kbos)
+	if !m.Remove("KBOS") {
+		t.Error("Remove of a running station reported it was not running")
+	}
+	if m.Remove("KBOS") {
+		t.Error("Remove of a stopped station reported it was running")
+	}
+	m.Apply([]StationConfig{kphl})
+	if m.Running("KBOS") {
+		t.Error("a removed station was started again by Apply")
+	}
+
+	// a configured station that is removed is started by the next Apply
+	m.Remove("KPHL")
+	m.Apply([]StationConfig{kphl})
+	if !m.Running("KPHL") {
+		t.Error("a configured station removed through Remove was not started again by Apply")
+	}
+}
+
+func TestBackoffDuration(t *testing.T) {
+	defer func(backoff, max time.Duration, multiplier, jitter float64) {
+		errorBackoff, errorBackoffMax, errorBackoffMultiplier, errorBackoffJitter = backoff, max, multiplier, jitter
+	}(errorBackoff, errorBackoffMax, errorBackoffMultiplier, errorBackoffJitter)
+	errorBackoff, errorBackoffMax, errorBackoffMultiplier = 10*time.Second, time.Minute, 2
+
+	// without jitter the backoff doubles after each failure up to the max
+	errorBackoffJitter = 0
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, backoff := range want {
+		if got := backoffDuration(i + 1); got != backoff {
+			t.Errorf("backoffDuration(%d) = %v, want %v", i+1, got, backoff)
+		}
+	}
+
+	errorBackoffJitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := backoffDuration(10); got < 48*time.Second || got > 72*time.Second {
+			t.Fatalf("backoffDuration(10) with jitter = %v, want within 20%% of 1m", got)
+		}
+	}
+}
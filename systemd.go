@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// notifySystemd tells systemd, when running as a Type=notify service, that
+// the exporter is ready, and keeps its watchdog fed while the station manager
+// is responsive. A deadlocked exporter stops feeding the watchdog and is
+// restarted by systemd once WatchdogSec passes. It does nothing outside
+// systemd.
+func notifySystemd(manager *StationManager) {
+	if ok, err := daemon.SdNotify(false, daemon.SdNotifyReady); err != nil {
+		log.Printf("Problem notifying systemd: %s", err)
+	} else if !ok {
+		return
+	}
+
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		log.Printf("Problem reading the systemd watchdog interval: %s", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	// the watchdog is fed twice per interval, as systemd recommends
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		manager.Stations()
+		if _, err := daemon.SdNotify(false, daemon.SdNotifyWatchdog); err != nil {
+			log.Printf("Problem notifying systemd watchdog: %s", err)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tafCeiling = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_ceiling_meters",
+			Help: "forecast ceiling of each group of the terminal aerodrome forecast in meters",
+		},
+		[]string{"station", "change", "valid_from", "valid_to"},
+	)
+	tafVisibility = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_visibility_meters",
+			Help: "forecast visibility of each group of the terminal aerodrome forecast in meters",
+		},
+		[]string{"station", "change", "valid_from", "valid_to"},
+	)
+	tafWindSpeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_wind_speed_kilometers_per_hour",
+			Help: "forecast wind speed of each group of the terminal aerodrome forecast in kilometers per hour",
+		},
+		[]string{"station", "change", "valid_from", "valid_to"},
+	)
+	tafWindGust = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_wind_gust_kilometers_per_hour",
+			Help: "forecast wind gust of each group of the terminal aerodrome forecast in kilometers per hour",
+		},
+		[]string{"station", "change", "valid_from", "valid_to"},
+	)
+	tafWindDirection = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_wind_direction_degrees",
+			Help: "forecast wind direction of each group of the terminal aerodrome forecast in degrees",
+		},
+		[]string{"station", "change", "valid_from", "valid_to"},
+	)
+	tafFlightCategory = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_flight_category_info",
+			Help: "forecast flight category, VFR, MVFR, IFR or LIFR, of each group of the terminal aerodrome forecast, always 1",
+		},
+		[]string{"station", "change", "valid_from", "valid_to", "category"},
+	)
+	tafIssued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "taf_issue_timestamp_seconds",
+			Help: "time the terminal aerodrome forecast was issued as a unix timestamp",
+		},
+		[]string{"station"},
+	)
+)
+
+func init() {
+	registerCollector("taf", false, &tafCollector{},
+		tafCeiling, tafVisibility, tafWindSpeed, tafWindGust, tafWindDirection,
+		tafFlightCategory, tafIssued)
+}
+
+// tafCollector exports the terminal aerodrome forecast of a station, retrieved
+// from -aviation.address every -forecast.interval. Stations without a forecast,
+// which are most stations away from airports, export nothing.
+type tafCollector struct {
+	refreshTracker
+}
+
+func (c *tafCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, addr, t := forecastInterval, aviationAddress, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	raw, err := RetrieveTAF(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+
+	var taf TAF
+	if raw != "" {
+		if taf, err = ParseTAF(raw); err != nil {
+			return err
+		}
+	}
+	updateTAFMetrics(config.ID, taf)
+	c.Done(config.ID)
+	return nil
+}
+
+// RetrieveTAF retrieves the raw text of the latest terminal aerodrome forecast
+// of a station from the aviation weather center data api at address, or an
+// empty string when the station has none.
+func RetrieveTAF(ctx context.Context, station string, address string, timeout int) (string, error) {
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/api/data/taf",
+		RawQuery: url.Values{"ids": {station}, "format": {"json"}}.Encode(),
+	}
+
+	var response []struct {
+		RawTAF string `json:"rawTAF"`
+	}
+	if _, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &response); err != nil {
+		return "", err
+	}
+	if len(response) == 0 {
+		return "", nil
+	}
+	return response[0].RawTAF, nil
+}
+
+// TAF holds the groups decoded from a raw terminal aerodrome forecast.
+type TAF struct {
+	Station string
+	Issued  time.Time
+	Groups  []TAFGroup
+}
+
+// TAFGroup is a single group of a terminal aerodrome forecast, in the units
+// used by the observations api. Values the group does not forecast are nil.
+type TAFGroup struct {
+	// Change is "BASE" for the initial group, and otherwise the change
+	// indicator starting the group, such as "FM", "TEMPO", "BECMG" or
+	// "PROB30 TEMPO".
+	Change   string
+	From, To time.Time
+	// WindDirection is in degrees, and is nil for variable winds.
+	WindDirection *float64
+	// WindSpeed and WindGust are in kilometers per hour.
+	WindSpeed *float64
+	WindGust  *float64
+	// Visibility and Ceiling are in meters.
+	Visibility *float64
+	Ceiling    *float64
+	// Sky is set when the group forecasts the sky condition, so a nil Ceiling
+	// means unlimited rather than unchanged.
+	Sky bool
+}
+
+var (
+	tafIssuedRE = regexp.MustCompile(`^(\d{2})(\d{2})(\d{2})Z$`)
+	tafPeriodRE = regexp.MustCompile(`^(\d{2})(\d{2})/(\d{2})(\d{2})$`)
+	tafFromRE   = regexp.MustCompile(`^FM(\d{2})(\d{2})(\d{2})$`)
+	tafProbRE   = regexp.MustCompile(`^PROB\d{2}$`)
+	tafCloudRE  = regexp.MustCompile(`^(FEW|SCT|BKN|OVC|VV)(\d{3}|///)`)
+)
+
+// ParseTAF decodes a raw terminal aerodrome forecast, for example
+// "TAF KPHL 151720Z 1518/1624 27012G20KT P6SM BKN050 FM152200 28008KT P6SM SCT050".
+// The days of the forecast are placed in the current month, or the one before
+// or after it when they are more than half a month away.
+func ParseTAF(raw string) (TAF, error) {
+	var taf TAF
+	tokens := strings.Fields(strings.TrimSuffix(strings.TrimSpace(raw), "="))
+	for len(tokens) > 0 && (tokens[0] == "TAF" || tokens[0] == "AMD" || tokens[0] == "COR") {
+		tokens = tokens[1:]
+	}
+	if len(tokens) < 3 {
+		return TAF{}, fmt.Errorf("invalid TAF %q", raw)
+	}
+	taf.Station = tokens[0]
+	match := tafIssuedRE.FindStringSubmatch(tokens[1])
+	if match == nil {
+		return TAF{}, fmt.Errorf("invalid issue time in TAF %q", raw)
+	}
+	taf.Issued = tafTime(time.Now().UTC(), match[1], match[2], match[3])
+	match = tafPeriodRE.FindStringSubmatch(tokens[2])
+	if match == nil {
+		return TAF{}, fmt.Errorf("invalid valid period in TAF %q", raw)
+	}
+	group := TAFGroup{
+		Change: "BASE",
+		From:   tafTime(taf.Issued, match[1], match[2], "00"),
+		To:     tafTime(taf.Issued, match[3], match[4], "00"),
+	}
+	end := group.To
+
+	for i := 3; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == "RMK" || token == "NIL" {
+			break
+		}
+		switch {
+		case tafFromRE.MatchString(token):
+			taf.Groups = append(taf.Groups, group)
+			match := tafFromRE.FindStringSubmatch(token)
+			group = TAFGroup{Change: "FM", From: tafTime(taf.Issued, match[1], match[2], match[3]), To: end}
+			continue
+		case token == "TEMPO" || token == "BECMG" || tafProbRE.MatchString(token):
+			taf.Groups = append(taf.Groups, group)
+			group = TAFGroup{Change: token}
+			if tafProbRE.MatchString(token) && i+1 < len(tokens) && tokens[i+1] == "TEMPO" {
+				group.Change += " TEMPO"
+				i++
+			}
+			if i+1 < len(tokens) {
+				if match := tafPeriodRE.FindStringSubmatch(tokens[i+1]); match != nil {
+					group.From = tafTime(taf.Issued, match[1], match[2], "00")
+					group.To = tafTime(taf.Issued, match[3], match[4], "00")
+					i++
+				}
+			}
+			continue
+		}
+		group.decode(tokens, i)
+	}
+	taf.Groups = append(taf.Groups, group)
+
+	// each FM group lasts until the next one
+	var last *TAFGroup
+	for i := range taf.Groups {
+		if taf.Groups[i].Change != "BASE" && taf.Groups[i].Change != "FM" {
+			continue
+		}
+		if last != nil {
+			last.To = taf.Groups[i].From
+		}
+		last = &taf.Groups[i]
+	}
+	return taf, nil
+}
+
+// decode decodes the weather element tokens[i] into the group.
+func (g *TAFGroup) decode(tokens []string, i int) {
+	token := tokens[i]
+	switch {
+	case metarWindRE.MatchString(token):
+		match := metarWindRE.FindStringSubmatch(token)
+		factor := map[string]float64{"KT": 1.852, "MPS": 3.6, "KMH": 1}[match[4]]
+		if match[1] != "VRB" {
+			direction, _ := strconv.ParseFloat(match[1], 64)
+			g.WindDirection = float(direction)
+		}
+		speed, _ := strconv.ParseFloat(match[2], 64)
+		g.WindSpeed = float(speed * factor)
+		if match[3] != "" {
+			gust, _ := strconv.ParseFloat(match[3], 64)
+			g.WindGust = float(gust * factor)
+		}
+	case metarVisibilityRE.MatchString(strings.TrimPrefix(token, "P")):
+		// P6SM is more than six miles, and is read as six
+		match := metarVisibilityRE.FindStringSubmatch(strings.TrimPrefix(token, "P"))
+		var miles float64
+		if match[1] != "" {
+			miles, _ = strconv.ParseFloat(match[1], 64)
+		} else {
+			numerator, _ := strconv.ParseFloat(match[2], 64)
+			denominator, _ := strconv.ParseFloat(match[3], 64)
+			if denominator != 0 {
+				miles = numerator / denominator
+			}
+			// whole miles come in their own token, as in "1 1/2SM"
+			if i > 0 {
+				if whole, err := strconv.Atoi(tokens[i-1]); err == nil && whole < 10 {
+					miles += float64(whole)
+				}
+			}
+		}
+		g.Visibility = float(miles * 1609.344)
+	case metarMetersRE.MatchString(token):
+		meters, _ := strconv.ParseFloat(token, 64)
+		// 9999 stands for 10 kilometers or more
+		if meters == 9999 {
+			meters = 10000
+		}
+		g.Visibility = float(meters)
+	case token == "CAVOK":
+		g.Visibility = float(10000)
+		g.Sky = true
+	case token == "SKC" || token == "NSC" || token == "CLR":
+		g.Sky = true
+	case tafCloudRE.MatchString(token):
+		match := tafCloudRE.FindStringSubmatch(token)
+		g.Sky = true
+		hundreds, err := strconv.ParseFloat(match[2], 64)
+		if err != nil || (match[1] != "BKN" && match[1] != "OVC" && match[1] != "VV") {
+			return
+		}
+		if base := hundreds * 100 * 0.3048; g.Ceiling == nil || base < *g.Ceiling {
+			g.Ceiling = float(base)
+		}
+	}
+}
+
+// tafTime returns the time of a TAF day, hour and minute in the month of
+// reference, or the month before or after it when that is closer to
+// reference. Hour 24 is midnight at the end of the day.
+func tafTime(reference time.Time, day, hour, minute string) time.Time {
+	d, _ := strconv.Atoi(day)
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(minute)
+	t := time.Date(reference.Year(), reference.Month(), d, h, m, 0, 0, time.UTC)
+	// forecasts run at most a few days past the issue time, so days well
+	// before or after reference fall in the next or previous month
+	if t.Sub(reference) > 15*24*time.Hour {
+		t = time.Date(reference.Year(), reference.Month()-1, d, h, m, 0, 0, time.UTC)
+	} else if reference.Sub(t) > 15*24*time.Hour {
+		t = time.Date(reference.Year(), reference.Month()+1, d, h, m, 0, 0, time.UTC)
+	}
+	return t
+}
+
+// FlightCategory returns the flight category, VFR, MVFR, IFR or LIFR, of a
+// ceiling and visibility in meters. A nil ceiling is unlimited.
+func FlightCategory(ceiling *float64, visibility float64) string {
+	feet := math.Inf(1)
+	if ceiling != nil {
+		feet = *ceiling / 0.3048
+	}
+	miles := visibility / 1609.344
+	switch {
+	case feet < 500 || miles < 1:
+		return "LIFR"
+	case feet < 1000 || miles < 3:
+		return "IFR"
+	case feet <= 3000 || miles <= 5:
+		return "MVFR"
+	default:
+		return "VFR"
+	}
+}
+
+// updateTAFMetrics replaces the station's TAF series with the groups of the
+// forecast. Change groups only forecast the elements that change, so their
+// flight category is worked out from the prevailing group's values for the
+// elements they leave out.
+func updateTAFMetrics(station string, taf TAF) {
+	labels := prometheus.Labels{"station": station}
+	for _, vec := range []*prometheus.GaugeVec{
+		tafCeiling, tafVisibility, tafWindSpeed, tafWindGust, tafWindDirection,
+		tafFlightCategory, tafIssued,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+	if taf.Issued.IsZero() {
+		return
+	}
+
+	tafIssued.WithLabelValues(station).Set(float64(taf.Issued.Unix()))
+	var prevailing TAFGroup
+	for _, group := range taf.Groups {
+		values := []string{station, group.Change, group.From.Format(time.RFC3339), group.To.Format(time.RFC3339)}
+		if group.Ceiling != nil {
+			tafCeiling.WithLabelValues(values...).Set(*group.Ceiling)
+		}
+		if group.Visibility != nil {
+			tafVisibility.WithLabelValues(values...).Set(*group.Visibility)
+		}
+		if group.WindSpeed != nil {
+			tafWindSpeed.WithLabelValues(values...).Set(*group.WindSpeed)
+		}
+		if group.WindGust != nil {
+			tafWindGust.WithLabelValues(values...).Set(*group.WindGust)
+		}
+		if group.WindDirection != nil {
+			tafWindDirection.WithLabelValues(values...).Set(*group.WindDirection)
+		}
+
+		merged := group
+		if group.Change != "BASE" && group.Change != "FM" {
+			if !merged.Sky {
+				merged.Ceiling = prevailing.Ceiling
+			}
+			if merged.Visibility == nil {
+				merged.Visibility = prevailing.Visibility
+			}
+		} else {
+			prevailing = group
+		}
+		if merged.Visibility != nil {
+			category := FlightCategory(merged.Ceiling, *merged.Visibility)
+			tafFlightCategory.WithLabelValues(append(values, category)...).Set(1)
+		}
+	}
+}
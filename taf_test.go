@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// tafAt formats t as the day, hour and minute of a TAF, "ddhhmm".
+func tafAt(t time.Time) string {
+	return t.Format("021504")
+}
+
+func TestParseTAF(t *testing.T) {
+	// the days of a TAF are placed relative to the current date, so the
+	// forecast is written around it
+	issued := time.Now().UTC().Truncate(time.Hour)
+	from := issued.Add(time.Hour)
+	to := from.Add(24 * time.Hour)
+	fm := from.Add(5 * time.Hour)
+	tempo := fm.Add(2 * time.Hour)
+	tempoEnd := tempo.Add(3 * time.Hour)
+	second := tempo.Add(6 * time.Hour)
+	raw := fmt.Sprintf("TAF AMD KPHL %sZ %s/%s 27012G20KT P6SM BKN050 "+
+		"FM%s VRB03KT 1 1/2SM OVC008 "+
+		"PROB30 %s/%s 9999 SKC "+
+		"FM%s 31010KT P6SM SCT250 RMK NXT FCST BY 00Z=",
+		tafAt(issued), tafAt(from)[:4], tafAt(to)[:4],
+		tafAt(fm),
+		tafAt(tempo)[:4], tafAt(tempoEnd)[:4],
+		tafAt(second))
+
+	taf, err := ParseTAF(raw)
+	if err != nil {
+		t.Fatalf("ParseTAF(%q) failed: %v", raw, err)
+	}
+	if taf.Station != "KPHL" || !taf.Issued.Equal(issued) {
+		t.Errorf("ParseTAF: station %s issued %v, want KPHL issued %v", taf.Station, taf.Issued, issued)
+	}
+	if len(taf.Groups) != 4 {
+		t.Fatalf("ParseTAF: %d groups, want 4: %+v", len(taf.Groups), taf.Groups)
+	}
+
+	base := taf.Groups[0]
+	if base.Change != "BASE" || !base.From.Equal(from) || !base.To.Equal(fm) {
+		t.Errorf("base group: %s from %v to %v, want BASE from %v until the first FM at %v", base.Change, base.From, base.To, from, fm)
+	}
+	if !sameValue(base.WindDirection, float(270)) || !sameValue(base.WindSpeed, float(12*1.852)) || !sameValue(base.WindGust, float(20*1.852)) {
+		t.Errorf("base group wind: %s° at %s gusting %s", describe(base.WindDirection), describe(base.WindSpeed), describe(base.WindGust))
+	}
+	if !sameValue(base.Visibility, float(6*1609.344)) || !sameValue(base.Ceiling, float(5000*0.3048)) || !base.Sky {
+		t.Errorf("base group: visibility %s, ceiling %s, sky %v", describe(base.Visibility), describe(base.Ceiling), base.Sky)
+	}
+
+	// the first FM group lasts until the second, past the PROB30 group
+	first := taf.Groups[1]
+	if first.Change != "FM" || !first.From.Equal(fm) || !first.To.Equal(second) {
+		t.Errorf("first FM group: %s from %v to %v", first.Change, first.From, first.To)
+	}
+	if first.WindDirection != nil || !sameValue(first.WindSpeed, float(3*1.852)) {
+		t.Errorf("first FM group: variable wind read as %s° at %s", describe(first.WindDirection), describe(first.WindSpeed))
+	}
+	if !sameValue(first.Visibility, float(1.5*1609.344)) || !sameValue(first.Ceiling, float(800*0.3048)) {
+		t.Errorf("first FM group: visibility %s, ceiling %s", describe(first.Visibility), describe(first.Ceiling))
+	}
+
+	prob := taf.Groups[2]
+	if prob.Change != "PROB30" || !prob.From.Equal(tempo) || !prob.To.Equal(tempoEnd) {
+		t.Errorf("PROB30 group: %s from %v to %v", prob.Change, prob.From, prob.To)
+	}
+	if !sameValue(prob.Visibility, float(10000)) || prob.Ceiling != nil || !prob.Sky || prob.WindSpeed != nil {
+		t.Errorf("PROB30 group: visibility %s, ceiling %s, sky %v, wind %s", describe(prob.Visibility), describe(prob.Ceiling), prob.Sky, describe(prob.WindSpeed))
+	}
+
+	// the last FM group runs to the end of the forecast, and the remarks
+	// are not decoded
+	last := taf.Groups[3]
+	if last.Change != "FM" || !last.To.Equal(to) || last.Ceiling != nil || !last.Sky {
+		t.Errorf("last FM group: %s to %v, ceiling %s, sky %v", last.Change, last.To, describe(last.Ceiling), last.Sky)
+	}
+}
+
+func TestParseTAFProbTempo(t *testing.T) {
+	day := time.Now().UTC().Format("02")
+	taf, err := ParseTAF("TAF EGLL " + day + "0500Z " + day + "06/" + day + "12 24010KT CAVOK PROB30 TEMPO " + day + "08/" + day + "10 4000 BKN012")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taf.Groups) != 2 {
+		t.Fatalf("ParseTAF: %d groups, want 2", len(taf.Groups))
+	}
+	if base := taf.Groups[0]; !sameValue(base.Visibility, float(10000)) || base.Ceiling != nil || !base.Sky {
+		t.Errorf("CAVOK: visibility %s, ceiling %s, sky %v", describe(base.Visibility), describe(base.Ceiling), base.Sky)
+	}
+	prob := taf.Groups[1]
+	if prob.Change != "PROB30 TEMPO" || prob.From.Hour() != 8 || prob.To.Hour() != 10 {
+		t.Errorf("PROB30 TEMPO group: %q from %v to %v", prob.Change, prob.From, prob.To)
+	}
+	if !sameValue(prob.Visibility, float(4000)) || !sameValue(prob.Ceiling, float(1200*0.3048)) {
+		t.Errorf("PROB30 TEMPO group: visibility %s, ceiling %s", describe(prob.Visibility), describe(prob.Ceiling))
+	}
+}
+
+func TestParseTAFInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"TAF KPHL",
+		"TAF KPHL NIL=",
+		"TAF KPHL 1517Z 1518/1624 27012KT",
+		"TAF KPHL 151720Z 15/16 27012KT",
+	} {
+		if taf, err := ParseTAF(raw); err == nil {
+			t.Errorf("ParseTAF(%q) = %+v, want an error", raw, taf)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pressureTendency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pressure_tendency_pascals",
+			Help: "change in barometric pressure over the last 3 hours in pascals",
+		},
+		[]string{"station"},
+	)
+	pressureTendencyInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pressure_tendency_info",
+			Help: "whether the barometric pressure is rising, falling or steady over the last 3 hours, always 1",
+		},
+		[]string{"station", "tendency"},
+	)
+)
+
+// tendencyPeriod is the period pressure tendency is measured over, the
+// standard period of synoptic reports.
+const tendencyPeriod = 3 * time.Hour
+
+// pressureSample is the barometric pressure of a single observation.
+type pressureSample struct {
+	time     time.Time
+	pressure float64
+}
+
+// pressureHistory holds the recent pressures of every station, oldest first.
+var pressureHistory = struct {
+	sync.Mutex
+	samples map[string][]pressureSample
+}{samples: map[string][]pressureSample{}}
+
+// updatePressureTendency records the observation's pressure and sets the
+// station's tendency from the change since the observation closest to three
+// hours earlier. Until the exporter has seen at least two and a half hours of
+// observations the tendency is not exported, nor is it for an observation
+// without a pressure.
+func updatePressureTendency(station string, response ObservationResponse) {
+	pressure, ok := value(response.Properties.BarometricPressure)
+	if !ok {
+		pressureTendencyInfo.DeletePartialMatch(prometheus.Labels{"station": station})
+		deleteGauge(pressureTendency, station)
+		return
+	}
+	now := response.Properties.Timestamp
+
+	pressureHistory.Lock()
+	samples := pressureHistory.samples[station]
+	if n := len(samples); n == 0 || now.After(samples[n-1].time) {
+		samples = append(samples, pressureSample{time: now, pressure: pressure})
+	}
+	// keep a little more than the period so there is always a sample close
+	// to three hours old
+	for len(samples) > 0 && now.Sub(samples[0].time) > tendencyPeriod+time.Hour {
+		samples = samples[1:]
+	}
+	pressureHistory.samples[station] = samples
+
+	past := samples[0]
+	for _, sample := range samples {
+		if absDuration(now.Sub(sample.time)-tendencyPeriod) < absDuration(now.Sub(past.time)-tendencyPeriod) {
+			past = sample
+		}
+	}
+	pressureHistory.Unlock()
+
+	pressureTendencyInfo.DeletePartialMatch(prometheus.Labels{"station": station})
+	if now.Sub(past.time) < tendencyPeriod*5/6 {
+		deleteGauge(pressureTendency, station)
+		return
+	}
+
+	change := pressure - past.pressure
+	setGauge(pressureTendency, station, change)
+	tendency := "steady"
+	switch {
+	case change > pressureSteadyThreshold:
+		tendency = "rising"
+	case change < -pressureSteadyThreshold:
+		tendency = "falling"
+	}
+	pressureTendencyInfo.WithLabelValues(station, tendency).Set(1)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
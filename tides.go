@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var tideObservedLevel = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "tide_observed_water_level_meters",
+		Help: "latest water level observed at the station's tide station in meters above -tides.datum",
+	},
+	[]string{"station"},
+)
+
+// tidePredictions exports the predicted tides of every station with a tide
+// station.
+var tidePredictions = &tideTimer{
+	levels:   map[string][]TidePrediction{},
+	extremes: map[string][]TidePrediction{},
+	level: prometheus.NewDesc("tide_predicted_water_level_meters",
+		"water level currently predicted at the station's tide station in meters above -tides.datum",
+		[]string{"station"}, nil),
+	next: prometheus.NewDesc("tide_next_timestamp_seconds",
+		"time of the next high and low tide predicted at the station's tide station as a unix timestamp",
+		[]string{"station", "type"}, nil),
+	until: prometheus.NewDesc("tide_next_seconds",
+		"seconds until the next high and low tide predicted at the station's tide station",
+		[]string{"station", "type"}, nil),
+}
+
+// tidePredictionsInterval is the time between retrievals of the predicted
+// tides of a station, which cover the following two days.
+const tidePredictionsInterval = 12 * time.Hour
+
+func init() {
+	registerCollector("tides", false, &tidesCollector{}, tideObservedLevel, tidePredictions)
+}
+
+// tidesCollector exports the predicted and observed tides of the stations
+// given a tide station in the -config file, retrieved from the center for
+// operational oceanographic products and services at -tides.address. The
+// observed water level is retrieved every -tides.interval, the predictions
+// twice a day.
+type tidesCollector struct {
+	predictions, observations refreshTracker
+}
+
+func (c *tidesCollector) Update(ctx context.Context, config StationConfig) error {
+	if config.TideStation == "" {
+		return nil
+	}
+	configMu.RLock()
+	interval, addr, t := tidesInterval, tidesAddress, timeout
+	configMu.RUnlock()
+
+	if c.predictions.Due(config.ID, tidePredictionsInterval) {
+		begin := time.Now().Add(-time.Hour)
+		levels, err := RetrieveTidePredictions(ctx, config.TideStation, begin, false, addr, t)
+		if err != nil {
+			return fmt.Errorf("retrieving predictions of tide station %s: %w", config.TideStation, err)
+		}
+		extremes, err := RetrieveTidePredictions(ctx, config.TideStation, begin, true, addr, t)
+		if err != nil {
+			return fmt.Errorf("retrieving high and low tides of tide station %s: %w", config.TideStation, err)
+		}
+		tidePredictions.Set(config.ID, levels, extremes)
+		c.predictions.Done(config.ID)
+	}
+
+	if c.observations.Due(config.ID, interval) {
+		level, ok, err := RetrieveObservedWaterLevel(ctx, config.TideStation, addr, t)
+		if err != nil {
+			return fmt.Errorf("retrieving water level of tide station %s: %w", config.TideStation, err)
+		}
+		if ok {
+			tideObservedLevel.WithLabelValues(config.ID).Set(level)
+		} else {
+			tideObservedLevel.DeleteLabelValues(config.ID)
+		}
+		c.observations.Done(config.ID)
+	}
+	return nil
+}
+
+// Forget forgets when the station's tides were refreshed.
+func (c *tidesCollector) Forget(station string) {
+	c.predictions.Forget(station)
+	c.observations.Forget(station)
+}
+
+var tideStationRE = regexp.MustCompile(`^[0-9]{7}$`)
+
+// ValidateTideStation checks that id is a seven digit tide station id, such as
+// 8545240.
+func ValidateTideStation(id string) error {
+	if !tideStationRE.MatchString(id) {
+		return fmt.Errorf("invalid tide station id %q", id)
+	}
+	return nil
+}
+
+// TidePrediction is the water level predicted at a time. Type is H or L for
+// high and low tides, and empty otherwise.
+type TidePrediction struct {
+	Time  time.Time
+	Level float64
+	Type  string
+}
+
+// tidesTimeLayout is the layout of times in the responses of the tides api,
+// which are requested in gmt.
+const tidesTimeLayout = "2006-01-02 15:04"
+
+// TidesResponse is the json structure returned by the tides api. Errors, such
+// as a station that does not measure the water level, are reported in Error
+// with a 200 status.
+type TidesResponse struct {
+	Predictions []struct {
+		T    string `json:"t"`
+		V    string `json:"v"`
+		Type string `json:"type"`
+	} `json:"predictions"`
+	Data []struct {
+		T string `json:"t"`
+		V string `json:"v"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// retrieveTides requests a product from the tides api at address.
+func retrieveTides(ctx context.Context, query url.Values, address string, timeout int) (TidesResponse, error) {
+	configMu.RLock()
+	query.Set("datum", tidesDatum)
+	configMu.RUnlock()
+	query.Set("time_zone", "gmt")
+	query.Set("units", "metric")
+	query.Set("format", "json")
+	query.Set("application", "nws_exporter")
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/api/prod/datagetter",
+		RawQuery: query.Encode(),
+	}
+
+	response := TidesResponse{}
+	_, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &response)
+	return response, err
+}
+
+// RetrieveTidePredictions retrieves the water levels predicted at the tide
+// station every six minutes for the two days following begin, or only the
+// high and low tides when extremes is set.
+func RetrieveTidePredictions(ctx context.Context, station string, begin time.Time, extremes bool, address string, timeout int) ([]TidePrediction, error) {
+	query := url.Values{
+		"product":    {"predictions"},
+		"station":    {station},
+		"begin_date": {begin.UTC().Format("20060102 15:04")},
+		"range":      {"48"},
+	}
+	if extremes {
+		query.Set("interval", "hilo")
+	}
+	response, err := retrieveTides(ctx, query, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, errors.New(response.Error.Message)
+	}
+
+	var predictions []TidePrediction
+	for _, p := range response.Predictions {
+		t, err := time.Parse(tidesTimeLayout, p.T)
+		if err != nil {
+			return nil, err
+		}
+		level, err := strconv.ParseFloat(p.V, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid predicted water level %q", p.V)
+		}
+		predictions = append(predictions, TidePrediction{Time: t, Level: level, Type: p.Type})
+	}
+	return predictions, nil
+}
+
+// RetrieveObservedWaterLevel retrieves the latest water level observed at the
+// tide station, reporting false when the station does not measure it.
+func RetrieveObservedWaterLevel(ctx context.Context, station string, address string, timeout int) (float64, bool, error) {
+	query := url.Values{
+		"product": {"water_level"},
+		"station": {station},
+		"date":    {"latest"},
+	}
+	response, err := retrieveTides(ctx, query, address, timeout)
+	if err != nil {
+		return 0, false, err
+	}
+	if response.Error != nil || len(response.Data) == 0 {
+		return 0, false, nil
+	}
+	level, err := strconv.ParseFloat(response.Data[0].V, 64)
+	if err != nil {
+		// the latest observation may not have been measured yet
+		return 0, false, nil
+	}
+	return level, true, nil
+}
+
+// tideTimer exports the predicted tides of every station. The predicted
+// level and the time to the next tides are worked out when the metrics are
+// collected, so they follow the tide between retrievals of the predictions.
+// It implements DeletePartialMatch like the metric vectors.
+type tideTimer struct {
+	mu       sync.Mutex
+	levels   map[string][]TidePrediction
+	extremes map[string][]TidePrediction
+
+	level, next, until *prometheus.Desc
+}
+
+// Set replaces the predicted water levels and high and low tides of the
+// station, both in time order.
+func (t *tideTimer) Set(station string, levels, extremes []TidePrediction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.levels[station] = levels
+	t.extremes[station] = extremes
+}
+
+func (t *tideTimer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.level
+	ch <- t.next
+	ch <- t.until
+}
+
+func (t *tideTimer) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for station, levels := range t.levels {
+		if level, ok := PredictedLevel(levels, now); ok {
+			ch <- prometheus.MustNewConstMetric(t.level, prometheus.GaugeValue, level, station)
+		}
+	}
+	for station, extremes := range t.extremes {
+		for _, tide := range []struct{ code, name string }{{"H", "high"}, {"L", "low"}} {
+			for _, extreme := range extremes {
+				if extreme.Type != tide.code || !extreme.Time.After(now) {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(t.next, prometheus.GaugeValue, float64(extreme.Time.Unix()), station, tide.name)
+				ch <- prometheus.MustNewConstMetric(t.until, prometheus.GaugeValue, extreme.Time.Sub(now).Seconds(), station, tide.name)
+				break
+			}
+		}
+	}
+}
+
+func (t *tideTimer) DeletePartialMatch(labels prometheus.Labels) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	station := labels["station"]
+	n := 0
+	if _, ok := t.levels[station]; ok {
+		n++
+	}
+	delete(t.levels, station)
+	delete(t.extremes, station)
+	return n
+}
+
+// PredictedLevel interpolates the water level at now between the predictions
+// around it, reporting false when now is not covered by the predictions.
+func PredictedLevel(levels []TidePrediction, now time.Time) (float64, bool) {
+	for i := 1; i < len(levels); i++ {
+		before, after := levels[i-1], levels[i]
+		if now.Before(before.Time) || now.After(after.Time) {
+			continue
+		}
+		span := after.Time.Sub(before.Time).Seconds()
+		if span == 0 {
+			return before.Level, true
+		}
+		fraction := now.Sub(before.Time).Seconds() / span
+		return before.Level + fraction*(after.Level-before.Level), true
+	}
+	return 0, false
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tropicalDistance = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tropical_cyclone_distance_meters",
+			Help: "distance from the station to the center of the nearest active tropical cyclone in meters",
+		},
+		[]string{"station"},
+	)
+	tropicalWindSpeed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tropical_cyclone_wind_speed_kilometers_per_hour",
+			Help: "maximum sustained wind speed of the nearest active tropical cyclone in kilometers per hour",
+		},
+		[]string{"station"},
+	)
+	tropicalPressure = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tropical_cyclone_pressure_pascals",
+			Help: "minimum central pressure of the nearest active tropical cyclone in pascals",
+		},
+		[]string{"station"},
+	)
+	tropicalInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tropical_cyclone_info",
+			Help: "nearest active tropical cyclone to the station, always 1",
+		},
+		[]string{"station", "id", "name", "classification"},
+	)
+	tropicalInCone = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tropical_cyclone_in_cone",
+			Help: "whether the station is inside the forecast cone of an active tropical cyclone, 1 when it is and 0 otherwise",
+		},
+		[]string{"station"},
+	)
+)
+
+func init() {
+	registerCollector("tropical", false, &tropicalCollector{}, tropicalDistance, tropicalWindSpeed, tropicalPressure, tropicalInfo, tropicalInCone)
+}
+
+// tropicalCollector exports the nearest active tropical cyclone to each station
+// and whether the station is inside the forecast cone of any, from the
+// products of the national hurricane center at -tropical.address. The active
+// cyclones are retrieved every -tropical.interval however many stations are
+// scraped.
+type tropicalCollector struct {
+	refreshTracker
+
+	mu sync.Mutex
+	// retrieved is set once the storms and cones are first retrieved
+	retrieved bool
+	storms    []TropicalCyclone
+	cones     [][][][2]float64
+	fetched   refreshTracker
+}
+
+func (c *tropicalCollector) Update(ctx context.Context, config StationConfig) error {
+	configMu.RLock()
+	interval, tropicalAddr, addr, t := tropicalInterval, tropicalAddress, address, timeout
+	configMu.RUnlock()
+	if !c.Due(config.ID, interval) {
+		return nil
+	}
+	point, err := StationPoint(ctx, config.ID, addr, t)
+	if err != nil {
+		return err
+	}
+	if len(point.Geometry.Coordinates) < 2 {
+		return fmt.Errorf("point of station %s has no location", config.ID)
+	}
+	lon, lat := point.Geometry.Coordinates[0], point.Geometry.Coordinates[1]
+
+	storms, cones, ok, err := c.activeStorms(ctx, interval, tropicalAddr, t)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// the storms are being retrieved for another station, and the
+		// station is updated on its next scrape
+		return nil
+	}
+	updateTropicalMetrics(config.ID, lat, lon, storms, cones)
+	c.Done(config.ID)
+	return nil
+}
+
+// activeStorms returns the active tropical cyclones and the polygons of their
+// forecast cones, retrieving them again when they were retrieved at least
+// -tropical.interval ago. Stations share the storms, which are claimed by the
+// first of them to find them due, and it reports false when they were claimed
+// by another station that has yet to retrieve them.
+func (c *tropicalCollector) activeStorms(ctx context.Context, interval time.Duration, address string, timeout int) ([]TropicalCyclone, [][][][2]float64, bool, error) {
+	// the cyclones are tracked under an empty station id, which no station
+	// has
+	if !c.fetched.Claim("", interval) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.storms, c.cones, c.retrieved, nil
+	}
+
+	storms, err := RetrieveActiveCyclones(ctx, address, timeout)
+	if err != nil {
+		c.fetched.Forget("")
+		return nil, nil, false, fmt.Errorf("retrieving active tropical cyclones: %w", err)
+	}
+	var cones [][][][2]float64
+	for _, storm := range storms {
+		if storm.TrackCone.KMZFile == "" {
+			continue
+		}
+		polygons, err := RetrieveCone(ctx, storm.TrackCone.KMZFile, timeout)
+		if err != nil {
+			c.fetched.Forget("")
+			return nil, nil, false, fmt.Errorf("retrieving forecast cone of %s: %w", storm.ID, err)
+		}
+		cones = append(cones, polygons...)
+	}
+
+	c.mu.Lock()
+	c.storms, c.cones, c.retrieved = storms, cones, true
+	c.mu.Unlock()
+	return storms, cones, true, nil
+}
+
+// TropicalCyclone is an active tropical cyclone as listed by the national
+// hurricane center. Intensity is the maximum sustained wind in knots and
+// Pressure the minimum central pressure in millibars.
+type TropicalCyclone struct {
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	Classification string      `json:"classification"`
+	Intensity      json.Number `json:"intensity"`
+	Pressure       json.Number `json:"pressure"`
+	Latitude       float64     `json:"latitudeNumeric"`
+	Longitude      float64     `json:"longitudeNumeric"`
+	TrackCone      struct {
+		KMZFile string `json:"kmzFile"`
+	} `json:"trackCone"`
+}
+
+// RetrieveActiveCyclones retrieves the active tropical cyclones from the
+// national hurricane center at address.
+func RetrieveActiveCyclones(ctx context.Context, address string, timeout int) ([]TropicalCyclone, error) {
+	requestURL := url.URL{
+		Scheme: "https",
+		Host:   address,
+		Path:   "/CurrentStorms.json",
+	}
+
+	var response struct {
+		ActiveStorms []TropicalCyclone `json:"activeStorms"`
+	}
+	_, err := retrieveJSON(ctx, requestURL, timeout, "application/json", &response)
+	return response.ActiveStorms, err
+}
+
+// RetrieveCone retrieves the forecast cone of a tropical cyclone from the kmz
+// file at rawURL, returning its polygons.
+func RetrieveCone(ctx context.Context, rawURL string, timeout int) ([][][][2]float64, error) {
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetch(ctx, *requestURL, timeout, "application/vnd.google-earth.kmz")
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		if !strings.EqualFold(path.Ext(file.Name), ".kml") {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ParseKMLPolygons(r)
+	}
+	return nil, fmt.Errorf("no kml file in %s", rawURL)
+}
+
+// ParseKMLPolygons returns the polygons of a kml document, each an outer ring
+// of longitude, latitude positions followed by the rings of its holes.
+func ParseKMLPolygons(r io.Reader) ([][][][2]float64, error) {
+	var polygons [][][][2]float64
+	inCoordinates := false
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return polygons, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "Polygon":
+				polygons = append(polygons, nil)
+			case "coordinates":
+				inCoordinates = len(polygons) != 0
+			}
+		case xml.EndElement:
+			if token.Name.Local == "coordinates" {
+				inCoordinates = false
+			}
+		case xml.CharData:
+			if !inCoordinates {
+				continue
+			}
+			var ring [][2]float64
+			for _, position := range strings.Fields(string(token)) {
+				parts := strings.Split(position, ",")
+				if len(parts) < 2 {
+					return nil, fmt.Errorf("invalid kml coordinates %q", position)
+				}
+				lon, err := strconv.ParseFloat(parts[0], 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid kml coordinates %q", position)
+				}
+				lat, err := strconv.ParseFloat(parts[1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid kml coordinates %q", position)
+				}
+				ring = append(ring, [2]float64{lon, lat})
+			}
+			if len(ring) != 0 {
+				polygons[len(polygons)-1] = append(polygons[len(polygons)-1], ring)
+			}
+		}
+	}
+}
+
+// greatCircleDistance returns the distance between two locations in meters.
+func greatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371008.8
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLon := (lon2 - lon1) * toRadians
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// updateTropicalMetrics replaces the station's series with the nearest of the
+// storms and whether it lies inside any of the cones.
+func updateTropicalMetrics(station string, lat, lon float64, storms []TropicalCyclone, cones [][][][2]float64) {
+	labels := prometheus.Labels{"station": station}
+	for _, vec := range []*prometheus.GaugeVec{tropicalDistance, tropicalWindSpeed, tropicalPressure, tropicalInfo} {
+		vec.DeletePartialMatch(labels)
+	}
+
+	nearest := -1
+	nearestDistance := 0.0
+	for i, storm := range storms {
+		distance := greatCircleDistance(lat, lon, storm.Latitude, storm.Longitude)
+		if nearest < 0 || distance < nearestDistance {
+			nearest, nearestDistance = i, distance
+		}
+	}
+	if nearest >= 0 {
+		storm := storms[nearest]
+		tropicalDistance.WithLabelValues(station).Set(nearestDistance)
+		tropicalInfo.WithLabelValues(station, storm.ID, storm.Name, storm.Classification).Set(1)
+		if knots, err := storm.Intensity.Float64(); err == nil {
+			tropicalWindSpeed.WithLabelValues(station).Set(knots * 1.852)
+		}
+		if millibars, err := storm.Pressure.Float64(); err == nil {
+			tropicalPressure.WithLabelValues(station).Set(millibars * 100)
+		}
+	}
+
+	inCone := 0.0
+	for _, polygon := range cones {
+		if polygonContains(polygon, lat, lon) {
+			inCone = 1
+			break
+		}
+	}
+	tropicalInCone.WithLabelValues(station).Set(inCone)
+}
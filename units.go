@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Quantity is a kind of physical quantity reported by the api, each of which
+// is exported in a single canonical unit.
+type Quantity int
+
+const (
+	// Temperature is canonically in degrees celsius.
+	Temperature Quantity = iota
+	// Speed is canonically in kilometers per hour.
+	Speed
+	// Pressure is canonically in pascals.
+	Pressure
+	// Distance is canonically in meters.
+	Distance
+	// Depth is canonically in millimeters, used for precipitation.
+	Depth
+	// Angle is canonically in degrees.
+	Angle
+	// Percent is canonically a percentage.
+	Percent
+	// Index is a dimensionless index, such as the Haines index.
+	Index
+	// Flow is canonically in cubic meters per second, used for rivers.
+	Flow
+)
+
+// canonicalUnits are the unit codes values are converted to.
+var canonicalUnits = map[Quantity]string{
+	Temperature: "wmoUnit:degC",
+	Speed:       "wmoUnit:km_h-1",
+	Pressure:    "wmoUnit:Pa",
+	Distance:    "wmoUnit:m",
+	Depth:       "wmoUnit:mm",
+	Angle:       "wmoUnit:degree_(angle)",
+	Percent:     "wmoUnit:percent",
+	Index:       "wmoUnit:1",
+	Flow:        "wmoUnit:m3_s-1",
+}
+
+// unit is a unit the api may report a quantity in, with a conversion to the
+// quantity's canonical unit.
+type unit struct {
+	quantity    Quantity
+	toCanonical func(float64) float64
+}
+
+func scale(factor float64) func(float64) float64 {
+	return func(v float64) float64 { return v * factor }
+}
+
+// units are keyed by unit code without its "wmoUnit:" or "unit:" prefix.
+var units = map[string]unit{
+	"degC": {Temperature, scale(1)},
+	"degF": {Temperature, func(v float64) float64 { return (v - 32) * 5 / 9 }},
+	"K":    {Temperature, func(v float64) float64 { return v - 273.15 }},
+
+	"km_h-1": {Speed, scale(1)},
+	"m_s-1":  {Speed, scale(3.6)},
+	"kt":     {Speed, scale(1.852)},
+	"mi_h-1": {Speed, scale(1.609344)},
+
+	"Pa":    {Pressure, scale(1)},
+	"hPa":   {Pressure, scale(100)},
+	"mbar":  {Pressure, scale(100)},
+	"in_Hg": {Pressure, scale(3386.389)},
+
+	"m":  {Distance, scale(1)},
+	"km": {Distance, scale(1000)},
+	"ft": {Distance, scale(0.3048)},
+	"mi": {Distance, scale(1609.344)},
+
+	"degree_(angle)": {Angle, scale(1)},
+	"percent":        {Percent, scale(1)},
+	"1":              {Index, scale(1)},
+
+	"m3_s-1": {Flow, scale(1)},
+	"cfs":    {Flow, scale(0.028316846592)},
+	"kcfs":   {Flow, scale(28.316846592)},
+}
+
+// depthUnits are the units precipitation depths are reported in, converting
+// to millimeters.
+var depthUnits = map[string]func(float64) float64{
+	"mm": scale(1),
+	"cm": scale(10),
+	"m":  scale(1000),
+	"in": scale(25.4),
+}
+
+// Normalize converts the measurement's value to the canonical unit of q,
+// inspecting its unit code rather than assuming the documented unit. A
+// measurement without a unit code is assumed to already be canonical.
+func Normalize(m *Measurement, q Quantity) error {
+	if m == nil || m.Value == nil {
+		return nil
+	}
+	if m.UnitCode == "" {
+		m.UnitCode = canonicalUnits[q]
+		return nil
+	}
+
+	code := m.UnitCode
+	if i := strings.LastIndex(code, ":"); i >= 0 {
+		code = code[i+1:]
+	}
+
+	var convert func(float64) float64
+	if q == Depth {
+		convert = depthUnits[code]
+	} else if u, ok := units[code]; ok && u.quantity == q {
+		convert = u.toCanonical
+	}
+	if convert == nil {
+		return fmt.Errorf("unsupported unit %q", m.UnitCode)
+	}
+
+	v := convert(*m.Value)
+	m.Value = &v
+	m.UnitCode = canonicalUnits[q]
+	return nil
+}
+
+// normalizeUnits converts every value of the response to its canonical unit.
+// Values in units that cannot be converted are logged and dropped rather than
+// exported in the wrong unit.
+func normalizeUnits(station string, response *ObservationResponse) {
+	for _, m := range response.measurements() {
+		if err := Normalize(*m.measurement, m.quantity); err != nil {
+			logUnitError(station, m.property, err)
+			(*m.measurement).Value = nil
+		}
+	}
+	if response.Properties.CloudLayers != nil {
+		for i := range *response.Properties.CloudLayers {
+			base := &(*response.Properties.CloudLayers)[i].Base
+			if err := Normalize(base, Distance); err != nil {
+				logUnitError(station, "CloudLayers", err)
+				base.Value = nil
+			}
+		}
+	}
+}
+
+func logUnitError(station, property string, err error) {
+	log.Printf("Dropping %s of station %s: %s", property, station, err)
+}
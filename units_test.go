@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		value    float64
+		unitCode string
+		quantity Quantity
+		want     float64
+		wantUnit string
+	}{
+		{20, "wmoUnit:degC", Temperature, 20, "wmoUnit:degC"},
+		{68, "wmoUnit:degF", Temperature, 20, "wmoUnit:degC"},
+		{293.15, "wmoUnit:K", Temperature, 20, "wmoUnit:degC"},
+		{10, "wmoUnit:m_s-1", Speed, 36, "wmoUnit:km_h-1"},
+		{10, "wmoUnit:kt", Speed, 18.52, "wmoUnit:km_h-1"},
+		{1013, "wmoUnit:hPa", Pressure, 101300, "wmoUnit:Pa"},
+		{1, "wmoUnit:mi", Distance, 1609.344, "wmoUnit:m"},
+		{1, "wmoUnit:in", Depth, 25.4, "wmoUnit:mm"},
+		{2, "unit:kcfs", Flow, 56.633693184, "wmoUnit:m3_s-1"},
+		// a value without a unit is taken to be in the canonical unit
+		{5, "", Speed, 5, "wmoUnit:km_h-1"},
+	}
+
+	for _, test := range tests {
+		value := test.value
+		m := &Measurement{Value: &value, UnitCode: test.unitCode}
+		if err := Normalize(m, test.quantity); err != nil {
+			t.Errorf("Normalize(%v %s) failed: %v", test.value, test.unitCode, err)
+			continue
+		}
+		if !sameValue(m.Value, &test.want) || m.UnitCode != test.wantUnit {
+			t.Errorf("Normalize(%v %s) = %v %s, want %v %s", test.value, test.unitCode, *m.Value, m.UnitCode, test.want, test.wantUnit)
+		}
+	}
+}
+
+func TestNormalizeUnknownUnit(t *testing.T) {
+	// units of another quantity are rejected rather than converted
+	value := 20.0
+	if err := Normalize(&Measurement{Value: &value, UnitCode: "wmoUnit:degC"}, Speed); err == nil {
+		t.Error("Normalize of a temperature as a speed succeeded, want an error")
+	}
+	if err := Normalize(&Measurement{Value: &value, UnitCode: "wmoUnit:furlong"}, Distance); err == nil {
+		t.Error("Normalize of an unknown unit succeeded, want an error")
+	}
+}
+
+func TestNormalizeMissingValue(t *testing.T) {
+	m := &Measurement{UnitCode: "wmoUnit:furlong"}
+	if err := Normalize(m, Distance); err != nil || m.Value != nil {
+		t.Errorf("Normalize of a missing value = %v, %v, want nil, nil", m.Value, err)
+	}
+	if err := Normalize(nil, Distance); err != nil {
+		t.Errorf("Normalize(nil) failed: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// version, commit and buildDate are stamped at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Those left unset are filled in from the build information go embeds in the
+// binary, where available.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+var buildInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "exporter_build_info",
+		Help: "version, commit and build date of the exporter and the go version it was built with, always 1",
+	},
+	[]string{"version", "commit", "build_date", "goversion"},
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if ok && version == "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	if ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == "":
+				commit = setting.Value
+			case setting.Key == "vcs.time" && buildDate == "":
+				buildDate = setting.Value
+			}
+		}
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+	buildInfo.WithLabelValues(version, commit, buildDate, runtime.Version()).Set(1)
+}
+
+// versionString returns the version printed by -version.
+func versionString() string {
+	return fmt.Sprintf("nws_exporter version %s (commit %s, built %s, %s %s/%s)",
+		version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	headwind = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "headwind_kilometers_per_hour",
+			Help: "component of the wind along each -runway heading in kilometers per hour, negative for a tailwind",
+		},
+		[]string{"station", "runway"},
+	)
+	crosswind = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "crosswind_kilometers_per_hour",
+			Help: "component of the wind across each -runway heading in kilometers per hour, positive from the right",
+		},
+		[]string{"station", "runway"},
+	)
+)
+
+// headingsFlag is a repeatable flag collecting name=heading pairs, such as
+// runway headings. A single value may also hold several comma separated pairs,
+// and an empty value clears the headings. The headings may be set again by a
+// config reload while stations are being scraped, so they are guarded by a
+// mutex.
+type headingsFlag struct {
+	mu       sync.Mutex
+	headings map[string]float64
+}
+
+func (h *headingsFlag) String() string {
+	if h == nil {
+		return ""
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	pairs := make([]string, 0, len(h.headings))
+	for name, heading := range h.headings {
+		pairs = append(pairs, name+"="+strconv.FormatFloat(heading, 'f', -1, 64))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h *headingsFlag) Set(value string) error {
+	headings := h.Headings()
+	if strings.TrimSpace(value) == "" {
+		headings = map[string]float64{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, heading, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		degrees, err := strconv.ParseFloat(strings.TrimSpace(heading), 64)
+		if !ok || name == "" || err != nil || degrees < 0 || degrees > 360 {
+			return fmt.Errorf("invalid heading %q, expected name=degrees", pair)
+		}
+		headings[name] = degrees
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.headings = headings
+	return nil
+}
+
+// Headings returns a copy of the headings.
+func (h *headingsFlag) Headings() map[string]float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	headings := make(map[string]float64, len(h.headings))
+	for name, heading := range h.headings {
+		headings[name] = heading
+	}
+	return headings
+}
+
+// updateWindComponents sets the headwind and crosswind of the station along
+// every -runway heading, replacing those of runways no longer configured. The
+// components are removed while the wind direction is missing, as it is in calm
+// or variable winds.
+func updateWindComponents(station string, response ObservationResponse) {
+	labels := prometheus.Labels{"station": station}
+	speed, hasSpeed := value(response.Properties.WindSpeed)
+	direction, hasDirection := value(response.Properties.WindDirection)
+	if !hasSpeed || !hasDirection {
+		headwind.DeletePartialMatch(labels)
+		crosswind.DeletePartialMatch(labels)
+		return
+	}
+
+	headwind.DeletePartialMatch(labels)
+	crosswind.DeletePartialMatch(labels)
+	for name, heading := range runways.Headings() {
+		angle := (direction - heading) * math.Pi / 180
+		headwind.WithLabelValues(station, name).Set(speed * math.Cos(angle))
+		crosswind.WithLabelValues(station, name).Set(speed * math.Sin(angle))
+	}
+}
+
+func init() {
+	addAccumulation(&Accumulation{
+		Name:      "wind_run_meters_total",
+		Help:      "wind run in meters, the distance travelled by the wind",
+		TodayName: "wind_run_today_meters",
+		TodayHelp: "wind run in meters since local midnight",
+		Increment: func(response ObservationResponse, elapsed time.Duration) (float64, bool) {
+			kmh, ok := value(response.Properties.WindSpeed)
+			if !ok {
+				return 0, false
+			}
+			return kmh * 1000 * elapsed.Hours(), true
+		},
+	})
+}
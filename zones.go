@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var stationZoneInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "station_zone_info",
+		Help: "forecast, county and fire weather zones covering the station, always 1",
+	},
+	[]string{"station", "forecast_zone", "county_zone", "fire_zone"},
+)
+
+// ZonesResponse is the json structure returned by the national weather
+// service zones api.
+type ZonesResponse struct {
+	Features []struct {
+		Properties struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// RetrieveZones looks up the zones of every type covering the given latitude
+// and longitude.
+func RetrieveZones(ctx context.Context, lat, lon float64, address string, timeout int) (ZonesResponse, error) {
+	requestURL := url.URL{
+		Scheme:   "https",
+		Host:     address,
+		Path:     "/zones",
+		RawQuery: url.Values{"point": {fmt.Sprintf("%.4f,%.4f", lat, lon)}}.Encode(),
+	}
+
+	response := ZonesResponse{}
+	_, err := retrieve(ctx, requestURL, timeout, &response)
+	return response, err
+}
+
+// StationZones are the ids of the zones covering a station, such as PAZ071.
+type StationZones struct {
+	Forecast string
+	County   string
+	Fire     string
+}
+
+// IDs returns the ids of the zones that are known.
+func (z StationZones) IDs() []string {
+	var ids []string
+	for _, id := range []string{z.Forecast, z.County, z.Fire} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// stationZones caches the zones of every station looked up by
+// ResolveStationZones.
+var stationZones = struct {
+	sync.Mutex
+	zones map[string]StationZones
+}{zones: map[string]StationZones{}}
+
+// ResolveStationZones looks up the forecast, county and fire weather zones
+// covering the location of an observation station. Zones the zones api does
+// not return are taken from the links of the station's point.
+func ResolveStationZones(ctx context.Context, station string, address string, timeout int) (StationZones, error) {
+	stationZones.Lock()
+	zones, ok := stationZones.zones[station]
+	stationZones.Unlock()
+	if ok {
+		return zones, nil
+	}
+
+	point, err := StationPoint(ctx, station, address, timeout)
+	if err != nil {
+		return StationZones{}, err
+	}
+	if len(point.Geometry.Coordinates) < 2 {
+		return StationZones{}, fmt.Errorf("point of station %s has no location", station)
+	}
+	lon, lat := point.Geometry.Coordinates[0], point.Geometry.Coordinates[1]
+	response, err := RetrieveZones(ctx, lat, lon, address, timeout)
+	if err != nil {
+		return StationZones{}, fmt.Errorf("looking up zones of station %s: %w", station, err)
+	}
+	for _, feature := range response.Features {
+		switch feature.Properties.Type {
+		case "public":
+			zones.Forecast = feature.Properties.ID
+		case "county":
+			zones.County = feature.Properties.ID
+		case "fire":
+			zones.Fire = feature.Properties.ID
+		}
+	}
+	for _, zone := range []struct {
+		id   *string
+		link string
+	}{
+		{&zones.Forecast, point.Properties.ForecastZone},
+		{&zones.County, point.Properties.County},
+		{&zones.Fire, point.Properties.FireWeatherZone},
+	} {
+		if *zone.id == "" && zone.link != "" {
+			*zone.id = path.Base(zone.link)
+		}
+	}
+	if len(zones.IDs()) == 0 {
+		return StationZones{}, fmt.Errorf("no zones found for station %s", station)
+	}
+
+	stationZones.Lock()
+	stationZones.zones[station] = zones
+	stationZones.Unlock()
+	return zones, nil
+}
+
+// updateStationZoneInfo exports the zones covering the station.
+func updateStationZoneInfo(station string, zones StationZones) {
+	stationZoneInfo.DeletePartialMatch(prometheus.Labels{"station": station})
+	stationZoneInfo.WithLabelValues(station, zones.Forecast, zones.County, zones.Fire).Set(1)
+}